@@ -7,6 +7,7 @@ require (
 	github.com/NVIDIA/go-nvml v0.12.4-1
 	github.com/prometheus/client_golang v1.20.5
 	google.golang.org/grpc v1.68.1
+	gopkg.in/yaml.v3 v3.0.1
 	k8s.io/kubelet v0.31.3
 )
 
@@ -29,5 +30,4 @@ require (
 	golang.org/x/text v0.18.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240903143218-8af14fe29dc1 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -32,6 +32,7 @@ func main() {
 		slog.String("metrics_path", cfg.MetricsPath))
 
 	slog.Info("Configuration",
+		slog.String("backend", cfg.Backend),
 		slog.Duration("process_scan_interval", cfg.ProcessScanInterval),
 		slog.Duration("metric_retention", cfg.MetricRetention),
 		slog.Bool("kubernetes_enabled", cfg.KubernetesEnabled))
@@ -42,7 +43,9 @@ func main() {
 		slog.Error("Failed to create collector", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
-	defer col.Shutdown()
+
+	// Start background sampling (independent of Prometheus scrapes)
+	col.Start()
 
 	// Create Prometheus exporter
 	exp := exporter.NewExporter(cfg, col)
@@ -115,6 +118,11 @@ func main() {
 		slog.Error("HTTP server shutdown failed", slog.String("error", err.Error()))
 	}
 
+	// Stop sampling and release GPU resources
+	if err := col.Shutdown(); err != nil {
+		slog.Error("Collector shutdown failed", slog.String("error", err.Error()))
+	}
+
 	slog.Info("Exporter stopped")
 }
 
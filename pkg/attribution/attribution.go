@@ -0,0 +1,99 @@
+package attribution
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/config"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// Interval is the energy a shared GPU consumed during one sampling interval
+// Joules is the active energy to share, with the idle baseline already removed
+type Interval struct {
+	GPU          uint
+	ModelName    string    // GPU model, e.g. "NVIDIA A100-SXM4-40GB"
+	Joules       float64   // Active energy to attribute
+	Seconds      float64   // Interval length
+	End          time.Time // End of the interval
+	FBTotalBytes float64   // Framebuffer size, NaN if unknown
+}
+
+// Start returns the start of the interval
+func (in Interval) Start() time.Time {
+	return in.End.Add(-time.Duration(in.Seconds * float64(time.Second)))
+}
+
+// Activity is a snapshot of one process's activity on the GPU during an interval
+type Activity struct {
+	PID             uint
+	SMUtilization   float64              // 0.0-1.0, relative to the MIG slice on MIG
+	MemUtilization  float64              // 0.0-1.0, relative to the MIG slice on MIG
+	MemoryUsedBytes uint64               // Framebuffer memory held by the process
+	ActiveSeconds   float64              // Time the process existed within the interval
+	MIG             *process.MIGInstance // nil unless running on a MIG slice
+}
+
+// Attributor shares a GPU's interval energy between the processes using it
+//
+// Attribute returns the joules attributed to each process, in the order of
+// processes. Shares must be non-negative and sum to at most interval.Joules;
+// energy left over is reported as unattributed.
+type Attributor interface {
+	// Name identifies the attributor in configuration and metric labels
+	Name() string
+
+	Attribute(interval Interval, processes []Activity) []float64
+}
+
+// Factory creates an attributor from the exporter configuration
+type Factory func(cfg *config.Config) Attributor
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		config.EnergyModelSM:         func(*config.Config) Attributor { return ProportionalSM{} },
+		config.EnergyModelWeighted:   func(cfg *config.Config) Attributor { return NewMemoryWeighted(cfg) },
+		config.EnergyModelEqualShare: func(*config.Config) Attributor { return EqualShare{} },
+		config.EnergyModelTimeShare:  func(*config.Config) Attributor { return TimeShare{} },
+	}
+)
+
+// Register makes an attributor available by name to --energy-model
+// Custom fairness rules can be added from an init function without changing the collector
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[name] = factory
+}
+
+// New creates the attributor registered under name
+func New(name string, cfg *config.Config) (Attributor, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown energy model %q (expected %s)", name, strings.Join(Names(), ", "))
+	}
+
+	return factory(cfg), nil
+}
+
+// Names returns the names of all registered attributors, sorted
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
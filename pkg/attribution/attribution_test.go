@@ -0,0 +1,147 @@
+package attribution
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/config"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// TestBuiltinAttributors tests each built-in strategy on the same snapshot
+func TestBuiltinAttributors(t *testing.T) {
+	interval := Interval{GPU: 0, ModelName: "Tesla T4", Joules: 120, Seconds: 10, End: time.Now(), FBTotalBytes: 8000}
+
+	// PID 100 is compute-bound and ran the whole interval; PID 101 is
+	// memory-bound and started half way through
+	processes := []Activity{
+		{PID: 100, SMUtilization: 0.8, MemUtilization: 0.2, MemoryUsedBytes: 1000, ActiveSeconds: 10},
+		{PID: 101, SMUtilization: 0.2, MemUtilization: 0.8, MemoryUsedBytes: 3000, ActiveSeconds: 5},
+	}
+
+	cfg := config.NewConfig()
+	cfg.EnergyModelCoefficients = config.ModelCoefficients{SM: 0.5, Memory: 0.5}
+
+	tests := []struct {
+		name string
+		want [2]float64
+	}{
+		{config.EnergyModelSM, [2]float64{96, 24}},
+		{config.EnergyModelWeighted, [2]float64{60, 60}},
+		{config.EnergyModelEqualShare, [2]float64{60, 60}},
+		{config.EnergyModelTimeShare, [2]float64{80, 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attributor, err := New(tt.name, cfg)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			if attributor.Name() != tt.name {
+				t.Errorf("Expected name %q, got %q", tt.name, attributor.Name())
+			}
+
+			shares := attributor.Attribute(interval, processes)
+			for i, want := range tt.want {
+				if !almostEqual(shares[i], want) {
+					t.Errorf("PID %d: expected %fJ, got %f", processes[i].PID, want, shares[i])
+				}
+			}
+		})
+	}
+}
+
+// TestMemoryWeighted_Coefficients tests footprint and per-GPU-model coefficients
+func TestMemoryWeighted_Coefficients(t *testing.T) {
+	processes := []Activity{
+		{PID: 100, SMUtilization: 0.8, MemoryUsedBytes: 1000},
+		{PID: 101, SMUtilization: 0.2, MemoryUsedBytes: 3000},
+	}
+
+	m := MemoryWeighted{
+		Coefficients:        config.ModelCoefficients{Footprint: 1},
+		CoefficientsByModel: map[string]config.ModelCoefficients{"A100": {SM: 1}},
+	}
+
+	// Footprint relative to the framebuffer: 1/8 and 3/8
+	shares := m.Attribute(Interval{ModelName: "Tesla T4", Joules: 100, FBTotalBytes: 8000}, processes)
+	if !almostEqual(shares[0], 25) || !almostEqual(shares[1], 75) {
+		t.Errorf("Expected footprint shares 25/75, got %v", shares)
+	}
+
+	// Unknown framebuffer size: footprint relative to process memory gives the same split
+	shares = m.Attribute(Interval{ModelName: "Tesla T4", Joules: 100, FBTotalBytes: math.NaN()}, processes)
+	if !almostEqual(shares[0], 25) || !almostEqual(shares[1], 75) {
+		t.Errorf("Expected footprint shares 25/75 without framebuffer size, got %v", shares)
+	}
+
+	shares = m.Attribute(Interval{ModelName: "NVIDIA A100-SXM4-40GB", Joules: 100}, processes)
+	if !almostEqual(shares[0], 80) || !almostEqual(shares[1], 20) {
+		t.Errorf("Expected A100 coefficients to share by SM (80/20), got %v", shares)
+	}
+}
+
+// TestProportional_MIG tests slice scaling and the slice-size fallback
+func TestProportional_MIG(t *testing.T) {
+	large := &process.MIGInstance{GPUInstanceID: 1, SliceFraction: 3.0 / 7}
+	small := &process.MIGInstance{GPUInstanceID: 2, SliceFraction: 1.0 / 7}
+
+	shares := ProportionalSM{}.Attribute(Interval{Joules: 100}, []Activity{
+		{PID: 100, SMUtilization: 0.5, MIG: large},
+		{PID: 101, SMUtilization: 0.5, MIG: small},
+	})
+	if !almostEqual(shares[0], 75) || !almostEqual(shares[1], 25) {
+		t.Errorf("Expected slice-scaled shares 75/25, got %v", shares)
+	}
+
+	// No utilization: weighted by slice size, split within the large slice
+	shares = ProportionalSM{}.Attribute(Interval{Joules: 100}, []Activity{
+		{PID: 100, MIG: large},
+		{PID: 101, MIG: large},
+		{PID: 102, MIG: small},
+	})
+	if !almostEqual(shares[0], 37.5) || !almostEqual(shares[1], 37.5) || !almostEqual(shares[2], 25) {
+		t.Errorf("Expected slice-size shares 37.5/37.5/25, got %v", shares)
+	}
+}
+
+// TestNoActivity tests that nothing is attributed without any weight
+func TestNoActivity(t *testing.T) {
+	shares := ProportionalSM{}.Attribute(Interval{Joules: 100}, []Activity{{PID: 100}, {PID: 101}})
+	if shares[0] != 0 || shares[1] != 0 {
+		t.Errorf("Expected no attribution without SM utilization, got %v", shares)
+	}
+}
+
+type fixedAttributor struct{}
+
+func (fixedAttributor) Name() string { return "fixed" }
+
+func (fixedAttributor) Attribute(interval Interval, processes []Activity) []float64 {
+	shares := make([]float64, len(processes))
+	shares[0] = interval.Joules
+	return shares
+}
+
+// TestRegister tests adding a custom attributor
+func TestRegister(t *testing.T) {
+	if _, err := New("fixed", config.NewConfig()); err == nil {
+		t.Fatal("Expected error for unregistered attributor")
+	}
+
+	Register("fixed", func(*config.Config) Attributor { return fixedAttributor{} })
+
+	attributor, err := New("fixed", config.NewConfig())
+	if err != nil {
+		t.Fatalf("New failed after Register: %v", err)
+	}
+	if shares := attributor.Attribute(Interval{Joules: 10}, []Activity{{PID: 1}, {PID: 2}}); shares[0] != 10 {
+		t.Errorf("Expected custom attributor to be used, got %v", shares)
+	}
+}
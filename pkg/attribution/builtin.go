@@ -0,0 +1,178 @@
+package attribution
+
+import (
+	"math"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/config"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// ProportionalSM shares energy by SM utilization
+type ProportionalSM struct{}
+
+// Name implements Attributor
+func (ProportionalSM) Name() string { return config.EnergyModelSM }
+
+// Attribute implements Attributor
+func (ProportionalSM) Attribute(interval Interval, processes []Activity) []float64 {
+	return proportional(interval, processes, func(a Activity) float64 {
+		return a.SMUtilization
+	})
+}
+
+// EqualShare splits energy evenly between processes, regardless of activity
+// On MIG GPUs slices are weighted by their size
+type EqualShare struct{}
+
+// Name implements Attributor
+func (EqualShare) Name() string { return config.EnergyModelEqualShare }
+
+// Attribute implements Attributor
+func (EqualShare) Attribute(interval Interval, processes []Activity) []float64 {
+	return proportional(interval, processes, func(Activity) float64 {
+		return 1
+	})
+}
+
+// TimeShare shares energy by how long each process existed within the interval
+// Processes present for the whole interval get equal shares; one that started
+// or exited part way through gets a share of the time it was there
+type TimeShare struct{}
+
+// Name implements Attributor
+func (TimeShare) Name() string { return config.EnergyModelTimeShare }
+
+// Attribute implements Attributor
+func (TimeShare) Attribute(interval Interval, processes []Activity) []float64 {
+	return proportional(interval, processes, func(a Activity) float64 {
+		return a.ActiveSeconds
+	})
+}
+
+// MemoryWeighted shares energy by a weighted sum of SM utilization, memory
+// bandwidth utilization and memory footprint (Approach 2 in
+// docs/PER-PROCESS-POWER-ESTIMATION.md), so memory-bound workloads with low SM
+// activity are not under-attributed
+//
+// Footprint is the fraction of the framebuffer the process holds; without the
+// framebuffer size it is relative to the memory used by all processes on the GPU.
+// Coefficients can be overridden per GPU model, since the power cost of memory
+// traffic relative to compute differs between architectures.
+type MemoryWeighted struct {
+	Coefficients        config.ModelCoefficients
+	CoefficientsByModel map[string]config.ModelCoefficients // Words of the GPU model name -> coefficients
+}
+
+// NewMemoryWeighted creates a MemoryWeighted attributor from the configured coefficients
+func NewMemoryWeighted(cfg *config.Config) MemoryWeighted {
+	return MemoryWeighted{
+		Coefficients:        cfg.EnergyModelCoefficients,
+		CoefficientsByModel: cfg.EnergyModelCoefficientsByModel,
+	}
+}
+
+// Name implements Attributor
+func (MemoryWeighted) Name() string { return config.EnergyModelWeighted }
+
+// Attribute implements Attributor
+func (m MemoryWeighted) Attribute(interval Interval, processes []Activity) []float64 {
+	coefficients := m.Coefficients
+	if c, ok := config.MatchModel(m.CoefficientsByModel, interval.ModelName); ok && interval.ModelName != "" {
+		coefficients = c
+	}
+
+	fbTotal := interval.FBTotalBytes
+	if math.IsNaN(fbTotal) || fbTotal <= 0 {
+		fbTotal = 0
+		for _, a := range processes {
+			fbTotal += float64(a.MemoryUsedBytes)
+		}
+	}
+
+	return proportional(interval, processes, func(a Activity) float64 {
+		var footprint float64
+		if fbTotal > 0 {
+			footprint = float64(a.MemoryUsedBytes) / fbTotal
+		}
+
+		return coefficients.SM*a.SMUtilization +
+			coefficients.Memory*a.MemUtilization +
+			coefficients.Footprint*footprint
+	})
+}
+
+// proportional shares interval energy in proportion to each process's weight
+//
+// On a MIG slice utilization is relative to the slice, so the weight is scaled
+// by the slice's fraction of the GPU: slices are apportioned by activity, then
+// processes within a slice by weight. MIG per-process utilization is often
+// unavailable; if no process has any weight, each slice is weighted by its
+// size and split evenly among its processes.
+func proportional(interval Interval, processes []Activity, weight func(Activity) float64) []float64 {
+	weights := make([]float64, len(processes))
+	var total float64
+
+	for i, a := range processes {
+		weights[i] = weight(a)
+		if a.MIG != nil {
+			weights[i] *= migSliceFraction(a.MIG)
+		}
+		total += weights[i]
+	}
+
+	if total == 0 && hasMIGProcesses(processes) {
+		weights, total = sliceWeights(processes)
+	}
+
+	shares := make([]float64, len(processes))
+	if total <= 0 {
+		return shares
+	}
+
+	for i := range processes {
+		shares[i] = interval.Joules * weights[i] / total
+	}
+
+	return shares
+}
+
+// sliceWeights weights each process by its MIG slice size, split evenly within a slice
+func sliceWeights(processes []Activity) ([]float64, float64) {
+	type sliceKey struct{ gi, ci uint }
+	perSlice := make(map[sliceKey]int)
+	for _, a := range processes {
+		if a.MIG != nil {
+			perSlice[sliceKey{a.MIG.GPUInstanceID, a.MIG.ComputeInstanceID}]++
+		}
+	}
+
+	weights := make([]float64, len(processes))
+	var total float64
+	for i, a := range processes {
+		if a.MIG != nil {
+			n := perSlice[sliceKey{a.MIG.GPUInstanceID, a.MIG.ComputeInstanceID}]
+			weights[i] = migSliceFraction(a.MIG) / float64(n)
+		}
+		total += weights[i]
+	}
+
+	return weights, total
+}
+
+// hasMIGProcesses reports whether any of the processes runs on a MIG slice
+func hasMIGProcesses(processes []Activity) bool {
+	for _, a := range processes {
+		if a.MIG != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// migSliceFraction returns the slice's share of the GPU, treating unknown sizes as a full GPU
+func migSliceFraction(mig *process.MIGInstance) float64 {
+	if mig.SliceFraction <= 0 {
+		return 1
+	}
+	return mig.SliceFraction
+}
@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// ErrNotSupported is returned when the GPU or backend cannot provide a value
+var ErrNotSupported = errors.New("not supported")
+
+// Backend provides the GPU telemetry the collector needs
+// Implementations wrap a telemetry source (DCGM, NVML, in-memory fake) so the
+// collector can run and be tested independently of the hardware underneath
+type Backend interface {
+	// Name returns a short identifier for logging (e.g. "dcgm")
+	Name() string
+
+	// DiscoverProcesses finds all GPU processes across all GPUs
+	DiscoverProcesses() ([]process.ProcessInfo, error)
+
+	// GetProcessMetrics retrieves metrics for a specific process, one entry per GPU it uses
+	// Returns nil if process not found or no data available
+	GetProcessMetrics(pid uint) ([]*dcgm.ProcessMetrics, error)
+
+	// GetAccountingRecord retrieves the driver's record of a process on a GPU, kept
+	// after the process exits, with its end time and final energy counter
+	// Returns nil if no record was kept
+	GetAccountingRecord(pid, gpuID uint) (*dcgm.ProcessMetrics, error)
+
+	// GetAccountingPIDs lists the processes the driver keeps accounting records for on
+	// a GPU, running or exited, including ones that exited before they were discovered
+	// Returns ErrNotSupported if accounting is disabled
+	GetAccountingPIDs(gpuID uint) ([]uint, error)
+
+	// GetGPUPowerUsage retrieves current power usage for a GPU in watts
+	GetGPUPowerUsage(gpuID uint) (float64, error)
+
+	// GetGPUTotalEnergy retrieves the cumulative hardware energy counter for a GPU in joules
+	// The counter resets when the driver reloads; returns ErrNotSupported if unavailable
+	GetGPUTotalEnergy(gpuID uint) (float64, error)
+
+	// GetValuesSince retrieves the power and per-process utilization a GPU recorded since a time
+	// Returns ErrNotSupported if the backend keeps no history
+	GetValuesSince(gpuID uint, since time.Time) (*dcgm.GPUSeries, error)
+
+	// GetDeviceMetrics retrieves device-level metrics (power, clocks, temperature, ...) for a GPU
+	GetDeviceMetrics(gpuID uint) (*dcgm.DeviceMetrics, error)
+
+	// GetDevices returns the stable identity (UUID, PCI bus ID, model) of every GPU
+	GetDevices() ([]process.DeviceInfo, error)
+
+	// GetDeviceModes retrieves the current MIG and compute mode of a GPU
+	GetDeviceModes(gpuID uint) (process.DeviceModes, error)
+
+	// Shutdown releases all resources held by the backend
+	Shutdown() error
+}
+
+// processKey identifies a process on a specific GPU
+type processKey struct {
+	pid uint
+	gpu uint
+}
+
+// Backend names accepted by New
+const (
+	NameAuto = "auto"
+	NameDCGM = "dcgm"
+	NameNVML = "nvml"
+)
+
+// New creates the backend selected by name
+// "auto" prefers DCGM and falls back to NVML-only when DCGM is unavailable
+func New(name string) (Backend, error) {
+	switch name {
+	case NameDCGM:
+		return NewDCGMBackend()
+	case NameNVML:
+		return NewNVMLBackend()
+	case NameAuto, "":
+		b, err := NewDCGMBackend()
+		if err == nil {
+			return b, nil
+		}
+
+		slog.Warn("DCGM unavailable, falling back to NVML-only backend",
+			slog.String("error", err.Error()))
+		return NewNVMLBackend()
+	default:
+		return nil, fmt.Errorf("unknown backend %q (expected auto, dcgm or nvml)", name)
+	}
+}
@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// DCGMBackend uses DCGM for per-process metrics and NVML for process discovery
+type DCGMBackend struct {
+	client    *dcgm.Client
+	discovery *process.Discovery
+}
+
+// NewDCGMBackend initializes DCGM and NVML and starts per-process watching
+func NewDCGMBackend() (*DCGMBackend, error) {
+	// Initialize DCGM client
+	client, err := dcgm.NewClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DCGM client: %w", err)
+	}
+
+	// Start watching for process metrics
+	if err := client.StartWatching(); err != nil {
+		client.Shutdown()
+		return nil, fmt.Errorf("failed to start DCGM watching: %w", err)
+	}
+
+	// Initialize process discovery
+	discovery, err := process.NewDiscovery()
+	if err != nil {
+		client.Shutdown()
+		return nil, fmt.Errorf("failed to create process discovery: %w", err)
+	}
+
+	return &DCGMBackend{
+		client:    client,
+		discovery: discovery,
+	}, nil
+}
+
+// Name implements Backend
+func (b *DCGMBackend) Name() string {
+	return NameDCGM
+}
+
+// DiscoverProcesses implements Backend
+func (b *DCGMBackend) DiscoverProcesses() ([]process.ProcessInfo, error) {
+	return b.discovery.DiscoverProcesses()
+}
+
+// GetProcessMetrics implements Backend
+func (b *DCGMBackend) GetProcessMetrics(pid uint) ([]*dcgm.ProcessMetrics, error) {
+	return b.client.GetProcessMetrics(pid)
+}
+
+// GetAccountingRecord implements Backend
+// DCGM keeps per-process stats for exited processes while it watches PID fields
+func (b *DCGMBackend) GetAccountingRecord(pid, gpuID uint) (*dcgm.ProcessMetrics, error) {
+	allMetrics, err := b.client.GetProcessMetrics(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, metrics := range allMetrics {
+		if metrics.GPU == gpuID {
+			return metrics, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetAccountingPIDs implements Backend
+// DCGM has no per-GPU process list, so the driver's accounting buffer is read through NVML
+func (b *DCGMBackend) GetAccountingPIDs(gpuID uint) ([]uint, error) {
+	return nvmlAccountingPIDs(gpuID)
+}
+
+// GetGPUPowerUsage implements Backend
+func (b *DCGMBackend) GetGPUPowerUsage(gpuID uint) (float64, error) {
+	return b.client.GetGPUPowerUsage(gpuID)
+}
+
+// GetGPUTotalEnergy implements Backend
+func (b *DCGMBackend) GetGPUTotalEnergy(gpuID uint) (float64, error) {
+	energy, err := b.client.GetGPUTotalEnergy(gpuID)
+	if errors.Is(err, dcgm.ErrFieldNotSupported) {
+		return 0, ErrNotSupported
+	}
+
+	return energy, err
+}
+
+// GetValuesSince implements Backend
+// Power comes from DCGM's field history, per-process utilization from NVML
+func (b *DCGMBackend) GetValuesSince(gpuID uint, since time.Time) (*dcgm.GPUSeries, error) {
+	power, err := b.client.GetPowerSince(gpuID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	sm, mem, err := nvmlProcessUtilization(gpuID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dcgm.GPUSeries{Power: power, SMUtilization: sm, MemUtilization: mem}, nil
+}
+
+// GetDeviceMetrics implements Backend
+func (b *DCGMBackend) GetDeviceMetrics(gpuID uint) (*dcgm.DeviceMetrics, error) {
+	return b.client.GetDeviceMetrics(gpuID)
+}
+
+// GetDevices implements Backend
+func (b *DCGMBackend) GetDevices() ([]process.DeviceInfo, error) {
+	return b.discovery.Devices()
+}
+
+// GetDeviceModes implements Backend
+func (b *DCGMBackend) GetDeviceModes(gpuID uint) (process.DeviceModes, error) {
+	return b.discovery.DeviceModes(gpuID)
+}
+
+// Shutdown implements Backend
+func (b *DCGMBackend) Shutdown() error {
+	if b.client != nil {
+		b.client.Shutdown()
+	}
+
+	if b.discovery != nil {
+		return b.discovery.Shutdown()
+	}
+
+	return nil
+}
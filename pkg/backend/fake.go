@@ -0,0 +1,332 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// Fake is an in-memory backend for tests and GPU-less development
+// All state is set explicitly by the caller; nothing touches real hardware
+type Fake struct {
+	mu        sync.Mutex
+	processes map[processKey]process.ProcessInfo  // (PID, GPU) -> discovery info
+	metrics   map[processKey]*dcgm.ProcessMetrics // (PID, GPU) -> per-process metrics
+	power     map[uint]float64                    // GPU ID -> power in watts
+	energy    map[uint]float64                    // GPU ID -> energy counter in joules
+	devices   map[uint]process.DeviceInfo         // GPU ID -> identity
+	device    map[uint]*dcgm.DeviceMetrics        // GPU ID -> device-level metrics
+	modes     map[uint]process.DeviceModes        // GPU ID -> MIG and compute mode
+	records   map[processKey]*dcgm.ProcessMetrics // (PID, GPU) -> accounting record
+	series    map[uint]*dcgm.GPUSeries            // GPU ID -> recorded time series
+}
+
+// NewFake creates an empty fake backend
+func NewFake() *Fake {
+	return &Fake{
+		processes: make(map[processKey]process.ProcessInfo),
+		metrics:   make(map[processKey]*dcgm.ProcessMetrics),
+		power:     make(map[uint]float64),
+		energy:    make(map[uint]float64),
+		devices:   make(map[uint]process.DeviceInfo),
+		device:    make(map[uint]*dcgm.DeviceMetrics),
+		modes:     make(map[uint]process.DeviceModes),
+		records:   make(map[processKey]*dcgm.ProcessMetrics),
+		series:    make(map[uint]*dcgm.GPUSeries),
+	}
+}
+
+// SetProcess adds or replaces a process running on info.GPU and its metrics
+// Call once per GPU for processes spanning several GPUs
+func (f *Fake) SetProcess(info process.ProcessInfo, metrics *dcgm.ProcessMetrics) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := processKey{pid: info.PID, gpu: info.GPU}
+	f.processes[key] = info
+	if metrics != nil {
+		m := *metrics
+		m.GPU = info.GPU
+		f.metrics[key] = &m
+	}
+}
+
+// RemoveProcess removes a process from all GPUs, as if it had exited
+func (f *Fake) RemoveProcess(pid uint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key := range f.processes {
+		if key.pid == pid {
+			delete(f.processes, key)
+			delete(f.metrics, key)
+		}
+	}
+}
+
+// SetAccountingRecord sets the accounting record reported for metrics.PID on metrics.GPU
+// Records are kept when the process is removed, as the driver keeps them
+func (f *Fake) SetAccountingRecord(metrics *dcgm.ProcessMetrics) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := *metrics
+	f.records[processKey{pid: metrics.PID, gpu: metrics.GPU}] = &m
+}
+
+// SetPower sets the power reading for a GPU in watts
+func (f *Fake) SetPower(gpuID uint, watts float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.power[gpuID] = watts
+}
+
+// SetTotalEnergy sets the cumulative energy counter for a GPU in joules
+// GPUs without a counter report ErrNotSupported
+func (f *Fake) SetTotalEnergy(gpuID uint, joules float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.energy[gpuID] = joules
+}
+
+// SetDevice adds or replaces the identity reported for GPU info.Index
+func (f *Fake) SetDevice(info process.DeviceInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.devices[info.Index] = info
+}
+
+// SetDeviceMetrics sets the device-level metrics reported for metrics.GPU
+func (f *Fake) SetDeviceMetrics(metrics *dcgm.DeviceMetrics) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := *metrics
+	f.device[metrics.GPU] = &m
+}
+
+// SetDeviceModes sets the MIG and compute mode reported for a GPU
+// GPUs without modes report ErrNotSupported
+func (f *Fake) SetDeviceModes(gpuID uint, modes process.DeviceModes) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.modes[gpuID] = modes
+}
+
+// SetSeries sets the time series recorded for a GPU, every series oldest first
+// GPUs without series report ErrNotSupported from GetValuesSince
+func (f *Fake) SetSeries(gpuID uint, series *dcgm.GPUSeries) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.series[gpuID] = series
+}
+
+// Name implements Backend
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// DiscoverProcesses implements Backend
+func (f *Fake) DiscoverProcesses() ([]process.ProcessInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	processes := make([]process.ProcessInfo, 0, len(f.processes))
+	for _, info := range f.processes {
+		processes = append(processes, info)
+	}
+
+	// Keep discovery order stable for deterministic tests
+	sort.Slice(processes, func(i, j int) bool {
+		if processes[i].PID != processes[j].PID {
+			return processes[i].PID < processes[j].PID
+		}
+		return processes[i].GPU < processes[j].GPU
+	})
+
+	return processes, nil
+}
+
+// GetProcessMetrics implements Backend
+func (f *Fake) GetProcessMetrics(pid uint) ([]*dcgm.ProcessMetrics, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var allMetrics []*dcgm.ProcessMetrics
+	for key, metrics := range f.metrics {
+		if key.pid == pid {
+			m := *metrics
+			allMetrics = append(allMetrics, &m)
+		}
+	}
+
+	sort.Slice(allMetrics, func(i, j int) bool {
+		return allMetrics[i].GPU < allMetrics[j].GPU
+	})
+
+	return allMetrics, nil
+}
+
+// GetAccountingRecord implements Backend
+func (f *Fake) GetAccountingRecord(pid, gpuID uint) (*dcgm.ProcessMetrics, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record, ok := f.records[processKey{pid: pid, gpu: gpuID}]
+	if !ok {
+		return nil, nil
+	}
+
+	m := *record
+	return &m, nil
+}
+
+// GetAccountingPIDs implements Backend
+// Lists the running processes and the accounting records on the GPU
+func (f *Fake) GetAccountingPIDs(gpuID uint) ([]uint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	listed := make(map[uint]bool)
+	for key := range f.processes {
+		if key.gpu == gpuID {
+			listed[key.pid] = true
+		}
+	}
+	for key := range f.records {
+		if key.gpu == gpuID {
+			listed[key.pid] = true
+		}
+	}
+
+	pids := make([]uint, 0, len(listed))
+	for pid := range listed {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(i, j int) bool {
+		return pids[i] < pids[j]
+	})
+
+	return pids, nil
+}
+
+// GetGPUPowerUsage implements Backend
+func (f *Fake) GetGPUPowerUsage(gpuID uint) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	power, ok := f.power[gpuID]
+	if !ok {
+		return 0, fmt.Errorf("no power data available for GPU %d", gpuID)
+	}
+
+	return power, nil
+}
+
+// GetGPUTotalEnergy implements Backend
+func (f *Fake) GetGPUTotalEnergy(gpuID uint) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	energy, ok := f.energy[gpuID]
+	if !ok {
+		return 0, ErrNotSupported
+	}
+
+	return energy, nil
+}
+
+// GetValuesSince implements Backend
+// Returns the samples of the series set by SetSeries taken at or after since
+func (f *Fake) GetValuesSince(gpuID uint, since time.Time) (*dcgm.GPUSeries, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	series, ok := f.series[gpuID]
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	result := &dcgm.GPUSeries{
+		Power:          samplesSince(series.Power, since),
+		SMUtilization:  make(map[uint][]dcgm.Sample, len(series.SMUtilization)),
+		MemUtilization: make(map[uint][]dcgm.Sample, len(series.MemUtilization)),
+	}
+	for pid, samples := range series.SMUtilization {
+		result.SMUtilization[pid] = samplesSince(samples, since)
+	}
+	for pid, samples := range series.MemUtilization {
+		result.MemUtilization[pid] = samplesSince(samples, since)
+	}
+
+	return result, nil
+}
+
+// samplesSince returns the samples taken at or after since
+func samplesSince(samples []dcgm.Sample, since time.Time) []dcgm.Sample {
+	var result []dcgm.Sample
+	for _, sample := range samples {
+		if !sample.Time.Before(since) {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+// GetDeviceMetrics implements Backend
+func (f *Fake) GetDeviceMetrics(gpuID uint) (*dcgm.DeviceMetrics, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	metrics, ok := f.device[gpuID]
+	if !ok {
+		return nil, fmt.Errorf("no device metrics available for GPU %d", gpuID)
+	}
+
+	m := *metrics
+	return &m, nil
+}
+
+// GetDevices implements Backend
+func (f *Fake) GetDevices() ([]process.DeviceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	devices := make([]process.DeviceInfo, 0, len(f.devices))
+	for _, info := range f.devices {
+		devices = append(devices, info)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Index < devices[j].Index
+	})
+
+	return devices, nil
+}
+
+// GetDeviceModes implements Backend
+func (f *Fake) GetDeviceModes(gpuID uint) (process.DeviceModes, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	modes, ok := f.modes[gpuID]
+	if !ok {
+		return process.DeviceModes{}, ErrNotSupported
+	}
+
+	return modes, nil
+}
+
+// Shutdown implements Backend
+func (f *Fake) Shutdown() error {
+	return nil
+}
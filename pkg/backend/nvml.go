@@ -0,0 +1,445 @@
+package backend
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// NVMLBackend provides per-process metrics using only the NVIDIA driver (no DCGM)
+//
+// Per-process metrics come from NVML accounting stats and process utilization
+// samples. NVML has no per-process energy counter, so EnergyConsumed is the
+// device energy counter delta since the process was first seen on the GPU.
+// Like DCGM, this is only meaningful when the process has the GPU to itself;
+// time-sliced GPUs are handled by the collector's energy estimation.
+type NVMLBackend struct {
+	discovery *process.Discovery
+
+	mu sync.Mutex
+
+	// PID -> GPUs the process was found on during the last discovery
+	processGPUs map[uint][]uint
+
+	// Latest utilization sample per process, refreshed on each discovery
+	utilSamples map[processKey]nvml.ProcessUtilizationSample
+	lastSeenTS  map[uint]uint64 // GPU ID -> timestamp of newest utilization sample
+
+	// Device energy counter (mJ) when the process was first seen
+	energyBaseline map[processKey]uint64
+}
+
+// NewNVMLBackend initializes NVML and enables per-process accounting where permitted
+func NewNVMLBackend() (*NVMLBackend, error) {
+	discovery, err := process.NewDiscovery()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create process discovery: %w", err)
+	}
+
+	b := &NVMLBackend{
+		discovery:      discovery,
+		processGPUs:    make(map[uint][]uint),
+		utilSamples:    make(map[processKey]nvml.ProcessUtilizationSample),
+		lastSeenTS:     make(map[uint]uint64),
+		energyBaseline: make(map[processKey]uint64),
+	}
+
+	b.enableAccounting()
+
+	return b, nil
+}
+
+// enableAccounting turns on NVML accounting mode so per-process stats are recorded
+// Requires root; failures are logged and per-process stats fall back to utilization samples
+func (b *NVMLBackend) enableAccounting() {
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return
+	}
+
+	for i := 0; i < count; i++ {
+		device, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+
+		mode, ret := device.GetAccountingMode()
+		if ret == nvml.SUCCESS && mode == nvml.FEATURE_ENABLED {
+			continue
+		}
+
+		if ret := device.SetAccountingMode(nvml.FEATURE_ENABLED); ret != nvml.SUCCESS {
+			slog.Warn("Failed to enable NVML accounting mode, per-process stats will be limited",
+				slog.Int("gpu", i),
+				slog.String("error", nvml.ErrorString(ret)))
+			continue
+		}
+
+		slog.Info("Enabled NVML accounting mode", slog.Int("gpu", i))
+	}
+}
+
+// Name implements Backend
+func (b *NVMLBackend) Name() string {
+	return NameNVML
+}
+
+// DiscoverProcesses implements Backend
+func (b *NVMLBackend) DiscoverProcesses() ([]process.ProcessInfo, error) {
+	processes, err := b.discovery.DiscoverProcesses()
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	seen := make(map[processKey]bool, len(processes))
+	processGPUs := make(map[uint][]uint)
+	gpus := make(map[uint]bool)
+
+	for _, proc := range processes {
+		key := processKey{pid: proc.PID, gpu: proc.GPU}
+		seen[key] = true
+		processGPUs[proc.PID] = append(processGPUs[proc.PID], proc.GPU)
+		gpus[proc.GPU] = true
+
+		// Record energy baseline for newly seen processes
+		if _, ok := b.energyBaseline[key]; !ok {
+			if energy, err := b.totalEnergy(proc.GPU); err == nil {
+				b.energyBaseline[key] = energy
+			}
+		}
+	}
+
+	// Forget state for processes that are gone
+	for key := range b.energyBaseline {
+		if !seen[key] {
+			delete(b.energyBaseline, key)
+		}
+	}
+	for key := range b.utilSamples {
+		if !seen[key] {
+			delete(b.utilSamples, key)
+		}
+	}
+
+	b.processGPUs = processGPUs
+
+	for gpu := range gpus {
+		b.refreshUtilSamples(gpu)
+	}
+
+	return processes, nil
+}
+
+// refreshUtilSamples reads utilization samples recorded since the last call
+// Must be called with b.mu held
+func (b *NVMLBackend) refreshUtilSamples(gpu uint) {
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpu))
+	if ret != nvml.SUCCESS {
+		return
+	}
+
+	samples, ret := device.GetProcessUtilization(b.lastSeenTS[gpu])
+	if ret == nvml.ERROR_NOT_FOUND {
+		// No new samples since last call - keep previous values
+		return
+	}
+	if ret != nvml.SUCCESS {
+		slog.Debug("Failed to get process utilization",
+			slog.Uint64("gpu", uint64(gpu)),
+			slog.String("error", nvml.ErrorString(ret)))
+		return
+	}
+
+	for _, sample := range samples {
+		key := processKey{pid: uint(sample.Pid), gpu: gpu}
+		if existing, ok := b.utilSamples[key]; ok && existing.TimeStamp > sample.TimeStamp {
+			continue
+		}
+		b.utilSamples[key] = sample
+
+		if sample.TimeStamp > b.lastSeenTS[gpu] {
+			b.lastSeenTS[gpu] = sample.TimeStamp
+		}
+	}
+}
+
+// GetProcessMetrics implements Backend
+func (b *NVMLBackend) GetProcessMetrics(pid uint) ([]*dcgm.ProcessMetrics, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	gpus := b.processGPUs[pid]
+	if len(gpus) == 0 {
+		return nil, nil
+	}
+
+	name, _ := process.GetProcessName(pid)
+
+	allMetrics := make([]*dcgm.ProcessMetrics, 0, len(gpus))
+	for _, gpu := range gpus {
+		metrics, err := b.gpuProcessMetrics(pid, gpu)
+		if err != nil {
+			return nil, err
+		}
+		metrics.ProcessName = name
+		allMetrics = append(allMetrics, metrics)
+	}
+
+	return allMetrics, nil
+}
+
+// gpuProcessMetrics builds metrics for a process on one GPU
+// Must be called with b.mu held
+func (b *NVMLBackend) gpuProcessMetrics(pid, gpu uint) (*dcgm.ProcessMetrics, error) {
+	key := processKey{pid: pid, gpu: gpu}
+
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpu))
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get device handle for GPU %d: %v", gpu, nvml.ErrorString(ret))
+	}
+
+	metrics := &dcgm.ProcessMetrics{
+		PID:       pid,
+		GPU:       gpu,
+		IsRunning: true,
+		StartTime: time.Unix(0, 0),
+		EndTime:   time.Unix(0, 0),
+	}
+
+	// Accounting stats: lifetime averages, peak memory and start time
+	stats, ret := device.GetAccountingStats(uint32(pid))
+	if ret == nvml.SUCCESS {
+		metrics.SmUtilization = float64(stats.GpuUtilization) / 100.0
+		metrics.MemUtilization = float64(stats.MemoryUtilization) / 100.0
+		metrics.MemoryUsedBytes = stats.MaxMemoryUsage
+		metrics.IsRunning = stats.IsRunning != 0
+		if stats.StartTime > 0 {
+			metrics.StartTime = time.UnixMicro(int64(stats.StartTime))
+		}
+		if !metrics.IsRunning && stats.Time > 0 {
+			metrics.EndTime = metrics.StartTime.Add(time.Duration(stats.Time) * time.Millisecond)
+		}
+	} else {
+		slog.Debug("NVML accounting stats unavailable",
+			slog.Uint64("pid", uint64(pid)),
+			slog.Uint64("gpu", uint64(gpu)),
+			slog.String("error", nvml.ErrorString(ret)))
+	}
+
+	// Recent utilization samples are preferred over lifetime averages
+	if sample, ok := b.utilSamples[key]; ok {
+		metrics.SmUtilization = float64(sample.SmUtil) / 100.0
+		metrics.MemUtilization = float64(sample.MemUtil) / 100.0
+	}
+
+	// Energy: device counter delta since the process was first seen
+	if baseline, ok := b.energyBaseline[key]; ok {
+		if energy, err := b.totalEnergy(gpu); err == nil && energy >= baseline {
+			metrics.EnergyConsumed = float64(energy-baseline) / 1000.0 // mJ -> J
+		}
+	}
+
+	slog.Debug("Retrieved process metrics from NVML",
+		slog.Uint64("pid", uint64(pid)),
+		slog.Uint64("gpu", uint64(gpu)),
+		slog.Float64("energy_joules", metrics.EnergyConsumed),
+		slog.Bool("is_running", metrics.IsRunning))
+
+	return metrics, nil
+}
+
+// GetAccountingRecord implements Backend
+// NVML accounting keeps exited processes in a per-GPU buffer, but without energy:
+// EnergyConsumed is left at 0 (unknown)
+func (b *NVMLBackend) GetAccountingRecord(pid, gpuID uint) (*dcgm.ProcessMetrics, error) {
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpuID))
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get device handle for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	stats, ret := device.GetAccountingStats(uint32(pid))
+	if ret == nvml.ERROR_NOT_FOUND || ret == nvml.ERROR_NOT_SUPPORTED {
+		return nil, nil
+	}
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get accounting stats for PID %d on GPU %d: %v", pid, gpuID, nvml.ErrorString(ret))
+	}
+
+	metrics := &dcgm.ProcessMetrics{
+		PID:             pid,
+		GPU:             gpuID,
+		SmUtilization:   float64(stats.GpuUtilization) / 100.0,
+		MemUtilization:  float64(stats.MemoryUtilization) / 100.0,
+		MemoryUsedBytes: stats.MaxMemoryUsage,
+		IsRunning:       stats.IsRunning != 0,
+		StartTime:       time.UnixMicro(int64(stats.StartTime)),
+		EndTime:         time.Unix(0, 0),
+	}
+	if !metrics.IsRunning && stats.Time > 0 {
+		metrics.EndTime = metrics.StartTime.Add(time.Duration(stats.Time) * time.Millisecond)
+	}
+
+	return metrics, nil
+}
+
+// GetAccountingPIDs implements Backend
+func (b *NVMLBackend) GetAccountingPIDs(gpuID uint) ([]uint, error) {
+	return nvmlAccountingPIDs(gpuID)
+}
+
+// nvmlAccountingPIDs lists the PIDs in a GPU's accounting buffer
+// The driver keeps the most recent processes there, exited ones included, while
+// accounting mode is enabled; DCGM enables it when it watches process fields
+func nvmlAccountingPIDs(gpuID uint) ([]uint, error) {
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpuID))
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get device handle for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	pids, ret := device.GetAccountingPids()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return nil, ErrNotSupported
+	}
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get accounting PIDs for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	result := make([]uint, 0, len(pids))
+	for _, pid := range pids {
+		result = append(result, uint(pid))
+	}
+
+	return result, nil
+}
+
+// totalEnergy returns the device energy counter in millijoules
+func (b *NVMLBackend) totalEnergy(gpu uint) (uint64, error) {
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpu))
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("failed to get device handle for GPU %d: %v", gpu, nvml.ErrorString(ret))
+	}
+
+	energy, ret := device.GetTotalEnergyConsumption()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return 0, ErrNotSupported
+	}
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("failed to get total energy for GPU %d: %v", gpu, nvml.ErrorString(ret))
+	}
+
+	return energy, nil
+}
+
+// GetGPUPowerUsage implements Backend
+func (b *NVMLBackend) GetGPUPowerUsage(gpuID uint) (float64, error) {
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpuID))
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("failed to get device handle for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	power, ret := device.GetPowerUsage()
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("failed to get power usage for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	// NVML reports milliwatts
+	return float64(power) / 1000.0, nil
+}
+
+// GetGPUTotalEnergy implements Backend
+func (b *NVMLBackend) GetGPUTotalEnergy(gpuID uint) (float64, error) {
+	energy, err := b.totalEnergy(gpuID)
+	if err != nil {
+		return 0, err
+	}
+
+	// NVML reports millijoules
+	return float64(energy) / 1000.0, nil
+}
+
+// GetValuesSince implements Backend
+// Reads the driver's power and process utilization sample buffers
+func (b *NVMLBackend) GetValuesSince(gpuID uint, since time.Time) (*dcgm.GPUSeries, error) {
+	power, err := nvmlPowerSamples(gpuID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	sm, mem, err := nvmlProcessUtilization(gpuID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dcgm.GPUSeries{Power: power, SMUtilization: sm, MemUtilization: mem}, nil
+}
+
+// GetDeviceMetrics implements Backend
+// Values the GPU does not support are left unavailable (NaN)
+func (b *NVMLBackend) GetDeviceMetrics(gpuID uint) (*dcgm.DeviceMetrics, error) {
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpuID))
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get device handle for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	metrics := dcgm.NewDeviceMetrics(gpuID)
+
+	if power, ret := device.GetPowerUsage(); ret == nvml.SUCCESS {
+		metrics.PowerWatts = float64(power) / 1000.0 // mW -> W
+	}
+	if energy, ret := device.GetTotalEnergyConsumption(); ret == nvml.SUCCESS {
+		metrics.EnergyJoules = float64(energy) / 1000.0 // mJ -> J
+	}
+	if limit, ret := device.GetEnforcedPowerLimit(); ret == nvml.SUCCESS {
+		metrics.PowerLimitWatts = float64(limit) / 1000.0 // mW -> W
+	}
+	if temp, ret := device.GetTemperature(nvml.TEMPERATURE_GPU); ret == nvml.SUCCESS {
+		metrics.TemperatureCelsius = float64(temp)
+	}
+	if clock, ret := device.GetClockInfo(nvml.CLOCK_SM); ret == nvml.SUCCESS {
+		metrics.SMClockMHz = float64(clock)
+	}
+	if clock, ret := device.GetClockInfo(nvml.CLOCK_MEM); ret == nvml.SUCCESS {
+		metrics.MemClockMHz = float64(clock)
+	}
+	if util, ret := device.GetUtilizationRates(); ret == nvml.SUCCESS {
+		metrics.GPUUtilization = float64(util.Gpu) / 100.0
+		metrics.MemUtilization = float64(util.Memory) / 100.0
+	}
+	if mem, ret := device.GetMemoryInfo(); ret == nvml.SUCCESS {
+		metrics.FBUsedBytes = float64(mem.Used)
+		metrics.FBFreeBytes = float64(mem.Free)
+	}
+	if reasons, ret := device.GetCurrentClocksEventReasons(); ret == nvml.SUCCESS {
+		metrics.ThrottleReasons = reasons
+		metrics.ThrottleReasonsSupported = true
+	}
+
+	return metrics, nil
+}
+
+// GetDevices implements Backend
+func (b *NVMLBackend) GetDevices() ([]process.DeviceInfo, error) {
+	return b.discovery.Devices()
+}
+
+// GetDeviceModes implements Backend
+func (b *NVMLBackend) GetDeviceModes(gpuID uint) (process.DeviceModes, error) {
+	return b.discovery.DeviceModes(gpuID)
+}
+
+// Shutdown implements Backend
+func (b *NVMLBackend) Shutdown() error {
+	if b.discovery != nil {
+		return b.discovery.Shutdown()
+	}
+
+	return nil
+}
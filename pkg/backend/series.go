@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+)
+
+// nvmlProcessUtilization reads the per-process utilization samples NVML recorded since a time
+// DCGM keeps no per-process time series, so both backends use NVML's sample buffer.
+// GPUs that do not sample process utilization return no samples.
+func nvmlProcessUtilization(gpuID uint, since time.Time) (sm, mem map[uint][]dcgm.Sample, err error) {
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpuID))
+	if ret != nvml.SUCCESS {
+		return nil, nil, fmt.Errorf("failed to get device handle for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	sm = make(map[uint][]dcgm.Sample)
+	mem = make(map[uint][]dcgm.Sample)
+
+	samples, ret := device.GetProcessUtilization(uint64(since.UnixMicro()))
+	switch ret {
+	case nvml.SUCCESS:
+	case nvml.ERROR_NOT_FOUND, nvml.ERROR_NOT_SUPPORTED:
+		// Nothing recorded since then, or not sampled on this GPU (e.g. MIG);
+		// the collector falls back to the processes' latest utilization
+		return sm, mem, nil
+	default:
+		return nil, nil, fmt.Errorf("failed to get process utilization for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	for _, sample := range samples {
+		pid := uint(sample.Pid)
+		t := time.UnixMicro(int64(sample.TimeStamp))
+		sm[pid] = append(sm[pid], dcgm.Sample{Time: t, Value: float64(sample.SmUtil) / 100.0})
+		mem[pid] = append(mem[pid], dcgm.Sample{Time: t, Value: float64(sample.MemUtil) / 100.0})
+	}
+	for pid := range sm {
+		dcgm.SortSamples(sm[pid])
+		dcgm.SortSamples(mem[pid])
+	}
+
+	return sm, mem, nil
+}
+
+// nvmlPowerSamples reads the power samples NVML recorded for a GPU since a time, oldest first
+func nvmlPowerSamples(gpuID uint, since time.Time) ([]dcgm.Sample, error) {
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpuID))
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get device handle for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	valueType, samples, ret := device.GetSamples(nvml.TOTAL_POWER_SAMPLES, uint64(since.UnixMicro()))
+	switch ret {
+	case nvml.SUCCESS:
+	case nvml.ERROR_NOT_FOUND:
+		return nil, nil
+	case nvml.ERROR_NOT_SUPPORTED:
+		return nil, ErrNotSupported
+	default:
+		return nil, fmt.Errorf("failed to get power samples for GPU %d: %v", gpuID, nvml.ErrorString(ret))
+	}
+
+	power := make([]dcgm.Sample, 0, len(samples))
+	for _, sample := range samples {
+		milliwatts, ok := sampleValue(valueType, sample.SampleValue)
+		if !ok {
+			continue
+		}
+		power = append(power, dcgm.Sample{
+			Time:  time.UnixMicro(int64(sample.TimeStamp)),
+			Value: milliwatts / 1000.0,
+		})
+	}
+	dcgm.SortSamples(power)
+
+	return power, nil
+}
+
+// sampleValue decodes an NVML sample value (a C union in host byte order)
+func sampleValue(valueType nvml.ValueType, raw [8]byte) (float64, bool) {
+	switch valueType {
+	case nvml.VALUE_TYPE_DOUBLE:
+		return math.Float64frombits(binary.NativeEndian.Uint64(raw[:])), true
+	case nvml.VALUE_TYPE_UNSIGNED_INT:
+		return float64(binary.NativeEndian.Uint32(raw[:4])), true
+	case nvml.VALUE_TYPE_SIGNED_INT:
+		return float64(int32(binary.NativeEndian.Uint32(raw[:4]))), true
+	case nvml.VALUE_TYPE_UNSIGNED_LONG, nvml.VALUE_TYPE_UNSIGNED_LONG_LONG:
+		return float64(binary.NativeEndian.Uint64(raw[:])), true
+	case nvml.VALUE_TYPE_SIGNED_LONG_LONG:
+		return float64(int64(binary.NativeEndian.Uint64(raw[:]))), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,173 @@
+package collector
+
+import (
+	"log/slog"
+	"math"
+)
+
+const (
+	// accuracyMinJoules is the least energy a window must have to be checked
+	// Relative error is meaningless for near-zero denominators
+	accuracyMinJoules = 1.0
+)
+
+// AccuracyBuckets are the upper bounds of the absolute relative error histogram
+var AccuracyBuckets = []float64{0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1}
+
+// AttributionAccuracy compares, per GPU, the energy added to process counters
+// with the device-measured energy that should have gone to processes
+//
+// Each check window spans one process scan. The expected energy is the device
+// energy minus idle energy not attributed to processes; the attributed energy is
+// the increase of the per-process counters. Windows in which processes started
+// or exited are skipped, since per-process counters and device energy then cover
+// different spans.
+type AttributionAccuracy struct {
+	ResidualJoules float64 // Latest window: expected - attributed
+	RelativeError  float64 // Latest window: residual / expected
+
+	// Histogram of absolute relative errors (cumulative counts per AccuracyBuckets bound)
+	Count   uint64
+	Sum     float64
+	Buckets map[float64]uint64
+
+	Exceeded uint64 // Windows whose absolute relative error exceeded the threshold
+}
+
+// accuracyWindow accumulates one GPU's energy between checks
+type accuracyWindow struct {
+	expected float64                // Device energy that should be in process counters (J)
+	baseline map[ProcessKey]float64 // Process counters at the start of the window
+	accuracy AttributionAccuracy
+	checked  bool // At least one window has been checked
+	missed   bool // An interval in the window could not be measured
+}
+
+// addAccuracyInterval adds an interval's device energy, less idle energy kept per GPU, to the window
+// Must be called with c.mu held
+func (c *Collector) addAccuracyInterval(gpuID uint, interval gpuEnergyInterval, split energySplit) {
+	w := c.accuracyWindow(gpuID)
+	w.expected += interval.Joules - split.Idle
+}
+
+// accuracyWindow returns the window of a GPU, creating it if needed
+// Must be called with c.mu held
+func (c *Collector) accuracyWindow(gpuID uint) *accuracyWindow {
+	w, ok := c.accuracy[gpuID]
+	if !ok {
+		// Every bound is exported from the first check, hit or not, so the
+		// histogram is complete and cumulative
+		buckets := make(map[float64]uint64, len(AccuracyBuckets))
+		for _, bound := range AccuracyBuckets {
+			buckets[bound] = 0
+		}
+		w = &accuracyWindow{accuracy: AttributionAccuracy{Buckets: buckets}}
+		c.accuracy[gpuID] = w
+	}
+	return w
+}
+
+// checkAccuracy closes every GPU's window, comparing expected and attributed energy
+// Called after a scan, when all per-process counters are up to date
+func (c *Collector) checkAccuracy() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := make(map[uint]map[ProcessKey]float64)
+	for key, pm := range c.processMetrics {
+		if !pm.IsRunning {
+			continue
+		}
+		if current[key.GPU] == nil {
+			current[key.GPU] = make(map[ProcessKey]float64)
+		}
+		current[key.GPU][key] = pm.EnergyJoules
+	}
+
+	for gpuID := range current {
+		c.accuracyWindow(gpuID)
+	}
+
+	for gpuID, w := range c.accuracy {
+		counters := current[gpuID]
+
+		if w.baseline != nil && !w.missed && sameProcesses(w.baseline, counters) && w.expected >= accuracyMinJoules {
+			var attributed float64
+			for key, joules := range counters {
+				attributed += joules - w.baseline[key]
+			}
+			c.recordAccuracy(gpuID, w, w.expected-attributed, w.expected)
+		}
+
+		w.baseline = counters
+		if w.baseline == nil {
+			w.baseline = map[ProcessKey]float64{}
+		}
+		w.expected = 0
+		w.missed = false
+	}
+}
+
+// recordAccuracy records one checked window
+// Must be called with c.mu held
+func (c *Collector) recordAccuracy(gpuID uint, w *accuracyWindow, residual, expected float64) {
+	relative := residual / expected
+	abs := math.Abs(relative)
+
+	a := &w.accuracy
+	a.ResidualJoules = residual
+	a.RelativeError = relative
+	a.Count++
+	a.Sum += abs
+	for _, bound := range AccuracyBuckets {
+		if abs <= bound {
+			a.Buckets[bound]++
+		}
+	}
+	w.checked = true
+
+	if c.config.AttributionErrorThreshold > 0 && abs > c.config.AttributionErrorThreshold {
+		a.Exceeded++
+		slog.Warn("Attributed energy differs from measured GPU energy",
+			slog.Uint64("gpu", uint64(gpuID)),
+			slog.Float64("expected_J", expected),
+			slog.Float64("residual_J", residual),
+			slog.Float64("relative_error", relative),
+			slog.Float64("threshold", c.config.AttributionErrorThreshold))
+	}
+}
+
+// sameProcesses reports whether two windows saw the same processes
+func sameProcesses(a, b map[ProcessKey]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// GetAttributionAccuracy returns the accuracy self-check of every GPU checked at least once
+func (c *Collector) GetAttributionAccuracy() map[uint]AttributionAccuracy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	accuracy := make(map[uint]AttributionAccuracy, len(c.accuracy))
+	for gpuID, w := range c.accuracy {
+		if !w.checked {
+			continue
+		}
+
+		a := w.accuracy
+		a.Buckets = make(map[float64]uint64, len(w.accuracy.Buckets))
+		for bound, count := range w.accuracy.Buckets {
+			a.Buckets[bound] = count
+		}
+		accuracy[gpuID] = a
+	}
+
+	return accuracy
+}
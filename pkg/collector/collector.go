@@ -1,29 +1,51 @@
 package collector
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/vimalk78/my-gpu-exporter/pkg/attribution"
+	"github.com/vimalk78/my-gpu-exporter/pkg/backend"
 	"github.com/vimalk78/my-gpu-exporter/pkg/config"
 	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
 	"github.com/vimalk78/my-gpu-exporter/pkg/kubernetes"
 	"github.com/vimalk78/my-gpu-exporter/pkg/process"
 )
 
-// ProcessMetrics contains all metrics for a single process
+// ProcessKey identifies a process on a specific GPU
+// A process using several GPUs has one ProcessMetrics entry per GPU
+type ProcessKey struct {
+	PID uint
+	GPU uint
+}
+
+// ProcessMetrics contains all metrics for a single process on a single GPU
 type ProcessMetrics struct {
 	// Identity
 	PID          uint
 	GPU          uint
 	ProcessName  string
 	IsRunning    bool
-
-	// Energy (may be measured or estimated)
-	EnergyJoules    float64
-	EnergyEstimated bool // True if energy is estimated (time-slicing), false if measured
+	MIG          *process.MIGInstance // nil unless running on a MIG slice
+	MPS          bool                 // MPS client, or the MPS server when its clients are not visible
+	SharingMode  string               // How the GPU was shared at the latest scan (see gpuSharingMode)
+	ContextType  string               // Kind of GPU contexts held (process.Context* constants)
+
+	// Energy (see energyLedger): EnergyJoules = MeasuredEnergyJoules + EstimatedEnergyJoules
+	EnergyJoules          float64
+	MeasuredEnergyJoules  float64 // From the per-process counter while the GPU was exclusive
+	EstimatedEnergyJoules float64 // Attributed while the GPU was shared
+	EnergyEstimated       bool    // True once any estimated energy has been added
+	EnergyModel           string  // Attribution model when first seen, EnergyModelMeasured if estimation is disabled
+	ledger                energyLedger
+
+	// Power over the latest attribution interval, NaN if it could not be attributed
+	PowerWatts float64
 
 	// Utilization
 	SmUtilization  float64
@@ -41,45 +63,110 @@ type ProcessMetrics struct {
 	PodNamespace  string
 	ContainerName string
 	ContainerID   string
+
+	// Allowlisted pod labels and annotations (--pod-labels-allowlist, --pod-annotations-allowlist)
+	PodLabels      map[string]string
+	PodAnnotations map[string]string
 }
 
 // Collector collects per-process GPU metrics
 type Collector struct {
 	config          *config.Config
-	dcgmClient      *dcgm.Client
-	discovery       *process.Discovery
+	backend         backend.Backend
 	podMapper       *kubernetes.PodMapper
-	retention       *process.RetentionManager
+	retention       *process.Retention[ProcessKey]
 
 	mu              sync.RWMutex
-	processMetrics  map[uint]*ProcessMetrics  // PID -> metrics
+	processMetrics  map[ProcessKey]*ProcessMetrics  // (PID, GPU) -> metrics
+	devices         map[uint]process.DeviceInfo     // GPU ID -> identity (UUID, PCI bus ID, model)
+	deviceMetrics   map[uint]*dcgm.DeviceMetrics    // GPU ID -> latest device-level metrics
 
 	// Time-slicing detection
 	gpuProcessCount map[uint]int              // GPU ID -> number of active processes
-
-	// Energy estimation timing
-	lastEstimationTime map[uint]time.Time     // GPU ID -> last estimation timestamp
+	sharing         map[uint]GPUSharing       // GPU ID -> configured sharing (device plugin, NVML, MPS daemon)
+
+	// (PID, GPU) pairs found by the latest discovery, containerized or not
+	discovered map[ProcessKey]bool
+
+	// PIDs in each GPU's accounting records already handled (GPU ID -> PID set), and
+	// the containers of those still running, resolved while /proc has them
+	accountingPIDs   map[uint]map[uint]bool
+	unseenContainers map[ProcessKey]unseenContainer
+
+	// Kubelet GPU allocations, and the parent GPU of every MIG device seen
+	allocations []GPUAllocation
+	migParents  map[string]uint // MIG device UUID -> GPU ID
+
+	// Energy measurement state
+	lastEstimationTime map[uint]time.Time     // GPU ID -> last measurement timestamp
+	lastEnergyCounter  map[uint]float64       // GPU ID -> last hardware energy counter reading (J)
+	energyAccounts     map[uint]GPUEnergyAccount // GPU ID -> idle/attributed/unattributed energy
+	gpuPower           map[uint]GPUPower         // GPU ID -> measured/attributed power over the latest interval
+	accuracy           map[uint]*accuracyWindow  // GPU ID -> attribution accuracy self-check
+
+	// Energy attribution model name -> attributor
+	attributors map[string]attribution.Attributor
+
+	// Idle power calibration (nil if disabled)
+	idle *idleCalibrator
+
+	// Background sampling loop
+	stopCh       chan struct{}
+	wg           sync.WaitGroup
+	startOnce    sync.Once
+	shutdownOnce sync.Once
 }
 
-// NewCollector creates a new collector
+// NewCollector creates a new collector using the configured telemetry backend
 func NewCollector(cfg *config.Config) (*Collector, error) {
-	slog.Info("Initializing collector")
-
-	// Initialize DCGM client
-	dcgmClient, err := dcgm.NewClient()
+	b, err := backend.New(cfg.Backend)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create DCGM client: %w", err)
+		return nil, fmt.Errorf("failed to create %s backend: %w", cfg.Backend, err)
+	}
+
+	return NewCollectorWithBackend(cfg, b)
+}
+
+// NewCollectorWithBackend creates a new collector using the given telemetry backend
+func NewCollectorWithBackend(cfg *config.Config, b backend.Backend) (*Collector, error) {
+	slog.Info("Initializing collector", slog.String("backend", b.Name()))
+
+	if cfg.ProcessScanInterval <= 0 {
+		return nil, fmt.Errorf("process scan interval must be positive, got %s", cfg.ProcessScanInterval)
 	}
 
-	// Start watching for process metrics
-	if err := dcgmClient.StartWatching(); err != nil {
-		return nil, fmt.Errorf("failed to start DCGM watching: %w", err)
+	if cfg.PodCacheSize < 0 {
+		return nil, fmt.Errorf("pod cache size must not be negative, got %d", cfg.PodCacheSize)
 	}
 
-	// Initialize process discovery
-	discovery, err := process.NewDiscovery()
+	switch cfg.PodMetadataTarget {
+	case config.PodMetadataInfo, config.PodMetadataSeries:
+	default:
+		return nil, fmt.Errorf("unknown pod metadata target %q (expected info or series)", cfg.PodMetadataTarget)
+	}
+	if _, err := cfg.PodMetadataLabels(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.IdleEnergyAttribution {
+	case config.IdleAttributionNone, config.IdleAttributionProportional, config.IdleAttributionTimeShare:
+	default:
+		return nil, fmt.Errorf("unknown idle energy attribution %q (expected none, proportional or time-share)", cfg.IdleEnergyAttribution)
+	}
+
+	switch cfg.EnergyIntegration {
+	case config.EnergyIntegrationPoint:
+	case config.EnergyIntegrationSeries:
+		if cfg.EnergyIntegrationStep <= 0 {
+			return nil, fmt.Errorf("energy integration step must be positive, got %s", cfg.EnergyIntegrationStep)
+		}
+	default:
+		return nil, fmt.Errorf("unknown energy integration %q (expected point or series)", cfg.EnergyIntegration)
+	}
+
+	attributors, err := newAttributors(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create process discovery: %w", err)
+		return nil, err
 	}
 
 	// Initialize Kubernetes pod mapper (if enabled)
@@ -90,52 +177,195 @@ func NewCollector(cfg *config.Config) (*Collector, error) {
 			slog.Warn("Kubernetes pod-resources socket not found, disabling Kubernetes integration",
 				slog.String("socket", cfg.PodResourcesSocket))
 		} else {
-			podMapper = kubernetes.NewPodMapper(cfg.PodResourcesSocket)
+			podMapper, err = kubernetes.NewPodMapper(cfg.PodResourcesSocket, kubernetes.PodWatchOptions{
+				NodeName:   cfg.NodeName,
+				MaxPods:    cfg.PodCacheSize,
+				Kubeconfig: cfg.Kubeconfig,
+
+				Labels:      cfg.PodLabelsAllowlist,
+				Annotations: cfg.PodAnnotationsAllowlist,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to set up Kubernetes integration: %w", err)
+			}
 			slog.Info("Kubernetes integration enabled")
 		}
 	}
 
 	// Initialize retention manager
-	retention := process.NewRetentionManager(cfg.MetricRetention)
+	retention := process.NewRetention[ProcessKey](cfg.MetricRetention)
+
+	var idle *idleCalibrator
+	if cfg.IdlePowerCalibration {
+		idle = newIdleCalibrator(cfg.IdlePowerStateFile)
+	}
 
 	collector := &Collector{
 		config:             cfg,
-		dcgmClient:         dcgmClient,
-		discovery:          discovery,
+		backend:            b,
 		podMapper:          podMapper,
 		retention:          retention,
-		processMetrics:     make(map[uint]*ProcessMetrics),
+		attributors:        attributors,
+		processMetrics:     make(map[ProcessKey]*ProcessMetrics),
+		devices:            make(map[uint]process.DeviceInfo),
+		deviceMetrics:      make(map[uint]*dcgm.DeviceMetrics),
 		gpuProcessCount:    make(map[uint]int),
+		sharing:            make(map[uint]GPUSharing),
+		discovered:         make(map[ProcessKey]bool),
+		migParents:         make(map[string]uint),
+		accountingPIDs:     make(map[uint]map[uint]bool),
+		unseenContainers:   make(map[ProcessKey]unseenContainer),
 		lastEstimationTime: make(map[uint]time.Time),
+		lastEnergyCounter:  make(map[uint]float64),
+		energyAccounts:     make(map[uint]GPUEnergyAccount),
+		gpuPower:           make(map[uint]GPUPower),
+		accuracy:           make(map[uint]*accuracyWindow),
+		idle:               idle,
+		stopCh:             make(chan struct{}),
 	}
 
 	return collector, nil
 }
 
+// Start launches the background sampling loop
+// Process discovery runs every ProcessScanInterval and GPU energy is sampled
+// every DCGMUpdateFrequency, independently of how often Prometheus scrapes.
+// Scrapes only read the latest snapshot via GetMetrics.
+func (c *Collector) Start() {
+	c.startOnce.Do(func() {
+		c.wg.Add(1)
+		go c.run()
+	})
+}
+
+// run is the sampling loop started by Start
+func (c *Collector) run() {
+	defer c.wg.Done()
+
+	slog.Info("Starting sampling loop",
+		slog.Duration("process_scan_interval", c.config.ProcessScanInterval),
+		slog.Duration("sample_interval", c.config.DCGMUpdateFrequency))
+
+	// Initial collection so the first scrape has data
+	if err := c.Collect(); err != nil {
+		slog.Error("Collection failed", slog.String("error", err.Error()))
+	}
+
+	scanTicker := time.NewTicker(c.config.ProcessScanInterval)
+	defer scanTicker.Stop()
+
+	// Energy sampling between scans only helps when it is more frequent than scanning
+	var sampleC <-chan time.Time
+	if c.config.DCGMUpdateFrequency > 0 && c.config.DCGMUpdateFrequency < c.config.ProcessScanInterval {
+		sampleTicker := time.NewTicker(c.config.DCGMUpdateFrequency)
+		defer sampleTicker.Stop()
+		sampleC = sampleTicker.C
+	}
+
+	for {
+		select {
+		case <-c.stopCh:
+			slog.Info("Sampling loop stopped")
+			return
+		case <-scanTicker.C:
+			if err := c.Collect(); err != nil {
+				slog.Error("Collection failed", slog.String("error", err.Error()))
+			}
+		case <-sampleC:
+			c.sample()
+		}
+	}
+}
+
+// sample samples device metrics and attributes GPU energy between process scans
+// Discovery is cheap, so it runs on every sample too: when processes started or
+// exited since the last scan, a full scan runs instead. Short jobs are then tracked
+// from their first sample, and exited processes stop receiving energy shares.
+func (c *Collector) sample() {
+	processes, err := c.backend.DiscoverProcesses()
+	if err == nil && c.processesChanged(processes) {
+		slog.Debug("GPU processes changed since the last scan, scanning now")
+		if err := c.collect(processes); err != nil {
+			slog.Error("Collection failed", slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	c.sampleDevices()
+	c.detectAndValidateTimeSlicing()
+}
+
+// processesChanged reports whether discovery found a different set of processes than the latest scan
+func (c *Collector) processesChanged(processes []process.ProcessInfo) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(processes) != len(c.discovered) {
+		return true
+	}
+	for _, proc := range processes {
+		if !c.discovered[ProcessKey{PID: proc.PID, GPU: proc.GPU}] {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Collect performs a collection cycle
 func (c *Collector) Collect() error {
-	slog.Debug("Starting collection cycle")
-
 	// Discover running processes
-	processes, err := c.discovery.DiscoverProcesses()
+	processes, err := c.backend.DiscoverProcesses()
 	if err != nil {
 		return fmt.Errorf("failed to discover processes: %w", err)
 	}
 
+	return c.collect(processes)
+}
+
+// collect performs a collection cycle over already discovered processes
+func (c *Collector) collect(processes []process.ProcessInfo) error {
+	slog.Debug("Starting collection cycle")
+
+	// Device identities are static; load them until the first success
+	c.loadDevices()
+
+	// Sharing configuration can change at runtime, so it is read every scan
+	c.loadSharing()
+
 	slog.Debug("Discovered processes", slog.Int("count", len(processes)))
 
-	// Track which PIDs we've seen this cycle
-	seenPIDs := make(map[uint]bool)
+	// Group discovered entries by PID - a process using several GPUs appears once per GPU
+	var pids []uint
+	discovered := make(map[uint]map[uint]process.ProcessInfo) // PID -> GPU -> info
+	for _, proc := range processes {
+		if _, ok := discovered[proc.PID]; !ok {
+			discovered[proc.PID] = make(map[uint]process.ProcessInfo)
+			pids = append(pids, proc.PID)
+		}
+		discovered[proc.PID][proc.GPU] = proc
+	}
 
-	// Collect metrics for each process
+	// GPUs whose per-process counters report whole-GPU energy
+	c.mu.Lock()
+	sharedGPUs := c.sharedCounterGPUs(processes)
+	c.discovered = make(map[ProcessKey]bool, len(processes))
 	for _, proc := range processes {
-		seenPIDs[proc.PID] = true
+		c.discovered[ProcessKey{PID: proc.PID, GPU: proc.GPU}] = true
+	}
+	c.mu.Unlock()
 
+	// Identify the container of every process and the devices it uses
+	devices := c.GetDevices()
+	containerIDs := make(map[uint]string, len(pids))
+	podUIDs := make(map[uint]string, len(pids))
+	refs := make(map[string]*kubernetes.ContainerRef)
+	for _, pid := range pids {
 		// Get container ID for Kubernetes filtering
-		containerID, err := process.GetContainerID(proc.PID)
+		containerID, err := process.GetContainerID(pid)
 		if err != nil {
 			slog.Debug("Failed to get container ID",
-				slog.Uint64("pid", uint64(proc.PID)),
+				slog.Uint64("pid", uint64(pid)),
 				slog.String("error", err.Error()))
 			continue
 		}
@@ -144,119 +374,215 @@ func (c *Collector) Collect() error {
 		if containerID == "" {
 			// Not a containerized process - skip
 			slog.Debug("Skipping non-containerized process",
-				slog.Uint64("pid", uint64(proc.PID)))
+				slog.Uint64("pid", uint64(pid)))
+			continue
+		}
+
+		podUID, _ := process.GetPodUID(pid)
+		containerIDs[pid] = containerID
+		podUIDs[pid] = podUID
+
+		ref, ok := refs[containerID]
+		if !ok {
+			ref = &kubernetes.ContainerRef{ContainerID: containerID, PodUID: podUID}
+			refs[containerID] = ref
+		}
+		for _, proc := range discovered[pid] {
+			if uuid := processDeviceUUID(proc, devices); uuid != "" {
+				ref.DeviceUUIDs = append(ref.DeviceUUIDs, uuid)
+			}
+		}
+	}
+
+	// Join the devices with the kubelet's allocations (if enabled)
+	podInfos := c.resolvePods(refs, processes)
+
+	// Track which (PID, GPU) pairs we've seen this cycle
+	seenKeys := make(map[ProcessKey]bool)
+
+	// Collect metrics for each process
+	for _, pid := range pids {
+		containerID, ok := containerIDs[pid]
+		if !ok {
 			continue
 		}
 
 		// Get Kubernetes pod info (if enabled)
 		var podInfo *kubernetes.PodInfo
 		if c.podMapper != nil {
-			podInfo, err = c.podMapper.GetPodInfo(containerID)
-			if err != nil {
-				slog.Debug("Failed to get pod info by container ID",
-					slog.Uint64("pid", uint64(proc.PID)),
-					slog.String("container_id", containerID),
-					slog.String("error", err.Error()))
-			}
-
-			// Fallback: try lookup by pod UID from cgroup
-			if podInfo == nil {
-				podUID, _ := process.GetPodUID(proc.PID)
-				if podUID != "" {
-					podInfo, _ = c.podMapper.GetPodInfoByUID(podUID)
+			podInfo = podInfos[containerID]
+
+			// Look up the pod UID and container ID from the cgroup among the node's
+			// pods: as a fallback, also when only the pod was resolved above, and
+			// over the device join when they disagree. A container running on a GPU
+			// it was not allocated (privileged, NVIDIA_VISIBLE_DEVICES=all) is joined
+			// with the pod the GPU was allocated to.
+			if podUIDs[pid] != "" {
+				if info, _ := c.podMapper.GetPodInfoByContainer(podUIDs[pid], containerID); info != nil {
+					mismatch := podInfo != nil && (podInfo.PodName != info.PodName || podInfo.PodNamespace != info.PodNamespace)
+					if mismatch {
+						slog.Debug("Container runs on a GPU allocated to another pod, using the pod from its cgroup",
+							slog.Uint64("pid", uint64(pid)),
+							slog.String("container_id", containerID),
+							slog.String("pod", info.PodNamespace+"/"+info.PodName),
+							slog.String("allocated_pod", podInfo.PodNamespace+"/"+podInfo.PodName))
+					}
+					if podInfo == nil || podInfo.ContainerName == "" || mismatch {
+						podInfo = info
+					}
 				}
 			}
 
 			if podInfo == nil {
 				slog.Debug("Pod info not available, exporting with empty pod labels",
-					slog.Uint64("pid", uint64(proc.PID)),
+					slog.Uint64("pid", uint64(pid)),
 					slog.String("container_id", containerID))
 			}
 		}
 
-		// Get DCGM metrics for this process
-		metrics, err := c.dcgmClient.GetProcessMetrics(proc.PID)
+		// Allowlisted pod labels and annotations come from the watch of the node's pods
+		var podLabels, podAnnotations map[string]string
+		if podInfo != nil {
+			podLabels, podAnnotations = c.podMapper.GetPodMetadata(podUIDs[pid])
+		}
+
+		// Get DCGM metrics for this process (one entry per GPU)
+		allMetrics, err := c.backend.GetProcessMetrics(pid)
 		if err != nil {
 			slog.Warn("Failed to get DCGM metrics",
-				slog.Uint64("pid", uint64(proc.PID)),
+				slog.Uint64("pid", uint64(pid)),
 				slog.String("error", err.Error()))
 			continue
 		}
 
-		if metrics == nil {
-			// No DCGM data available yet
-			continue
-		}
+		for _, metrics := range allMetrics {
+			// Only GPUs the process is currently running on; stale per-GPU
+			// records are handled by exit detection below
+			proc, onGPU := discovered[pid][metrics.GPU]
+			if !onGPU {
+				continue
+			}
 
-		// Fallback to NVML memory if DCGM doesn't provide it
-		// DCGM's Memory.GlobalUsed is not supported on all GPU types (e.g., Tesla T4)
-		memoryUsed := metrics.MemoryUsedBytes
-		if memoryUsed == 0 && proc.MemoryUsed > 0 {
-			memoryUsed = proc.MemoryUsed
-			slog.Debug("Using NVML memory fallback (DCGM returned 0)",
-				slog.Uint64("pid", uint64(proc.PID)),
-				slog.Uint64("nvml_memory_bytes", proc.MemoryUsed))
-		}
-
-		// Build process metrics
-		pm := &ProcessMetrics{
-			PID:             proc.PID,
-			GPU:             metrics.GPU,
-			ProcessName:     metrics.ProcessName,
-			IsRunning:       metrics.IsRunning,
-			EnergyJoules:    metrics.EnergyConsumed,
-			SmUtilization:   metrics.SmUtilization,
-			MemUtilization:  metrics.MemUtilization,
-			MemoryUsedBytes: memoryUsed,
-			StartTime:       metrics.StartTime,
-			EndTime:         metrics.EndTime,
-			ContainerID:     containerID,
-		}
-
-		// Add Kubernetes labels
-		if podInfo != nil {
-			pm.PodName = podInfo.PodName
-			pm.PodNamespace = podInfo.PodNamespace
-			pm.ContainerName = podInfo.ContainerName
-		}
+			key := ProcessKey{PID: pid, GPU: metrics.GPU}
+			seenKeys[key] = true
+
+			// Fallback to NVML memory if DCGM doesn't provide it
+			// DCGM's Memory.GlobalUsed is not supported on all GPU types (e.g., Tesla T4)
+			memoryUsed := metrics.MemoryUsedBytes
+			if memoryUsed == 0 && proc.MemoryUsed > 0 {
+				memoryUsed = proc.MemoryUsed
+				slog.Debug("Using NVML memory fallback (DCGM returned 0)",
+					slog.Uint64("pid", uint64(pid)),
+					slog.Uint64("gpu", uint64(metrics.GPU)),
+					slog.Uint64("nvml_memory_bytes", proc.MemoryUsed))
+			}
 
-		// Store metrics - preserve accumulated energy if estimation was active
-		c.mu.Lock()
-		if existingPM, exists := c.processMetrics[proc.PID]; exists && existingPM.EnergyEstimated {
-			// Preserve accumulated energy from estimation
-			pm.EnergyJoules = existingPM.EnergyJoules
-			pm.EnergyEstimated = true
+			// Backends that only list compute processes leave the context type empty
+			contextType := proc.ContextType
+			if contextType == "" {
+				contextType = process.ContextCompute
+			}
+
+			// Build process metrics
+			pm := &ProcessMetrics{
+				PID:             pid,
+				GPU:             metrics.GPU,
+				ProcessName:     metrics.ProcessName,
+				IsRunning:       metrics.IsRunning,
+				SmUtilization:   metrics.SmUtilization,
+				MemUtilization:  metrics.MemUtilization,
+				MemoryUsedBytes: memoryUsed,
+				StartTime:       metrics.StartTime,
+				EndTime:         metrics.EndTime,
+				ContainerID:     containerID,
+				MIG:             proc.MIG,
+				MPS:             proc.MPS || proc.MPSServer,
+				ContextType:     contextType,
+				PowerWatts:      math.NaN(),
+			}
+
+			// Add Kubernetes labels
+			if podInfo != nil {
+				pm.PodName = podInfo.PodName
+				pm.PodNamespace = podInfo.PodNamespace
+				pm.ContainerName = podInfo.ContainerName
+				pm.PodLabels = podLabels
+				pm.PodAnnotations = podAnnotations
+			}
+
+			// Continue the energy ledger and add this scan's counter delta
+			// A reused PID is a new process: it starts a fresh entry
+			c.mu.Lock()
+			if existingPM, exists := c.processMetrics[key]; exists {
+				if pidReused(existingPM.StartTime, metrics.StartTime) {
+					slog.Info("PID reused by a new process, starting a fresh entry",
+						slog.Uint64("pid", uint64(pid)),
+						slog.Uint64("gpu", uint64(metrics.GPU)),
+						slog.String("previous_pod", existingPM.PodName),
+						slog.String("pod", pm.PodName))
+				} else {
+					pm.carryEnergy(existingPM)
+				}
+			}
+			// Running again after it stopped using this GPU, or a new process: it must not expire
+			c.retention.Unmark(key)
+			pm.recordCounter(metrics.EnergyConsumed, c.config.EnableEnergyEstimation && sharedGPUs[metrics.GPU], time.Now())
+			c.processMetrics[key] = pm
+			c.mu.Unlock()
+
+			slog.Debug("Collected metrics for process",
+				slog.Uint64("pid", uint64(pid)),
+				slog.Uint64("gpu", uint64(metrics.GPU)),
+				slog.Float64("energy_joules", pm.EnergyJoules),
+				slog.String("pod", pm.PodName))
 		}
-		c.processMetrics[proc.PID] = pm
-		c.mu.Unlock()
+	}
 
-		slog.Debug("Collected metrics for process",
-			slog.Uint64("pid", uint64(proc.PID)),
-			slog.Float64("energy_joules", pm.EnergyJoules),
-			slog.String("pod", pm.PodName))
+	// Classify each GPU now that the container of every process is known
+	c.mu.Lock()
+	gpuProcesses := make(map[uint][]*ProcessMetrics)
+	for key := range seenKeys {
+		gpuProcesses[key.GPU] = append(gpuProcesses[key.GPU], c.processMetrics[key])
 	}
+	for gpuID, pms := range gpuProcesses {
+		mode := c.gpuSharingMode(gpuID, pms)
+		for _, pm := range pms {
+			pm.SharingMode = mode
+			// The energy model labels the energy counter, so it is fixed for the
+			// life of the process even if the GPU later turns MPS or stops being MPS
+			if pm.EnergyModel == "" {
+				pm.EnergyModel = c.energyModelName(gpuID, mode == SharingModeMPS)
+			}
+		}
+	}
+	c.mu.Unlock()
 
-	// Check for exited processes
+	// Check for exited processes (or processes that stopped using a GPU)
 	c.mu.Lock()
-	for pid, pm := range c.processMetrics {
-		if !seenPIDs[pid] && !c.retention.IsExited(pid) {
+	for key, pm := range c.processMetrics {
+		if !seenKeys[key] && !c.retention.IsExited(key) {
 			// Process no longer running - mark as exited
 			pm.IsRunning = false
-			c.retention.MarkExited(pid)
+			pm.PowerWatts = 0
+			c.reconcileExited(key, pm)
+			c.retention.MarkExited(key)
 			slog.Info("Process exited",
-				slog.Uint64("pid", uint64(pid)),
-				slog.String("pod", pm.PodName))
+				slog.Uint64("pid", uint64(key.PID)),
+				slog.Uint64("gpu", uint64(key.GPU)),
+				slog.String("pod", pm.PodName),
+				slog.Float64("energy_joules", pm.EnergyJoules))
 		}
 	}
 	c.mu.Unlock()
 
 	// Remove metrics for expired processes (must be done BEFORE CleanupExpired)
 	c.mu.Lock()
-	for _, pid := range c.retention.GetExitedProcesses() {
-		if !c.retention.ShouldRetain(pid) {
-			delete(c.processMetrics, pid)
+	for _, key := range c.retention.GetExitedProcesses() {
+		if !c.retention.ShouldRetain(key) {
+			delete(c.processMetrics, key)
 			slog.Debug("Removed metrics for expired process",
-				slog.Uint64("pid", uint64(pid)))
+				slog.Uint64("pid", uint64(key.PID)),
+				slog.Uint64("gpu", uint64(key.GPU)))
 		}
 	}
 	c.mu.Unlock()
@@ -264,14 +590,98 @@ func (c *Collector) Collect() error {
 	// Clean up expired processes from retention manager
 	c.retention.CleanupExpired()
 
+	// Sample device-level metrics
+	c.sampleDevices()
+
 	// Detect and validate time-slicing
 	c.detectAndValidateTimeSlicing()
 
+	// Compare attributed with measured energy now that all counters are up to date
+	c.checkAccuracy()
+
+	c.saveIdleCalibration(false)
+
 	return nil
 }
 
+// reconcileExited completes an exited process from the driver's accounting record
+// The process exited some time after the scan that last saw it; the record has the
+// real end time and the energy counter's final value, which the ledger keeps if
+// the GPU was not shared
+// Must be called with c.mu held
+func (c *Collector) reconcileExited(key ProcessKey, pm *ProcessMetrics) {
+	record, err := c.backend.GetAccountingRecord(key.PID, key.GPU)
+	if err != nil {
+		slog.Debug("Failed to get accounting record for exited process",
+			slog.Uint64("pid", uint64(key.PID)),
+			slog.Uint64("gpu", uint64(key.GPU)),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	// Still running: the process only stopped using this GPU, or the PID was reused
+	if record == nil || record.IsRunning {
+		return
+	}
+	if pidReused(pm.StartTime, record.StartTime) {
+		return
+	}
+
+	if record.EndTime.Unix() > 0 {
+		pm.EndTime = record.EndTime
+	}
+	if record.EnergyConsumed > 0 {
+		pm.recordCounter(record.EnergyConsumed, false, time.Now())
+	}
+}
+
+// pidReused reports whether two start times of a PID belong to different processes
+// Unknown start times are assumed to be the same process
+func pidReused(previous, current time.Time) bool {
+	return previous.Unix() > 0 && current.Unix() > 0 && !current.Equal(previous)
+}
+
+// gpuEnergyInterval is the energy a GPU consumed since the previous collection cycle
+type gpuEnergyInterval struct {
+	Joules      float64
+	Seconds     float64
+	FromCounter bool            // True if taken from the hardware energy counter, false if from power
+	End         time.Time       // When the interval was measured
+	Series      *dcgm.GPUSeries // Power and utilization over the interval, nil when point-sampled
+}
+
+// Start returns when the interval began
+func (i gpuEnergyInterval) Start() time.Time {
+	return i.End.Add(-time.Duration(i.Seconds * float64(time.Second)))
+}
+
+// GPUEnergyAccount splits the energy a GPU consumed since the exporter started
+// IdleJoules + AttributedJoules + UnattributedJoules equals the measured device energy
+type GPUEnergyAccount struct {
+	IdleJoules         float64 // Consumed with no process running, or idle baseline not spread to processes
+	AttributedJoules   float64 // Added to per-process energy counters
+	UnattributedJoules float64 // Consumed by processes but not attributable (no utilization, estimation disabled)
+}
+
+// GPUPower compares a GPU's measured power with the power attributed to processes
+// over the latest interval
+type GPUPower struct {
+	MeasuredWatts   float64
+	AttributedWatts float64
+}
+
+// energySplit is how one interval of GPU energy was accounted
+type energySplit struct {
+	Idle         float64
+	Attributed   float64
+	Unattributed float64
+}
+
 // detectAndValidateTimeSlicing detects GPU time-slicing and applies estimation if needed
+// Every GPU in the inventory is measured each cycle so idle energy is accounted too
 func (c *Collector) detectAndValidateTimeSlicing() {
+	counters := c.readExclusiveCounters()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -284,141 +694,601 @@ func (c *Collector) detectAndValidateTimeSlicing() {
 		}
 	}
 
+	// GPUs to measure: all known devices plus any GPU running processes
+	gpus := make(map[uint]bool, len(c.devices))
+	for gpuID := range c.devices {
+		gpus[gpuID] = true
+	}
+	for gpuID := range gpuProcesses {
+		gpus[gpuID] = true
+	}
+
+	// GPUs that are not measured restart their energy baseline when work resumes,
+	// otherwise the first interval would span the whole gap
+	for gpuID := range c.lastEstimationTime {
+		if !gpus[gpuID] {
+			delete(c.lastEstimationTime, gpuID)
+			delete(c.lastEnergyCounter, gpuID)
+			delete(c.gpuPower, gpuID)
+		}
+	}
+	for gpuID := range c.gpuProcessCount {
+		if _, active := gpuProcesses[gpuID]; !active {
+			delete(c.gpuProcessCount, gpuID)
+		}
+	}
+
 	// Check each GPU for time-slicing
-	for gpuID, processes := range gpuProcesses {
+	for gpuID := range gpus {
+		processes := gpuProcesses[gpuID]
 		processCount := len(processes)
 
 		// Update process count tracking
-		c.gpuProcessCount[gpuID] = processCount
+		// Sampling runs every DCGMUpdateFrequency, so only log mode changes at info level
+		countChanged := c.gpuProcessCount[gpuID] != processCount
+		if processCount > 0 {
+			c.gpuProcessCount[gpuID] = processCount
+		}
 
-		// Single process - no time-slicing, use DCGM values directly
-		if processCount == 1 {
-			slog.Debug("Single process on GPU, using DCGM measured energy",
-				slog.Uint64("gpu", uint64(gpuID)))
+		// Measure every GPU each cycle so deltas always cover one cycle
+		interval, err := c.measureGPUEnergy(gpuID)
+		if err != nil {
+			slog.Warn("Failed to measure GPU energy",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.String("error", err.Error()))
+			c.accuracyWindow(gpuID).missed = true
 			continue
 		}
 
-		// Multiple processes detected - time-slicing scenario
-		// Always use estimation for time-slicing
-		slog.Info("Time-slicing detected: using SM-based energy estimation",
-			slog.Uint64("gpu", uint64(gpuID)),
-			slog.Int("process_count", processCount))
+		// Processes that exited since the last tick are booked first: final
+		// accounting records, and jobs too short to be discovered at all
+		exited := c.unseenExited(gpuID, processes, interval)
+		remaining, booked := c.bookExited(gpuID, interval)
 
-		if c.config.EnableEnergyEstimation {
-			err := c.applyEnergyEstimation(gpuID, processes)
-			if err != nil {
-				slog.Warn("Failed to apply energy estimation",
-					slog.Uint64("gpu", uint64(gpuID)),
-					slog.String("error", err.Error()))
-			}
+		var split energySplit
+		participants := append(append([]*ProcessMetrics{}, processes...), exited...)
+		if len(participants) == 0 && booked > 0 {
+			split = energySplit{Idle: remaining.Joules}
 		} else {
-			slog.Warn("Time-slicing detected but estimation is disabled",
-				slog.Uint64("gpu", uint64(gpuID)),
-				slog.Int("process_count", processCount),
-				slog.String("hint", "Enable --enable-energy-estimation for accurate per-process attribution"))
+			split = c.accountInterval(gpuID, participants, remaining, countChanged, counters)
+		}
+		split.Attributed += booked
+
+		account := c.energyAccounts[gpuID]
+		account.IdleJoules += split.Idle
+		account.AttributedJoules += split.Attributed
+		account.UnattributedJoules += split.Unattributed
+		c.energyAccounts[gpuID] = account
+		c.addAccuracyInterval(gpuID, interval, split)
+
+		if interval.Seconds > 0 {
+			c.gpuPower[gpuID] = GPUPower{
+				MeasuredWatts:   interval.Joules / interval.Seconds,
+				AttributedWatts: split.Attributed / interval.Seconds,
+			}
 		}
 	}
 }
 
-// applyEnergyEstimation estimates per-process energy based on SM utilization
-func (c *Collector) applyEnergyEstimation(gpuID uint, processes []*ProcessMetrics) error {
-	// Calculate total SM utilization across all processes
-	var totalSMUtil float64
-	for _, pm := range processes {
-		totalSMUtil += pm.SmUtilization
+// accountInterval attributes one interval of GPU energy to the GPU's processes
+// Must be called with c.mu held
+func (c *Collector) accountInterval(gpuID uint, processes []*ProcessMetrics, interval gpuEnergyInterval, countChanged bool, counters map[ProcessKey]float64) energySplit {
+	processCount := len(processes)
+
+	// No processes - everything the GPU consumed is idle energy
+	if processCount == 0 {
+		c.observeIdle(gpuID, interval)
+		return energySplit{Idle: interval.Joules}
 	}
 
-	if totalSMUtil == 0 {
-		slog.Debug("No SM utilization detected, cannot estimate energy",
+	// MIG slices share the parent GPU's power and MPS clients run inside the
+	// MPS server, and per-process counters report whole-GPU energy for both,
+	// so only exclusive GPUs use them directly
+	mode := c.gpuSharingMode(gpuID, processes)
+
+	// Single process - no time-slicing, use DCGM values directly
+	// The process owns the whole GPU, idle baseline included; its counter was
+	// read this cycle so the interval is booked with what the counter received
+	if processCount == 1 && mode == SharingModeExclusive {
+		slog.Debug("Single process on GPU, using DCGM measured energy",
 			slog.Uint64("gpu", uint64(gpuID)))
-		return nil
+		if counter, ok := counters[ProcessKey{PID: processes[0].PID, GPU: gpuID}]; ok {
+			processes[0].recordCounter(counter, false, interval.End)
+		}
+		return c.bookMeasured(gpuID, processes[0], interval)
 	}
 
-	// Get GPU-level power usage
-	gpuPower, err := c.dcgmClient.GetGPUPowerUsage(gpuID)
-	if err != nil {
-		return fmt.Errorf("failed to get GPU power: %w", err)
+	// Multiple processes detected - time-slicing scenario
+	// Always use estimation for time-slicing
+	if countChanged {
+		switch mode {
+		case SharingModeMIG:
+			slog.Info("MIG detected: apportioning GPU energy across slices by activity",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.Int("process_count", processCount))
+		case SharingModeMPS:
+			slog.Info("MPS detected: apportioning GPU energy across concurrent clients",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.Int("process_count", processCount))
+		case SharingModeExclusive:
+			slog.Info("Several processes of one container: splitting all GPU energy between them",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.Int("process_count", processCount))
+		default:
+			slog.Info("Time-slicing detected: using SM-based energy estimation",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.Int("process_count", processCount))
+		}
+	}
+
+	if c.config.EnableEnergyEstimation {
+		// The GPU was exclusive until this scan found it shared; the interval
+		// ending now is already in the previous sole process's counter reading
+		for _, pm := range processes {
+			if pm.measuredThrough(interval.Start()) {
+				for _, other := range processes {
+					other.setPower(0, interval)
+				}
+				return c.bookMeasured(gpuID, pm, interval)
+			}
+		}
+
+		if mode == SharingModeExclusive {
+			return c.applyContainerEstimation(gpuID, processes, interval)
+		}
+		return c.applyEnergyEstimation(gpuID, processes, interval, mode)
+	}
+
+	if countChanged {
+		slog.Warn("Time-slicing detected but estimation is disabled",
+			slog.Uint64("gpu", uint64(gpuID)),
+			slog.Int("process_count", processCount),
+			slog.String("hint", "Enable --enable-energy-estimation for accurate per-process attribution"))
+	}
+
+	// Per-process counters keep DCGM's values, which cannot be trusted here
+	for _, pm := range processes {
+		pm.PowerWatts = math.NaN()
+	}
+	idleEnergy := c.idleEnergy(gpuID, interval)
+	return energySplit{Idle: idleEnergy, Unattributed: interval.Joules - idleEnergy}
+}
+
+// readExclusiveCounters reads the per-process counters of processes alone on their GPU
+// The backend is called without holding c.mu, so a slow read does not block GetMetrics
+func (c *Collector) readExclusiveCounters() map[ProcessKey]float64 {
+	c.mu.RLock()
+	gpuProcesses := make(map[uint][]ProcessKey)
+	for key, pm := range c.processMetrics {
+		if pm.IsRunning {
+			gpuProcesses[key.GPU] = append(gpuProcesses[key.GPU], key)
+		}
+	}
+	c.mu.RUnlock()
+
+	counters := make(map[ProcessKey]float64)
+	for gpuID, keys := range gpuProcesses {
+		if len(keys) != 1 {
+			continue
+		}
+
+		allMetrics, err := c.backend.GetProcessMetrics(keys[0].PID)
+		if err != nil {
+			slog.Debug("Failed to read process energy counter",
+				slog.Uint64("pid", uint64(keys[0].PID)),
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.String("error", err.Error()))
+			continue
+		}
+
+		for _, metrics := range allMetrics {
+			if metrics.GPU == gpuID {
+				counters[keys[0]] = metrics.EnergyConsumed
+			}
+		}
+	}
+
+	return counters
+}
+
+// bookMeasured books the energy a process's counter received as attributed energy
+// The counter and the device are read at slightly different times, so at most the
+// interval's energy is booked; what the counter did not receive is split into
+// idle and unattributed energy as on shared GPUs
+// Must be called with c.mu held
+func (c *Collector) bookMeasured(gpuID uint, pm *ProcessMetrics, interval gpuEnergyInterval) energySplit {
+	booked := math.Min(pm.ledger.unbooked, interval.Joules)
+	pm.ledger.unbooked = 0
+	pm.setPower(booked, interval)
+
+	rest := interval.Joules - booked
+	idle := math.Min(c.idleEnergy(gpuID, interval), rest)
+	return energySplit{Idle: idle, Attributed: booked, Unattributed: rest - idle}
+}
+
+// idleEnergy returns the idle baseline part of an interval, capped at the interval energy
+// Must be called with c.mu held
+func (c *Collector) idleEnergy(gpuID uint, interval gpuEnergyInterval) float64 {
+	return math.Min(c.idlePower(gpuID).Watts*interval.Seconds, interval.Joules)
+}
+
+// idlePower returns the idle baseline for a GPU
+// Per-model overrides win over calibration, which wins over --gpu-idle-power
+// Must be called with c.mu held
+func (c *Collector) idlePower(gpuID uint) IdlePower {
+	info := c.devices[gpuID]
+
+	if watts, ok := config.MatchModel(c.config.GPUIdlePowerByModel, info.ModelName); ok && info.ModelName != "" {
+		return IdlePower{Watts: watts, Source: IdlePowerSourceOverride}
 	}
 
-	// Calculate actual elapsed time since last estimation
+	if c.idle != nil && info.UUID != "" {
+		if watts, ok := c.idle.baseline(info.UUID); ok {
+			return IdlePower{Watts: watts, Source: IdlePowerSourceCalibrated}
+		}
+	}
+
+	return IdlePower{Watts: c.config.GPUIdlePower, Source: IdlePowerSourceConfigured}
+}
+
+// observeIdle feeds the idle calibrator with the average power of an interval
+// in which the GPU had no processes and near-zero utilization
+// Must be called with c.mu held
+func (c *Collector) observeIdle(gpuID uint, interval gpuEnergyInterval) {
+	info := c.devices[gpuID]
+	if c.idle == nil || info.UUID == "" || interval.Seconds <= 0 {
+		return
+	}
+
+	// Without a utilization reading the GPU may be busy with non-container work
+	dm := c.deviceMetrics[gpuID]
+	if dm == nil || math.IsNaN(dm.GPUUtilization) || dm.GPUUtilization > idleUtilizationThreshold {
+		return
+	}
+
+	c.idle.observe(info.UUID, interval.Joules/interval.Seconds)
+}
+
+// saveIdleCalibration persists idle calibration, rate limited unless force is set
+func (c *Collector) saveIdleCalibration(force bool) {
+	if c.idle == nil {
+		return
+	}
+
+	models := make(map[string]string)
+	for _, info := range c.GetDevices() {
+		models[info.UUID] = info.ModelName
+	}
+
+	if err := c.idle.save(models, force); err != nil {
+		slog.Warn("Failed to save idle power calibration",
+			slog.String("path", c.config.IdlePowerStateFile),
+			slog.String("error", err.Error()))
+	}
+}
+
+// GetIdlePower returns the idle baseline in use for every GPU in the inventory
+func (c *Collector) GetIdlePower() map[uint]IdlePower {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	idle := make(map[uint]IdlePower, len(c.devices))
+	for gpuID := range c.devices {
+		idle[gpuID] = c.idlePower(gpuID)
+	}
+
+	return idle
+}
+
+// measureGPUEnergy returns the energy a GPU consumed since the last cycle
+// Uses deltas of the hardware energy counter; falls back to integrated power
+// series, or instantaneous power x elapsed time, when the counter is unsupported,
+// on the first reading, and after a counter reset (driver reload)
+// Must be called with c.mu held
+func (c *Collector) measureGPUEnergy(gpuID uint) (gpuEnergyInterval, error) {
+	// Calculate actual elapsed time since last measurement
 	now := time.Now()
-	var intervalSeconds float64
+	var interval gpuEnergyInterval
 	if lastTime, exists := c.lastEstimationTime[gpuID]; exists {
-		intervalSeconds = now.Sub(lastTime).Seconds()
+		interval.Seconds = now.Sub(lastTime).Seconds()
 	} else {
-		// First estimation - use configured interval as fallback
-		intervalSeconds = c.config.DCGMUpdateFrequency.Seconds()
+		// First measurement - use configured interval as fallback
+		interval.Seconds = c.config.DCGMUpdateFrequency.Seconds()
 	}
 	c.lastEstimationTime[gpuID] = now
+	interval.End = now
 
-	// Subtract idle power to get active power only
-	activePower := gpuPower - c.config.GPUIdlePower
-	if activePower < 0 {
-		activePower = 0 // Can't be negative
+	if c.config.EnergyIntegration == config.EnergyIntegrationSeries {
+		interval.Series = c.intervalSeries(gpuID, interval)
 	}
 
-	slog.Debug("GPU power for estimation",
-		slog.Uint64("gpu", uint64(gpuID)),
-		slog.Float64("total_power_watts", gpuPower),
-		slog.Float64("idle_power_watts", c.config.GPUIdlePower),
-		slog.Float64("active_power_watts", activePower),
-		slog.Float64("total_sm_util", totalSMUtil),
-		slog.Float64("interval_seconds", intervalSeconds))
+	counter, err := c.backend.GetGPUTotalEnergy(gpuID)
+	switch {
+	case err == nil:
+		previous, hasPrevious := c.lastEnergyCounter[gpuID]
+		c.lastEnergyCounter[gpuID] = counter
 
-	// Calculate total GPU energy for this interval (using active power only)
-	gpuEnergyJoules := activePower * intervalSeconds
+		if hasPrevious && counter >= previous {
+			interval.Joules = counter - previous
+			interval.FromCounter = true
+			return interval, nil
+		}
 
-	// Distribute energy proportionally based on SM utilization
-	for _, pm := range processes {
-		// Proportional attribution: process_energy = gpu_energy * (process_sm_util / total_sm_util)
-		proportion := pm.SmUtilization / totalSMUtil
-		estimatedEnergyInterval := gpuEnergyJoules * proportion
+		if hasPrevious {
+			slog.Info("GPU energy counter went backwards (driver reload?), using power for this interval",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.Float64("previous_J", previous),
+				slog.Float64("current_J", counter))
+		}
+	case errors.Is(err, backend.ErrNotSupported):
+		// Older GPUs have no energy counter - power integration is the only option
+	default:
+		// Drop the baseline so the next delta does not overlap this interval
+		delete(c.lastEnergyCounter, gpuID)
+		slog.Warn("Failed to read GPU energy counter, using power for this interval",
+			slog.Uint64("gpu", uint64(gpuID)),
+			slog.String("error", err.Error()))
+	}
+
+	// Power varying within the interval is better integrated than read once
+	if interval.Series != nil && len(interval.Series.Power) > 0 {
+		interval.Joules = integrate(interval.Series.Power, interval.Start(), interval.End)
+		return interval, nil
+	}
+
+	// Get GPU-level power usage
+	gpuPower, err := c.backend.GetGPUPowerUsage(gpuID)
+	if err != nil {
+		return interval, fmt.Errorf("failed to get GPU power: %w", err)
+	}
+
+	interval.Joules = gpuPower * interval.Seconds
+	return interval, nil
+}
+
+// applyEnergyEstimation estimates per-process energy on a shared GPU
+// Active energy is shared by the GPU's attributor (see pkg/attribution).
+// The idle baseline is kept as idle energy or spread across processes depending
+// on IdleEnergyAttribution.
+func (c *Collector) applyEnergyEstimation(gpuID uint, processes []*ProcessMetrics, interval gpuEnergyInterval, mode string) energySplit {
+	attributor := c.attributorFor(gpuID, mode == SharingModeMPS)
+
+	// Subtract idle energy to get active energy only
+	idleEnergy := c.idleEnergy(gpuID, interval)
+	activeEnergy := interval.Joules - idleEnergy
+
+	split := energySplit{Idle: idleEnergy}
+	shares := c.attribute(attributor, gpuID, processes, interval, activeEnergy, c.idlePower(gpuID).Watts)
 
-		// Accumulate the energy (counter behavior)
-		// Note: This adds the estimated energy for this interval to the cumulative total
+	var attributed float64
+	for _, share := range shares {
+		attributed += share
+	}
+	split.Unattributed = math.Max(activeEnergy-attributed, 0)
+
+	if attributed == 0 {
+		slog.Debug("No process activity detected, cannot estimate energy",
+			slog.Uint64("gpu", uint64(gpuID)),
+			slog.String("energy_model", attributor.Name()))
+	}
+
+	switch c.config.IdleEnergyAttribution {
+	case config.IdleAttributionProportional:
+		// Spread like active energy
+		if attributed > 0 {
+			for i := range processes {
+				shares[i] += idleEnergy * shares[i] / attributed
+			}
+			split.Idle = 0
+		}
+	case config.IdleAttributionTimeShare:
+		// Every process present in the interval had the same share of GPU time
+		for i := range processes {
+			shares[i] += idleEnergy / float64(len(processes))
+		}
+		split.Idle = 0
+	}
+
+	slog.Debug("GPU energy for estimation",
+		slog.Uint64("gpu", uint64(gpuID)),
+		slog.Float64("total_energy_J", interval.Joules),
+		slog.Bool("from_counter", interval.FromCounter),
+		slog.Float64("idle_energy_J", idleEnergy),
+		slog.Float64("active_energy_J", activeEnergy),
+		slog.String("idle_attribution", c.config.IdleEnergyAttribution),
+		slog.String("energy_model", attributor.Name()),
+		slog.Float64("attributed_J", attributed),
+		slog.Float64("interval_seconds", interval.Seconds))
+
+	for i, pm := range processes {
+		// Per-process counters are not valid for this interval even if nothing was attributed
 		previousEnergy := pm.EnergyJoules
-		pm.EnergyJoules += estimatedEnergyInterval
-		pm.EnergyEstimated = true
+		pm.addEstimate(shares[i])
+		pm.setPower(shares[i], interval)
+		split.Attributed += shares[i]
 
 		slog.Debug("Applied energy estimation",
 			slog.Uint64("pid", uint64(pm.PID)),
 			slog.String("pod", pm.PodName),
 			slog.Float64("sm_util", pm.SmUtilization),
-			slog.Float64("proportion", proportion),
-			slog.Float64("interval_energy_J", estimatedEnergyInterval),
+			slog.Float64("mem_util", pm.MemUtilization),
+			slog.Float64("interval_energy_J", shares[i]),
 			slog.Float64("previous_total_J", previousEnergy),
 			slog.Float64("new_total_J", pm.EnergyJoules))
 	}
 
-	return nil
+	return split
 }
 
-// GetMetrics returns current metrics snapshot
-func (c *Collector) GetMetrics() map[uint]*ProcessMetrics {
+// applyContainerEstimation splits a GPU's energy between processes of the one container using it
+// The container has the GPU to itself, so like a lone process it gets all of the
+// energy, idle baseline included. The attributor only decides the split between
+// its processes; energy it leaves unattributed is split evenly.
+func (c *Collector) applyContainerEstimation(gpuID uint, processes []*ProcessMetrics, interval gpuEnergyInterval) energySplit {
+	shares := c.attribute(c.attributorFor(gpuID, false), gpuID, processes, interval, interval.Joules, 0)
+
+	var attributed float64
+	for _, share := range shares {
+		attributed += share
+	}
+	remainder := math.Max(interval.Joules-attributed, 0) / float64(len(processes))
+
+	var split energySplit
+	for i, pm := range processes {
+		share := shares[i] + remainder
+		pm.addEstimate(share)
+		pm.setPower(share, interval)
+		split.Attributed += share
+	}
+
+	return split
+}
+
+// GetGPUPower returns the measured and attributed power of every measured GPU keyed by GPU ID
+func (c *Collector) GetGPUPower() map[uint]GPUPower {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	power := make(map[uint]GPUPower, len(c.gpuPower))
+	for gpuID, p := range c.gpuPower {
+		power[gpuID] = p
+	}
+
+	return power
+}
+
+// GetEnergyAccounts returns the per-GPU energy split keyed by GPU ID
+func (c *Collector) GetEnergyAccounts() map[uint]GPUEnergyAccount {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	accounts := make(map[uint]GPUEnergyAccount, len(c.energyAccounts))
+	for gpuID, account := range c.energyAccounts {
+		accounts[gpuID] = account
+	}
+
+	return accounts
+}
+
+// hasMIGProcesses reports whether any of the processes runs on a MIG slice
+func hasMIGProcesses(processes []*ProcessMetrics) bool {
+	for _, pm := range processes {
+		if pm.MIG != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDevices reads the GPU inventory from the backend if not loaded yet
+func (c *Collector) loadDevices() {
+	c.mu.RLock()
+	loaded := len(c.devices) > 0
+	c.mu.RUnlock()
+	if loaded {
+		return
+	}
+
+	devices, err := c.backend.GetDevices()
+	if err != nil {
+		slog.Warn("Failed to read GPU inventory, identity labels will be empty",
+			slog.String("error", err.Error()))
+		return
+	}
+
+	c.mu.Lock()
+	for _, info := range devices {
+		c.devices[info.Index] = info
+	}
+	c.mu.Unlock()
+}
+
+// sampleDevices reads device-level metrics for every GPU in the inventory
+// GPUs that fail to report keep no entry, so stale values are never exported
+func (c *Collector) sampleDevices() {
+	for gpuID := range c.GetDevices() {
+		metrics, err := c.backend.GetDeviceMetrics(gpuID)
+
+		c.mu.Lock()
+		if err != nil {
+			delete(c.deviceMetrics, gpuID)
+		} else {
+			c.deviceMetrics[gpuID] = metrics
+		}
+		c.mu.Unlock()
+
+		if err != nil {
+			slog.Debug("Failed to get device metrics",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+// GetDeviceMetrics returns the latest device-level metrics keyed by GPU ID
+func (c *Collector) GetDeviceMetrics() map[uint]*dcgm.DeviceMetrics {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	metrics := make(map[uint]*dcgm.DeviceMetrics, len(c.deviceMetrics))
+	for gpuID, dm := range c.deviceMetrics {
+		dmCopy := *dm
+		metrics[gpuID] = &dmCopy
+	}
+
+	return metrics
+}
+
+// GetDevices returns the GPU inventory keyed by GPU ID
+func (c *Collector) GetDevices() map[uint]process.DeviceInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	devices := make(map[uint]process.DeviceInfo, len(c.devices))
+	for gpuID, info := range c.devices {
+		devices[gpuID] = info
+	}
+
+	return devices
+}
+
+// GetMetrics returns current metrics snapshot keyed by (PID, GPU)
+func (c *Collector) GetMetrics() map[ProcessKey]*ProcessMetrics {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	// Return a copy to avoid concurrent access issues
-	metrics := make(map[uint]*ProcessMetrics, len(c.processMetrics))
-	for pid, pm := range c.processMetrics {
+	metrics := make(map[ProcessKey]*ProcessMetrics, len(c.processMetrics))
+	for key, pm := range c.processMetrics {
 		pmCopy := *pm
-		metrics[pid] = &pmCopy
+		metrics[key] = &pmCopy
 	}
 
 	return metrics
 }
 
-// Shutdown cleans up resources
+// Shutdown stops the sampling loop and cleans up resources
+// Safe to call more than once
 func (c *Collector) Shutdown() error {
-	slog.Info("Shutting down collector")
+	c.shutdownOnce.Do(func() {
+		slog.Info("Shutting down collector")
 
-	if c.dcgmClient != nil {
-		c.dcgmClient.Shutdown()
-	}
+		// Stop sampling before releasing the backend it uses
+		if c.stopCh != nil {
+			close(c.stopCh)
+		}
+		c.wg.Wait()
 
-	if c.discovery != nil {
-		c.discovery.Shutdown()
-	}
+		c.saveIdleCalibration(true)
+
+		if c.podMapper != nil {
+			c.podMapper.Stop()
+		}
+
+		if c.backend != nil {
+			c.backend.Shutdown()
+		}
+	})
 
 	return nil
 }
@@ -5,39 +5,40 @@ import (
 	"time"
 
 	"github.com/vimalk78/my-gpu-exporter/pkg/config"
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
 	"github.com/vimalk78/my-gpu-exporter/pkg/process"
 )
 
 // TestCollector_RetentionCleanup tests that metrics are properly cleaned up after retention expires
 func TestCollector_RetentionCleanup(t *testing.T) {
 	// Create collector with 200ms retention
-	retention := process.NewRetentionManager(200 * time.Millisecond)
+	retention := process.NewRetention[ProcessKey](200 * time.Millisecond)
 
 	collector := &Collector{
 		config:          &config.Config{},
 		retention:       retention,
-		processMetrics:  make(map[uint]*ProcessMetrics),
+		processMetrics:  make(map[ProcessKey]*ProcessMetrics),
 	}
 
 	// Add some metrics for "exited" processes
-	pid1 := uint(1000)
-	pid2 := uint(2000)
-	pid3 := uint(3000)
+	pid1 := ProcessKey{PID: 1000}
+	pid2 := ProcessKey{PID: 2000}
+	pid3 := ProcessKey{PID: 3000}
 
 	collector.processMetrics[pid1] = &ProcessMetrics{
-		PID:          pid1,
+		PID:          pid1.PID,
 		ProcessName:  "test1",
 		EnergyJoules: 100,
 		IsRunning:    false,
 	}
 	collector.processMetrics[pid2] = &ProcessMetrics{
-		PID:          pid2,
+		PID:          pid2.PID,
 		ProcessName:  "test2",
 		EnergyJoules: 200,
 		IsRunning:    false,
 	}
 	collector.processMetrics[pid3] = &ProcessMetrics{
-		PID:          pid3,
+		PID:          pid3.PID,
 		ProcessName:  "test3",
 		EnergyJoules: 300,
 		IsRunning:    true, // This one is still running
@@ -86,18 +87,18 @@ func TestCollector_RetentionCleanup(t *testing.T) {
 
 // TestCollector_PartialRetentionCleanup tests that only expired processes are removed
 func TestCollector_PartialRetentionCleanup(t *testing.T) {
-	retention := process.NewRetentionManager(300 * time.Millisecond)
+	retention := process.NewRetention[ProcessKey](300 * time.Millisecond)
 
 	collector := &Collector{
 		config:          &config.Config{},
 		retention:       retention,
-		processMetrics:  make(map[uint]*ProcessMetrics),
+		processMetrics:  make(map[ProcessKey]*ProcessMetrics),
 	}
 
 	// Add first process
-	pid1 := uint(1000)
+	pid1 := ProcessKey{PID: 1000}
 	collector.processMetrics[pid1] = &ProcessMetrics{
-		PID:          pid1,
+		PID:          pid1.PID,
 		ProcessName:  "old",
 		EnergyJoules: 100,
 		IsRunning:    false,
@@ -108,9 +109,9 @@ func TestCollector_PartialRetentionCleanup(t *testing.T) {
 	time.Sleep(150 * time.Millisecond)
 
 	// Add second process (should not expire yet)
-	pid2 := uint(2000)
+	pid2 := ProcessKey{PID: 2000}
 	collector.processMetrics[pid2] = &ProcessMetrics{
-		PID:          pid2,
+		PID:          pid2.PID,
 		ProcessName:  "new",
 		EnergyJoules: 200,
 		IsRunning:    false,
@@ -147,18 +148,18 @@ func TestCollector_PartialRetentionCleanup(t *testing.T) {
 
 // TestCollector_ZeroRetention tests immediate cleanup with zero retention
 func TestCollector_ZeroRetention(t *testing.T) {
-	retention := process.NewRetentionManager(0)
+	retention := process.NewRetention[ProcessKey](0)
 
 	collector := &Collector{
 		config:          &config.Config{},
 		retention:       retention,
-		processMetrics:  make(map[uint]*ProcessMetrics),
+		processMetrics:  make(map[ProcessKey]*ProcessMetrics),
 	}
 
 	// Add exited process
-	pid := uint(1000)
+	pid := ProcessKey{PID: 1000}
 	collector.processMetrics[pid] = &ProcessMetrics{
-		PID:          pid,
+		PID:          pid.PID,
 		ProcessName:  "test",
 		EnergyJoules: 100,
 		IsRunning:    false,
@@ -184,27 +185,27 @@ func TestCollector_ZeroRetention(t *testing.T) {
 
 // TestCollector_GetMetrics tests that GetMetrics returns correct snapshot
 func TestCollector_GetMetrics(t *testing.T) {
-	retention := process.NewRetentionManager(5 * time.Minute)
+	retention := process.NewRetention[ProcessKey](5 * time.Minute)
 
 	collector := &Collector{
 		config:          &config.Config{},
 		retention:       retention,
-		processMetrics:  make(map[uint]*ProcessMetrics),
+		processMetrics:  make(map[ProcessKey]*ProcessMetrics),
 	}
 
 	// Add metrics
-	pid1 := uint(1000)
-	pid2 := uint(2000)
+	pid1 := ProcessKey{PID: 1000}
+	pid2 := ProcessKey{PID: 2000}
 
 	collector.processMetrics[pid1] = &ProcessMetrics{
-		PID:          pid1,
+		PID:          pid1.PID,
 		ProcessName:  "running",
 		EnergyJoules: 100,
 		IsRunning:    true,
 	}
 
 	collector.processMetrics[pid2] = &ProcessMetrics{
-		PID:          pid2,
+		PID:          pid2.PID,
 		ProcessName:  "exited",
 		EnergyJoules: 200,
 		IsRunning:    false,
@@ -234,3 +235,72 @@ func TestCollector_GetMetrics(t *testing.T) {
 		t.Error("Modifying returned metrics should not affect collector's internal state")
 	}
 }
+
+// TestCollector_ProcessReturns tests that a process which stops using a GPU and
+// uses it again is no longer exited, so retention does not remove it while it runs,
+// and that a new process reusing the PID starts a fresh entry
+func TestCollector_ProcessReturns(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	c.config.MetricRetention = 50 * time.Millisecond
+	c.retention = process.NewRetention[ProcessKey](c.config.MetricRetention)
+	fake.SetPower(0, 100)
+
+	key := ProcessKey{PID: 100}
+	started := time.Unix(1700000000, 0)
+	run := func(start time.Time, energy float64) {
+		fake.SetProcess(
+			process.ProcessInfo{PID: 100, GPU: 0, MemoryUsed: 1024},
+			&dcgm.ProcessMetrics{PID: 100, GPU: 0, EnergyConsumed: energy, SmUtilization: 0.5, IsRunning: true, StartTime: start},
+		)
+		if err := c.Collect(); err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+	}
+	exit := func() {
+		fake.RemoveProcess(100)
+		if err := c.Collect(); err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+		if !c.retention.IsExited(key) {
+			t.Fatal("Expected process to be marked exited")
+		}
+	}
+
+	writeFakeCgroup(t, procRoot, 100, "pod-100", "container100")
+	run(started, 1000)
+	exit()
+	run(started, 1500)
+	if c.retention.IsExited(key) {
+		t.Error("Expected process running again to be unmarked")
+	}
+
+	// Well past the retention period, still running
+	time.Sleep(2 * c.config.MetricRetention)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	pm, ok := c.GetMetrics()[key]
+	if !ok || !pm.IsRunning {
+		t.Fatalf("Expected running process to be kept, got %+v", pm)
+	}
+	if pm.EnergyJoules != 1500 {
+		t.Errorf("Expected energy to continue at 1500J, got %f", pm.EnergyJoules)
+	}
+
+	// The PID is reused by a new process within the retention period
+	exit()
+	writeFakeCgroup(t, procRoot, 100, "pod-reused", "container-reused")
+	run(started.Add(time.Minute), 200)
+	if c.retention.IsExited(key) {
+		t.Error("Expected the new process to be unmarked")
+	}
+
+	pm = c.GetMetrics()[key]
+	if pm.ContainerID != "container-reused" {
+		t.Errorf("Expected the new process's container, got %q", pm.ContainerID)
+	}
+	if pm.EnergyJoules != 200 {
+		t.Errorf("Expected the new process's own 200J, not the previous process's energy, got %f", pm.EnergyJoules)
+	}
+}
@@ -0,0 +1,1321 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/backend"
+	"github.com/vimalk78/my-gpu-exporter/pkg/config"
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// writeFakeCgroup creates <procRoot>/<pid>/cgroup so the process looks like a pod container
+func writeFakeCgroup(t *testing.T, procRoot string, pid uint, podUID, containerID string) {
+	t.Helper()
+
+	dir := filepath.Join(procRoot, fmt.Sprintf("%d", pid))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to create fake proc dir: %v", err)
+	}
+
+	line := fmt.Sprintf("0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod%s.slice/cri-containerd-%s.scope\n",
+		strings.ReplaceAll(podUID, "-", "_"), containerID)
+	if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(line), 0o644); err != nil {
+		t.Fatalf("failed to write fake cgroup: %v", err)
+	}
+}
+
+// writeFakeProcessName creates /proc/<pid>/comm under the fake proc root
+func writeFakeProcessName(t *testing.T, procRoot string, pid uint, name string) {
+	t.Helper()
+
+	dir := filepath.Join(procRoot, fmt.Sprintf("%d", pid))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to create fake proc dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "comm"), []byte(name+"\n"), 0o644); err != nil {
+		t.Fatalf("failed to write fake comm: %v", err)
+	}
+}
+
+// newTestCollector creates a collector over a fake backend with a fake /proc
+func newTestCollector(t *testing.T) (*Collector, *backend.Fake, string) {
+	t.Helper()
+
+	procRoot := t.TempDir()
+	t.Setenv("PROC_ROOT", procRoot)
+
+	cfg := config.NewConfig()
+	cfg.KubernetesEnabled = false
+	cfg.DCGMUpdateFrequency = 1 * time.Second
+	cfg.IdlePowerStateFile = filepath.Join(t.TempDir(), "idle-power.json")
+
+	fake := backend.NewFake()
+	c, err := NewCollectorWithBackend(cfg, fake)
+	if err != nil {
+		t.Fatalf("NewCollectorWithBackend failed: %v", err)
+	}
+
+	return c, fake, procRoot
+}
+
+// addFakeProcess registers a containerized process on the fake backend
+func addFakeProcess(t *testing.T, fake *backend.Fake, procRoot string, pid, gpu uint, smUtil, energy float64) {
+	t.Helper()
+
+	writeFakeCgroup(t, procRoot, pid, fmt.Sprintf("pod-%d", pid), fmt.Sprintf("container%d", pid))
+	fake.SetProcess(
+		process.ProcessInfo{PID: pid, GPU: gpu, MemoryUsed: 1024},
+		&dcgm.ProcessMetrics{
+			PID:            pid,
+			GPU:            gpu,
+			ProcessName:    fmt.Sprintf("proc%d", pid),
+			EnergyConsumed: energy,
+			SmUtilization:  smUtil,
+			IsRunning:      true,
+		},
+	)
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// TestCollector_CollectSingleProcess tests that a lone process keeps its measured energy
+func TestCollector_CollectSingleProcess(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 1234)
+	fake.SetPower(0, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	metrics := c.GetMetrics()
+	pm, ok := metrics[ProcessKey{PID: 100}]
+	if !ok {
+		t.Fatal("PID 100 missing from metrics")
+	}
+
+	if pm.EnergyEstimated {
+		t.Error("Single process energy should not be estimated")
+	}
+
+	if pm.EnergyJoules != 1234 {
+		t.Errorf("Expected measured energy 1234, got %f", pm.EnergyJoules)
+	}
+
+	if pm.ContainerID != "container100" {
+		t.Errorf("Expected container ID container100, got %q", pm.ContainerID)
+	}
+
+	if pm.SharingMode != SharingModeExclusive || pm.ContextType != process.ContextCompute {
+		t.Errorf("Expected exclusive compute process, got %q %q", pm.SharingMode, pm.ContextType)
+	}
+}
+
+// TestCollector_DeviceInventory tests that GPU identities are loaded once the backend reports them
+func TestCollector_DeviceInventory(t *testing.T) {
+	c, fake, _ := newTestCollector(t)
+
+	// Inventory unavailable on the first cycle
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if len(c.GetDevices()) != 0 {
+		t.Fatalf("Expected empty inventory, got %v", c.GetDevices())
+	}
+
+	fake.SetDevice(process.DeviceInfo{Index: 1, UUID: "GPU-bbbb", PCIBusID: "00000000:3B:00.0", ModelName: "NVIDIA A100-SXM4-40GB"})
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	info, ok := c.GetDevices()[1]
+	if !ok || info.UUID != "GPU-bbbb" || info.PCIBusID != "00000000:3B:00.0" {
+		t.Errorf("Expected GPU 1 identity to be loaded, got %+v", info)
+	}
+}
+
+// TestCollector_SkipsNonContainerized tests that host processes are not tracked
+func TestCollector_SkipsNonContainerized(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	dir := filepath.Join(procRoot, "200")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte("0::/user.slice/session-1.scope\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake.SetProcess(process.ProcessInfo{PID: 200, GPU: 0}, &dcgm.ProcessMetrics{PID: 200, IsRunning: true})
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	if len(c.GetMetrics()) != 0 {
+		t.Errorf("Expected no metrics for host process, got %d", len(c.GetMetrics()))
+	}
+}
+
+// TestCollector_TimeSlicingEstimation tests SM-proportional energy estimation end to end
+func TestCollector_TimeSlicingEstimation(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	// DCGM reports identical (wrong) energy for time-sliced processes
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.75, 5000)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.25, 5000)
+	fake.SetPower(0, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	metrics := c.GetMetrics()
+
+	// First estimation uses DCGMUpdateFrequency (1s) as the interval: 100W * 1s = 100J
+	// The DCGM values are whole-GPU energy and are not counted
+	if !metrics[ProcessKey{PID: 100}].EnergyEstimated || !metrics[ProcessKey{PID: 101}].EnergyEstimated {
+		t.Fatal("Time-sliced processes should use estimated energy")
+	}
+
+	if got := metrics[ProcessKey{PID: 100}].EnergyJoules; !almostEqual(got, 75) {
+		t.Errorf("Expected PID 100 to get 75J, got %f", got)
+	}
+
+	if got := metrics[ProcessKey{PID: 101}].EnergyJoules; !almostEqual(got, 25) {
+		t.Errorf("Expected PID 101 to get 25J, got %f", got)
+	}
+}
+
+// TestCollector_SeriesIntegration tests that series integration replaces the power
+// reading and the utilization snapshots when the backend has time series
+func TestCollector_SeriesIntegration(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	c.config.EnergyIntegration = config.EnergyIntegrationSeries
+
+	// The snapshots say PID 101 is busier, but over the interval only PID 100 ran
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.25, 5000)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.75, 5000)
+	fake.SetPower(0, 100)
+
+	now := time.Now()
+	constant := func(value float64) []dcgm.Sample {
+		return sampleWaveform(now.Add(-time.Minute), 2*time.Minute, 100*time.Millisecond, func(float64) float64 { return value })
+	}
+	fake.SetSeries(0, &dcgm.GPUSeries{
+		Power:         constant(200),
+		SMUtilization: map[uint][]dcgm.Sample{100: constant(1), 101: constant(0)},
+	})
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// No energy counter: 200W integrated over the 1s first interval
+	metrics := c.GetMetrics()
+	if got := metrics[ProcessKey{PID: 100}].EnergyJoules; !almostEqual(got, 200) {
+		t.Errorf("Expected PID 100 to get 200J, got %f", got)
+	}
+	if got := metrics[ProcessKey{PID: 101}].EnergyJoules; !almostEqual(got, 0) {
+		t.Errorf("Expected PID 101 to get 0J, got %f", got)
+	}
+}
+
+// TestCollector_EstimationDisabled tests that measured values are kept when estimation is off
+func TestCollector_EstimationDisabled(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	c.config.EnableEnergyEstimation = false
+
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.75, 5000)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.25, 5000)
+	fake.SetPower(0, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	for key, pm := range c.GetMetrics() {
+		if pm.EnergyEstimated {
+			t.Errorf("PID %d should not be estimated when estimation is disabled", key.PID)
+		}
+		if pm.EnergyJoules != 5000 {
+			t.Errorf("PID %d: expected DCGM energy 5000, got %f", key.PID, pm.EnergyJoules)
+		}
+	}
+}
+
+// TestCollector_IdlePowerSubtracted tests that idle power is excluded from attribution
+func TestCollector_IdlePowerSubtracted(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	c.config.GPUIdlePower = 20
+
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 0)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.5, 0)
+	fake.SetPower(0, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// (100W - 20W) * 1s split evenly
+	for key, pm := range c.GetMetrics() {
+		if !almostEqual(pm.EnergyJoules, 40) {
+			t.Errorf("PID %d: expected 40J, got %f", key.PID, pm.EnergyJoules)
+		}
+	}
+}
+
+// TestCollector_MultiGPUProcess tests that a process spanning GPUs gets one entry per GPU
+func TestCollector_MultiGPUProcess(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	// PID 100 uses GPU 0 alone and shares GPU 1 with PID 101
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 300)
+	addFakeProcess(t, fake, procRoot, 100, 1, 0.75, 0)
+	addFakeProcess(t, fake, procRoot, 101, 1, 0.25, 0)
+	fake.SetPower(0, 100)
+	fake.SetPower(1, 200)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	metrics := c.GetMetrics()
+	if len(metrics) != 3 {
+		t.Fatalf("Expected 3 (PID, GPU) entries, got %d", len(metrics))
+	}
+
+	gpu0 := metrics[ProcessKey{PID: 100, GPU: 0}]
+	if gpu0.EnergyEstimated || gpu0.EnergyJoules != 300 {
+		t.Errorf("GPU 0: expected measured 300J, got %f (estimated=%v)", gpu0.EnergyJoules, gpu0.EnergyEstimated)
+	}
+
+	// GPU 1 is time-sliced: 200W * 1s split by SM utilization
+	if got := metrics[ProcessKey{PID: 100, GPU: 1}].EnergyJoules; !almostEqual(got, 150) {
+		t.Errorf("GPU 1: expected PID 100 to get 150J, got %f", got)
+	}
+	if got := metrics[ProcessKey{PID: 101, GPU: 1}].EnergyJoules; !almostEqual(got, 50) {
+		t.Errorf("GPU 1: expected PID 101 to get 50J, got %f", got)
+	}
+
+	// Leaving one GPU marks only that entry as exited
+	fake.RemoveProcess(100)
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 400)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	metrics = c.GetMetrics()
+	if !metrics[ProcessKey{PID: 100, GPU: 0}].IsRunning {
+		t.Error("PID 100 on GPU 0 should still be running")
+	}
+	if metrics[ProcessKey{PID: 100, GPU: 1}].IsRunning {
+		t.Error("PID 100 on GPU 1 should be marked exited")
+	}
+}
+
+// addFakeMIGProcess registers a containerized process on a MIG slice of the fake backend
+func addFakeMIGProcess(t *testing.T, fake *backend.Fake, procRoot string, pid, gpu uint, mig *process.MIGInstance, smUtil float64) {
+	t.Helper()
+
+	writeFakeCgroup(t, procRoot, pid, fmt.Sprintf("pod-%d", pid), fmt.Sprintf("container%d", pid))
+	fake.SetProcess(
+		process.ProcessInfo{PID: pid, GPU: gpu, MemoryUsed: 1024, MIG: mig},
+		&dcgm.ProcessMetrics{
+			PID:           pid,
+			GPU:           gpu,
+			ProcessName:   fmt.Sprintf("proc%d", pid),
+			SmUtilization: smUtil,
+			IsRunning:     true,
+		},
+	)
+}
+
+// TestCollector_MIGApportioning tests that GPU energy is split across MIG slices by activity
+func TestCollector_MIGApportioning(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	large := &process.MIGInstance{GPUInstanceID: 1, ComputeInstanceID: 0, Profile: "3g.20gb", SliceFraction: 3.0 / 7}
+	small := &process.MIGInstance{GPUInstanceID: 2, ComputeInstanceID: 0, Profile: "1g.5gb", SliceFraction: 1.0 / 7}
+
+	// Equal slice-relative utilization: the 3-slice instance does 3x the work
+	addFakeMIGProcess(t, fake, procRoot, 100, 0, large, 0.5)
+	addFakeMIGProcess(t, fake, procRoot, 101, 0, small, 0.5)
+	fake.SetPower(0, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	metrics := c.GetMetrics()
+	if got := metrics[ProcessKey{PID: 100}]; !got.EnergyEstimated || !almostEqual(got.EnergyJoules, 75) {
+		t.Errorf("Expected 3g.20gb slice to get estimated 75J, got %f (estimated=%v)", got.EnergyJoules, got.EnergyEstimated)
+	}
+	if got := metrics[ProcessKey{PID: 101}].EnergyJoules; !almostEqual(got, 25) {
+		t.Errorf("Expected 1g.5gb slice to get 25J, got %f", got)
+	}
+	if got := metrics[ProcessKey{PID: 100}].MIG; got == nil || got.Profile != "3g.20gb" {
+		t.Errorf("Expected MIG info to be carried to metrics, got %+v", got)
+	}
+}
+
+// TestCollector_MIGNoUtilization tests slice-size weighting when MIG utilization is unavailable
+func TestCollector_MIGNoUtilization(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	large := &process.MIGInstance{GPUInstanceID: 1, Profile: "4g.20gb", SliceFraction: 4.0 / 7}
+	small := &process.MIGInstance{GPUInstanceID: 2, Profile: "2g.10gb", SliceFraction: 2.0 / 7}
+
+	// Two processes share the large slice
+	addFakeMIGProcess(t, fake, procRoot, 100, 0, large, 0)
+	addFakeMIGProcess(t, fake, procRoot, 101, 0, large, 0)
+	addFakeMIGProcess(t, fake, procRoot, 102, 0, small, 0)
+	fake.SetPower(0, 120)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// 120J split 4:2 between slices, then evenly within the large slice
+	want := map[uint]float64{100: 40, 101: 40, 102: 40}
+	for pid, energy := range want {
+		if got := c.GetMetrics()[ProcessKey{PID: pid}].EnergyJoules; !almostEqual(got, energy) {
+			t.Errorf("PID %d: expected %fJ, got %f", pid, energy, got)
+		}
+	}
+}
+
+// TestCollector_EnergyModels tests choosing the attribution model per node and per GPU model
+func TestCollector_EnergyModels(t *testing.T) {
+	tests := []struct {
+		name         string
+		energyModel  string
+		byModel      map[string]string
+		coefficients config.ModelCoefficients
+		byModelCoeff map[string]config.ModelCoefficients
+		wantModel    string
+		wantPID100   float64
+	}{
+		// PID 100 is compute-bound, PID 101 memory-bound
+		{"sm only", config.EnergyModelSM, nil, config.ModelCoefficients{}, nil, config.EnergyModelSM, 80},
+		{"sm and memory bandwidth", config.EnergyModelWeighted, nil, config.ModelCoefficients{SM: 0.5, Memory: 0.5}, nil, config.EnergyModelWeighted, 50},
+		{"memory footprint", config.EnergyModelWeighted, nil, config.ModelCoefficients{Footprint: 1}, nil, config.EnergyModelWeighted, 25},
+		{"per-model coefficients", config.EnergyModelWeighted, nil, config.ModelCoefficients{SM: 0.5, Memory: 0.5},
+			map[string]config.ModelCoefficients{"T4": {SM: 1}}, config.EnergyModelWeighted, 80},
+		{"per-model attributor", config.EnergyModelSM, map[string]string{"T4": config.EnergyModelEqualShare}, config.ModelCoefficients{}, nil,
+			config.EnergyModelEqualShare, 50},
+		{"other model's attributor ignored", config.EnergyModelSM, map[string]string{"A100": config.EnergyModelEqualShare}, config.ModelCoefficients{}, nil,
+			config.EnergyModelSM, 80},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			procRoot := t.TempDir()
+			t.Setenv("PROC_ROOT", procRoot)
+
+			cfg := config.NewConfig()
+			cfg.KubernetesEnabled = false
+			cfg.IdlePowerStateFile = ""
+			cfg.EnergyModel = tt.energyModel
+			cfg.EnergyModelByModel = tt.byModel
+			cfg.EnergyModelCoefficients = tt.coefficients
+			cfg.EnergyModelCoefficientsByModel = tt.byModelCoeff
+
+			fake := backend.NewFake()
+			c, err := NewCollectorWithBackend(cfg, fake)
+			if err != nil {
+				t.Fatalf("NewCollectorWithBackend failed: %v", err)
+			}
+
+			fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa", ModelName: "Tesla T4"})
+			dm := dcgm.NewDeviceMetrics(0)
+			dm.FBUsedBytes, dm.FBFreeBytes = 4000, 4000
+			fake.SetDeviceMetrics(dm)
+
+			for _, p := range []struct {
+				pid             uint
+				smUtil, memUtil float64
+				memoryUsed      uint64
+			}{
+				{100, 0.8, 0.2, 1000},
+				{101, 0.2, 0.8, 3000},
+			} {
+				writeFakeCgroup(t, procRoot, p.pid, fmt.Sprintf("pod-%d", p.pid), fmt.Sprintf("container%d", p.pid))
+				fake.SetProcess(
+					process.ProcessInfo{PID: p.pid, GPU: 0, MemoryUsed: p.memoryUsed},
+					&dcgm.ProcessMetrics{PID: p.pid, GPU: 0, SmUtilization: p.smUtil, MemUtilization: p.memUtil, IsRunning: true},
+				)
+			}
+			fake.SetPower(0, 100)
+
+			if err := c.Collect(); err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+
+			pm := c.GetMetrics()[ProcessKey{PID: 100}]
+			if !almostEqual(pm.EnergyJoules, tt.wantPID100) {
+				t.Errorf("Expected PID 100 to get %fJ, got %f", tt.wantPID100, pm.EnergyJoules)
+			}
+			if pm.EnergyModel != tt.wantModel {
+				t.Errorf("Expected energy model %q, got %q", tt.wantModel, pm.EnergyModel)
+			}
+		})
+	}
+}
+
+// TestCollector_MPS tests that MPS clients are apportioned with the MPS attribution model
+func TestCollector_MPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		modelMPS   string
+		clients    []uint
+		wantModel  string
+		wantPID100 float64
+	}{
+		// PID 100 is compute-bound, PID 101 memory-bound; weighted is 0.7 SM + 0.3 memory
+		{"weighted by default", config.EnergyModelWeighted, []uint{100, 101}, config.EnergyModelWeighted, 62},
+		{"time-slicing model", "", []uint{100, 101}, config.EnergyModelSM, 80},
+		// A lone client's counter still covers the whole MPS server
+		{"single client", config.EnergyModelWeighted, []uint{100}, config.EnergyModelWeighted, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, fake, procRoot := newTestCollector(t)
+			c.config.EnergyModelMPS = tt.modelMPS
+
+			usage := map[uint][2]float64{100: {0.8, 0.2}, 101: {0.2, 0.8}}
+			for _, pid := range tt.clients {
+				writeFakeCgroup(t, procRoot, pid, fmt.Sprintf("pod-%d", pid), fmt.Sprintf("container%d", pid))
+				fake.SetProcess(
+					process.ProcessInfo{PID: pid, GPU: 0, MPS: true},
+					&dcgm.ProcessMetrics{PID: pid, GPU: 0, SmUtilization: usage[pid][0], MemUtilization: usage[pid][1], EnergyConsumed: 5000, IsRunning: true},
+				)
+			}
+			fake.SetPower(0, 100)
+
+			if err := c.Collect(); err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+
+			pm := c.GetMetrics()[ProcessKey{PID: 100}]
+			if pm.SharingMode != SharingModeMPS {
+				t.Errorf("Expected sharing mode %q, got %q", SharingModeMPS, pm.SharingMode)
+			}
+			if pm.EnergyModel != tt.wantModel {
+				t.Errorf("Expected energy model %q, got %q", tt.wantModel, pm.EnergyModel)
+			}
+			if !almostEqual(pm.EnergyJoules, tt.wantPID100) {
+				t.Errorf("Expected PID 100 to get %fJ, got %f", tt.wantPID100, pm.EnergyJoules)
+			}
+		})
+	}
+}
+
+// TestCollector_EnergyModelFixed tests that a process keeps the energy model it was
+// first given when its GPU turns MPS, so its energy counter stays one series
+func TestCollector_EnergyModelFixed(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	c.config.EnergyModelMPS = config.EnergyModelWeighted
+	fake.SetPower(0, 100)
+
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 0)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.5, 0)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// An MPS client joins, so the GPU is now shared through MPS
+	writeFakeCgroup(t, procRoot, 102, "pod-102", "container102")
+	fake.SetProcess(
+		process.ProcessInfo{PID: 102, GPU: 0, MPS: true},
+		&dcgm.ProcessMetrics{PID: 102, GPU: 0, SmUtilization: 0.5, IsRunning: true},
+	)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	metrics := c.GetMetrics()
+	for pid, want := range map[uint]string{100: config.EnergyModelSM, 101: config.EnergyModelSM, 102: config.EnergyModelWeighted} {
+		pm := metrics[ProcessKey{PID: pid}]
+		if pm.SharingMode != SharingModeMPS {
+			t.Errorf("PID %d: expected sharing mode %q, got %q", pid, SharingModeMPS, pm.SharingMode)
+		}
+		if pm.EnergyModel != want {
+			t.Errorf("PID %d: expected energy model %q, got %q", pid, want, pm.EnergyModel)
+		}
+	}
+}
+
+// TestCollector_GraphicsProcesses tests that graphics processes share GPU energy with compute ones
+func TestCollector_GraphicsProcesses(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	for _, p := range []struct {
+		pid         uint
+		contextType string
+		smUtil      float64
+	}{
+		{100, process.ContextCompute, 0.6},
+		{101, process.ContextGraphics, 0.3},
+		{102, process.ContextMixed, 0.1},
+	} {
+		writeFakeCgroup(t, procRoot, p.pid, fmt.Sprintf("pod-%d", p.pid), fmt.Sprintf("container%d", p.pid))
+		fake.SetProcess(
+			process.ProcessInfo{PID: p.pid, GPU: 0, ContextType: p.contextType},
+			&dcgm.ProcessMetrics{PID: p.pid, GPU: 0, SmUtilization: p.smUtil, IsRunning: true},
+		)
+	}
+	fake.SetPower(0, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	metrics := c.GetMetrics()
+	for pid, want := range map[uint]struct {
+		contextType string
+		energy      float64
+	}{
+		100: {process.ContextCompute, 60},
+		101: {process.ContextGraphics, 30},
+		102: {process.ContextMixed, 10},
+	} {
+		pm := metrics[ProcessKey{PID: pid}]
+		if pm == nil {
+			t.Fatalf("PID %d missing from metrics", pid)
+		}
+		if pm.ContextType != want.contextType {
+			t.Errorf("PID %d: expected context type %q, got %q", pid, want.contextType, pm.ContextType)
+		}
+		if pm.SharingMode != SharingModeTimeSlicing {
+			t.Errorf("PID %d: expected sharing mode %q, got %q", pid, SharingModeTimeSlicing, pm.SharingMode)
+		}
+		if !almostEqual(pm.EnergyJoules, want.energy) {
+			t.Errorf("PID %d: expected %fJ, got %f", pid, want.energy, pm.EnergyJoules)
+		}
+	}
+}
+
+// TestCollector_SameContainerProcesses tests that processes of one container are not treated as time-slicing
+func TestCollector_SameContainerProcesses(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	c.config.GPUIdlePower = 20
+
+	for pid, smUtil := range map[uint]float64{100: 0.75, 101: 0.25} {
+		writeFakeCgroup(t, procRoot, pid, "pod-1", "container1")
+		fake.SetProcess(
+			process.ProcessInfo{PID: pid, GPU: 0},
+			&dcgm.ProcessMetrics{PID: pid, GPU: 0, SmUtilization: smUtil, EnergyConsumed: 5000, IsRunning: true},
+		)
+	}
+	fake.SetPower(0, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// The container owns the GPU, idle baseline included
+	metrics := c.GetMetrics()
+	for pid, want := range map[uint]float64{100: 75, 101: 25} {
+		pm := metrics[ProcessKey{PID: pid}]
+		if pm.SharingMode != SharingModeExclusive {
+			t.Errorf("PID %d: expected sharing mode %q, got %q", pid, SharingModeExclusive, pm.SharingMode)
+		}
+		if !almostEqual(pm.EnergyJoules, want) {
+			t.Errorf("PID %d: expected %fJ, got %f", pid, want, pm.EnergyJoules)
+		}
+	}
+
+	account := c.GetEnergyAccounts()[0]
+	if account.IdleJoules != 0 || !almostEqual(account.AttributedJoules, 100) {
+		t.Errorf("Expected all 100J attributed, got %+v", account)
+	}
+}
+
+// TestCollector_GPUSharing tests sharing detection from NVML modes, the device plugin config and the MPS daemon
+func TestCollector_GPUSharing(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	pluginConfig := filepath.Join(t.TempDir(), "config.yaml")
+	config := "sharing:\n  timeSlicing:\n    resources:\n    - name: nvidia.com/gpu\n      replicas: 4\n      devices: [\"0\"]\n"
+	if err := os.WriteFile(pluginConfig, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c.config.DevicePluginConfig = pluginConfig
+
+	for gpu, uuid := range []string{"GPU-aaaa", "GPU-bbbb", "GPU-cccc"} {
+		fake.SetDevice(process.DeviceInfo{Index: uint(gpu), UUID: uuid})
+	}
+	fake.SetDeviceModes(0, process.DeviceModes{ComputeMode: process.ComputeModeDefault})
+	fake.SetDeviceModes(1, process.DeviceModes{ComputeMode: process.ComputeModeExclusiveProcess})
+	fake.SetDeviceModes(2, process.DeviceModes{MIGEnabled: true})
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	sharing := c.GetGPUSharing()
+	expected := map[uint]GPUSharing{
+		0: {Mode: SharingModeTimeSlicing, ComputeMode: process.ComputeModeDefault, TimeSlicingReplicas: 4},
+		1: {Mode: SharingModeExclusive, ComputeMode: process.ComputeModeExclusiveProcess},
+		2: {Mode: SharingModeMIG, MIGEnabled: true},
+	}
+	for gpuID, want := range expected {
+		if sharing[gpuID] != want {
+			t.Errorf("GPU %d: expected %+v, got %+v", gpuID, want, sharing[gpuID])
+		}
+	}
+
+	// Without a device plugin config an MPS daemon makes every non-MIG GPU an MPS GPU,
+	// so even a lone process is apportioned rather than measured
+	c.config.DevicePluginConfig = ""
+	writeFakeProcessName(t, procRoot, 50, process.MPSControlName)
+	addFakeProcess(t, fake, procRoot, 100, 1, 0.5, 5000)
+	fake.SetPower(1, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	if s := c.GetGPUSharing()[1]; s.Mode != SharingModeMPS || !s.MPSDaemon {
+		t.Errorf("Expected MPS GPU with daemon, got %+v", s)
+	}
+	pm := c.GetMetrics()[ProcessKey{PID: 100, GPU: 1}]
+	if pm.SharingMode != SharingModeMPS || !pm.EnergyEstimated {
+		t.Errorf("Expected estimated energy on MPS GPU, got mode %q estimated %v", pm.SharingMode, pm.EnergyEstimated)
+	}
+}
+
+// TestCollector_UnknownEnergyModel tests that unknown attribution models are rejected
+func TestCollector_UnknownEnergyModel(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.KubernetesEnabled = false
+	cfg.EnergyModelByModel = map[string]string{"T4": "fairest"}
+
+	if _, err := NewCollectorWithBackend(cfg, backend.NewFake()); err == nil {
+		t.Fatal("Expected error for unknown energy model")
+	}
+}
+
+// TestCollector_EnergyAccounting tests that idle + attributed + unattributed equals device energy
+func TestCollector_EnergyAccounting(t *testing.T) {
+	tests := []struct {
+		name             string
+		idleAttribution  string
+		smUtil           [2]float64
+		wantIdle         float64
+		wantAttributed   float64
+		wantUnattributed float64
+		wantPID100       float64
+	}{
+		{"idle kept per GPU", config.IdleAttributionNone, [2]float64{0.75, 0.25}, 20, 80, 0, 60},
+		{"idle spread proportionally", config.IdleAttributionProportional, [2]float64{0.75, 0.25}, 0, 100, 0, 75},
+		{"idle spread by time share", config.IdleAttributionTimeShare, [2]float64{0.75, 0.25}, 0, 100, 0, 70},
+		{"no utilization", config.IdleAttributionNone, [2]float64{0, 0}, 20, 0, 80, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, fake, procRoot := newTestCollector(t)
+			c.config.GPUIdlePower = 20
+			c.config.IdleEnergyAttribution = tt.idleAttribution
+
+			addFakeProcess(t, fake, procRoot, 100, 0, tt.smUtil[0], 0)
+			addFakeProcess(t, fake, procRoot, 101, 0, tt.smUtil[1], 0)
+			fake.SetPower(0, 100)
+
+			if err := c.Collect(); err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+
+			account := c.GetEnergyAccounts()[0]
+			if !almostEqual(account.IdleJoules, tt.wantIdle) {
+				t.Errorf("Expected idle %fJ, got %f", tt.wantIdle, account.IdleJoules)
+			}
+			if !almostEqual(account.AttributedJoules, tt.wantAttributed) {
+				t.Errorf("Expected attributed %fJ, got %f", tt.wantAttributed, account.AttributedJoules)
+			}
+			if !almostEqual(account.UnattributedJoules, tt.wantUnattributed) {
+				t.Errorf("Expected unattributed %fJ, got %f", tt.wantUnattributed, account.UnattributedJoules)
+			}
+			if got := c.GetMetrics()[ProcessKey{PID: 100}].EnergyJoules; !almostEqual(got, tt.wantPID100) {
+				t.Errorf("Expected PID 100 to get %fJ, got %f", tt.wantPID100, got)
+			}
+		})
+	}
+}
+
+// TestCollector_IdleGPUEnergy tests that GPUs without processes accrue idle energy
+func TestCollector_IdleGPUEnergy(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa"})
+	fake.SetDevice(process.DeviceInfo{Index: 1, UUID: "GPU-bbbb"})
+	fake.SetTotalEnergy(0, 1000)
+	fake.SetTotalEnergy(1, 5000)
+	fake.SetPower(0, 50)
+	fake.SetPower(1, 300)
+	addFakeProcess(t, fake, procRoot, 100, 1, 0.5, 300)
+
+	// First cycle falls back to power x 1s
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// The process counter only received 220J of the GPU's 250J
+	fake.SetTotalEnergy(0, 1040)
+	fake.SetTotalEnergy(1, 5250)
+	addFakeProcess(t, fake, procRoot, 100, 1, 0.5, 520)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	accounts := c.GetEnergyAccounts()
+	if got := accounts[0]; !almostEqual(got.IdleJoules, 50+40) || got.AttributedJoules != 0 {
+		t.Errorf("GPU 0: expected 90J idle and nothing attributed, got %+v", got)
+	}
+
+	// A lone process owns the whole GPU, but only what its counter received is attributed
+	if got := accounts[1]; got.IdleJoules != 0 || !almostEqual(got.AttributedJoules, 300+220) || !almostEqual(got.UnattributedJoules, 30) {
+		t.Errorf("GPU 1: expected 520J attributed and 30J unattributed, got %+v", got)
+	}
+	if got := c.GetMetrics()[ProcessKey{PID: 100, GPU: 1}].EnergyJoules; !almostEqual(got, accounts[1].AttributedJoules) {
+		t.Errorf("GPU 1: expected attributed energy to match the process counter %fJ, got %+v", got, accounts[1])
+	}
+}
+
+// idleDeviceMetrics returns device metrics for an idle GPU
+func idleDeviceMetrics(gpu uint) *dcgm.DeviceMetrics {
+	dm := dcgm.NewDeviceMetrics(gpu)
+	dm.GPUUtilization = 0
+	return dm
+}
+
+// TestCollector_IdlePowerCalibration tests learning, persisting and overriding idle power
+func TestCollector_IdlePowerCalibration(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	c.config.GPUIdlePower = 5
+
+	fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa", ModelName: "Tesla T4"})
+	fake.SetDeviceMetrics(idleDeviceMetrics(0))
+	c.loadDevices()
+	c.sampleDevices()
+
+	// Not calibrated yet: configured value is used
+	if got := c.GetIdlePower()[0]; got.Source != IdlePowerSourceConfigured || got.Watts != 5 {
+		t.Errorf("Expected configured 5W before calibration, got %+v", got)
+	}
+
+	// Idle samples: mostly 10W with a few bursts
+	for i := 0; i < idleMinSamples; i++ {
+		power := 10.0
+		if i%10 == 0 {
+			power = 40
+		}
+		fake.SetPower(0, power)
+		c.detectAndValidateTimeSlicing()
+	}
+
+	got := c.GetIdlePower()[0]
+	if got.Source != IdlePowerSourceCalibrated || !almostEqual(got.Watts, 10) {
+		t.Errorf("Expected calibrated 10W, got %+v", got)
+	}
+
+	// Busy GPUs are not sampled even without processes
+	busy := idleDeviceMetrics(0)
+	busy.GPUUtilization = 0.9
+	fake.SetDeviceMetrics(busy)
+	fake.SetPower(0, 70)
+	for i := 0; i < idleMinSamples*2; i++ {
+		c.sampleDevices()
+		c.detectAndValidateTimeSlicing()
+	}
+	if got := c.GetIdlePower()[0]; !almostEqual(got.Watts, 10) {
+		t.Errorf("Busy samples should not change calibration, got %+v", got)
+	}
+
+	// Calibrated idle power is subtracted before attribution
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 0)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.5, 0)
+	fake.SetPower(0, 50)
+	before := c.GetEnergyAccounts()[0]
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	after := c.GetEnergyAccounts()[0]
+	idle := after.IdleJoules - before.IdleJoules
+	attributed := after.AttributedJoules - before.AttributedJoules
+	if idle <= 0 || !almostEqual(attributed/idle, 4) {
+		t.Errorf("Expected 50W split 10W idle / 40W attributed, got idle %fJ attributed %fJ", idle, attributed)
+	}
+
+	// Calibration survives a restart
+	c.Shutdown()
+	restarted, err := NewCollectorWithBackend(c.config, fake)
+	if err != nil {
+		t.Fatalf("NewCollectorWithBackend failed: %v", err)
+	}
+	restarted.loadDevices()
+	if got := restarted.GetIdlePower()[0]; got.Source != IdlePowerSourceCalibrated || !almostEqual(got.Watts, 10) {
+		t.Errorf("Expected calibrated 10W after restart, got %+v", got)
+	}
+
+	// Per-model override wins; the longest matching key is used
+	restarted.config.GPUIdlePowerByModel = map[string]float64{"T4": 12, "Tesla T4": 14}
+	if got := restarted.GetIdlePower()[0]; got.Source != IdlePowerSourceOverride || got.Watts != 14 {
+		t.Errorf("Expected override 14W, got %+v", got)
+	}
+}
+
+// TestCollector_ProcessExit tests that a process disappearing from discovery is marked exited
+func TestCollector_ProcessExit(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 10)
+	fake.SetPower(0, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	fake.RemoveProcess(100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	pm, ok := c.GetMetrics()[ProcessKey{PID: 100}]
+	if !ok {
+		t.Fatal("Exited process should be retained")
+	}
+
+	if pm.IsRunning {
+		t.Error("Exited process should not be running")
+	}
+
+	if !c.retention.IsExited(ProcessKey{PID: 100}) {
+		t.Error("Exited process should be tracked by retention manager")
+	}
+}
+
+// TestCollector_SampleTracksShortProcesses tests that sampling picks up processes started
+// and exited between scans, and completes exited ones from accounting records
+func TestCollector_SampleTracksShortProcesses(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	fake.SetPower(0, 100)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// Started after the scan
+	start := time.Unix(1700000000, 0)
+	writeFakeCgroup(t, procRoot, 100, "pod-100", "container100")
+	fake.SetProcess(
+		process.ProcessInfo{PID: 100, GPU: 0},
+		&dcgm.ProcessMetrics{PID: 100, GPU: 0, EnergyConsumed: 1000, SmUtilization: 0.5, StartTime: start, IsRunning: true},
+	)
+	c.sample()
+
+	pm, ok := c.GetMetrics()[ProcessKey{PID: 100}]
+	if !ok || !pm.IsRunning || pm.EnergyJoules != 1000 {
+		t.Fatalf("Expected running process with 1000J after sampling, got %+v", pm)
+	}
+
+	// Exited before the next scan; the driver kept its final counter
+	end := start.Add(5 * time.Second)
+	fake.RemoveProcess(100)
+	fake.SetAccountingRecord(&dcgm.ProcessMetrics{PID: 100, GPU: 0, EnergyConsumed: 1300, StartTime: start, EndTime: end})
+	c.sample()
+
+	pm = c.GetMetrics()[ProcessKey{PID: 100}]
+	if pm.IsRunning {
+		t.Error("Expected process to be marked exited by sampling")
+	}
+	if !pm.EndTime.Equal(end) {
+		t.Errorf("Expected end time %v from accounting record, got %v", end, pm.EndTime)
+	}
+	if pm.EnergyJoules != 1300 || pm.MeasuredEnergyJoules != 1300 {
+		t.Errorf("Expected final measured energy 1300J, got %f (measured %f)", pm.EnergyJoules, pm.MeasuredEnergyJoules)
+	}
+
+}
+
+// TestCollector_UnseenShortProcesses tests that processes which start and exit between
+// two ticks, known only from accounting records, are exported as exited and keep
+// their energy out of the running processes' share, and that records whose
+// container cannot be resolved are dropped
+func TestCollector_UnseenShortProcesses(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa"})
+	fake.SetPower(0, 100)
+	fake.SetTotalEnergy(0, 1000)
+
+	// Records present before the first listing predate the exporter
+	fake.SetAccountingRecord(&dcgm.ProcessMetrics{PID: 50, GPU: 0, EnergyConsumed: 999})
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// Alone on the GPU: the record's energy is measured and its container still resolvable
+	start := time.Unix(1700000000, 0)
+	writeFakeCgroup(t, procRoot, 200, "pod-200", "container200")
+	fake.SetAccountingRecord(&dcgm.ProcessMetrics{PID: 200, GPU: 0, EnergyConsumed: 40, StartTime: start, EndTime: start.Add(3 * time.Second)})
+	fake.SetTotalEnergy(0, 1100)
+	before := c.GetEnergyAccounts()[0]
+	c.sample()
+
+	metrics := c.GetMetrics()
+	if _, ok := metrics[ProcessKey{PID: 50}]; ok {
+		t.Error("Expected records older than the exporter to be ignored")
+	}
+	pm, ok := metrics[ProcessKey{PID: 200}]
+	if !ok {
+		t.Fatal("Expected a process known only from its accounting record")
+	}
+	if pm.IsRunning || !c.retention.IsExited(ProcessKey{PID: 200}) {
+		t.Error("Expected the process to be exited")
+	}
+	if pm.ContainerID != "container200" || !pm.EndTime.Equal(start.Add(3*time.Second)) {
+		t.Errorf("Expected container200 ending at the record's end time, got %q %v", pm.ContainerID, pm.EndTime)
+	}
+	if pm.EnergyJoules != 40 || pm.MeasuredEnergyJoules != 40 {
+		t.Errorf("Expected the record's 40J as measured energy, got %f (measured %f)", pm.EnergyJoules, pm.MeasuredEnergyJoules)
+	}
+	account := c.GetEnergyAccounts()[0]
+	if attributed, idle := account.AttributedJoules-before.AttributedJoules, account.IdleJoules-before.IdleJoules; !almostEqual(attributed, 40) || !almostEqual(idle, 60) {
+		t.Errorf("Expected 40J attributed and 60J idle, got %fJ and %fJ", attributed, idle)
+	}
+
+	// Not counted again on the next tick
+	fake.SetTotalEnergy(0, 1200)
+	c.sample()
+	if got := c.GetMetrics()[ProcessKey{PID: 200}].EnergyJoules; got != 40 {
+		t.Errorf("Expected 40J after another tick, got %f", got)
+	}
+
+	// Exited and already gone from /proc: its container cannot be resolved, so it
+	// may not be a container's process at all
+	fake.SetAccountingRecord(&dcgm.ProcessMetrics{PID: 202, GPU: 0, EnergyConsumed: 30, StartTime: start, EndTime: start.Add(time.Second)})
+	fake.SetTotalEnergy(0, 1250)
+	c.sample()
+	if _, ok := c.GetMetrics()[ProcessKey{PID: 202}]; ok {
+		t.Error("Expected a record whose container cannot be resolved to be dropped")
+	}
+
+	// Alongside a running process: the record covers the whole GPU, so the
+	// interval is shared by activity instead of going to the running process.
+	// It is listed while running, and its container is resolved then: /proc
+	// no longer has it once it exits.
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 0)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	writeFakeCgroup(t, procRoot, 201, "pod-201", "container201")
+	fake.SetAccountingRecord(&dcgm.ProcessMetrics{PID: 201, GPU: 0, IsRunning: true, StartTime: start})
+	fake.SetTotalEnergy(0, 1300)
+	c.sample()
+	if _, ok := c.GetMetrics()[ProcessKey{PID: 201}]; ok {
+		t.Fatal("Expected a running record to wait until it exits")
+	}
+
+	if err := os.RemoveAll(filepath.Join(procRoot, "201")); err != nil {
+		t.Fatalf("failed to remove fake proc dir: %v", err)
+	}
+	fake.SetAccountingRecord(&dcgm.ProcessMetrics{PID: 201, GPU: 0, EnergyConsumed: 500, SmUtilization: 0.5, StartTime: start, EndTime: start.Add(time.Second)})
+	fake.SetTotalEnergy(0, 1400)
+	c.sample()
+
+	metrics = c.GetMetrics()
+	unseen, ok := metrics[ProcessKey{PID: 201}]
+	if !ok {
+		t.Fatal("Expected PID 201 from its accounting record")
+	}
+	if unseen.ContainerID != "container201" {
+		t.Errorf("Expected the container resolved while it ran, got %q", unseen.ContainerID)
+	}
+	if !almostEqual(unseen.EnergyJoules, 50) || !almostEqual(metrics[ProcessKey{PID: 100}].EstimatedEnergyJoules, 50) {
+		t.Errorf("Expected 100J split 50/50, got %f for PID 201 and %f for PID 100",
+			unseen.EnergyJoules, metrics[ProcessKey{PID: 100}].EstimatedEnergyJoules)
+	}
+}
+
+// TestCollector_EnergyCounterDeltas tests that estimation uses hardware energy counter deltas
+func TestCollector_EnergyCounterDeltas(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.75, 0)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.25, 0)
+	fake.SetPower(0, 100)
+	fake.SetTotalEnergy(0, 1000)
+
+	// First cycle has no counter baseline: 100W * 1s = 100J
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// Second cycle: counter advanced 300J regardless of instantaneous power
+	fake.SetPower(0, 5)
+	fake.SetTotalEnergy(0, 1300)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	metrics := c.GetMetrics()
+	if !almostEqual(metrics[ProcessKey{PID: 100}].EnergyJoules, 75+225) {
+		t.Errorf("Expected PID 100 to have 300J, got %f", metrics[ProcessKey{PID: 100}].EnergyJoules)
+	}
+	if !almostEqual(metrics[ProcessKey{PID: 101}].EnergyJoules, 25+75) {
+		t.Errorf("Expected PID 101 to have 100J, got %f", metrics[ProcessKey{PID: 101}].EnergyJoules)
+	}
+}
+
+// TestCollector_EnergyCounterReset tests that a counter reset does not produce negative energy
+func TestCollector_EnergyCounterReset(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 0)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.5, 0)
+	fake.SetPower(0, 0)
+	fake.SetTotalEnergy(0, 1000)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// Driver reload: counter restarts near zero, power fallback contributes 0W
+	fake.SetTotalEnergy(0, 50)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	for key, pm := range c.GetMetrics() {
+		if pm.EnergyJoules != 0 {
+			t.Errorf("PID %d: expected no energy across counter reset, got %f", key.PID, pm.EnergyJoules)
+		}
+	}
+
+	// Next cycle resumes from the new baseline
+	fake.SetTotalEnergy(0, 150)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	for key, pm := range c.GetMetrics() {
+		if !almostEqual(pm.EnergyJoules, 50) {
+			t.Errorf("PID %d: expected 50J after reset, got %f", key.PID, pm.EnergyJoules)
+		}
+	}
+}
+
+// TestCollector_EnergyLedger tests that energy stays continuous across exclusive and shared use
+func TestCollector_EnergyLedger(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	fake.SetPower(0, 0)
+	fake.SetTotalEnergy(0, 0)
+
+	pid100 := ProcessKey{PID: 100}
+	check := func(step string, wantMeasured, wantEstimated float64) {
+		t.Helper()
+		pm := c.GetMetrics()[pid100]
+		if !almostEqual(pm.MeasuredEnergyJoules, wantMeasured) || !almostEqual(pm.EstimatedEnergyJoules, wantEstimated) {
+			t.Errorf("%s: expected measured %fJ + estimated %fJ, got %f + %f",
+				step, wantMeasured, wantEstimated, pm.MeasuredEnergyJoules, pm.EstimatedEnergyJoules)
+		}
+		if !almostEqual(pm.EnergyJoules, pm.MeasuredEnergyJoules+pm.EstimatedEnergyJoules) {
+			t.Errorf("%s: total %f does not match sources", step, pm.EnergyJoules)
+		}
+	}
+
+	// Alone: per-process counter is measured energy
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 1000)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	check("exclusive", 1000, 0)
+
+	// PID 101 joins: the new counter delta still belongs to the exclusive scan
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 1200)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.5, 1200)
+	fake.SetTotalEnergy(0, 100)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	check("shared", 1200, 0)
+
+	// Shared scan: counter reports whole-GPU energy and is ignored, 300J split evenly
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 5000)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.5, 5000)
+	fake.SetTotalEnergy(0, 400)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	check("still shared", 1200, 150)
+
+	// PID 101 leaves: the scan that was shared is not measured twice
+	fake.RemoveProcess(101)
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 5100)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	check("exclusive again", 1200, 150)
+
+	// Exclusive scan: measured deltas resume on top of the estimate
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 5150)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	check("measured resumes", 1250, 150)
+}
+
+// TestCollector_Power tests per-process and per-GPU power over the latest interval
+func TestCollector_Power(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	c.config.GPUIdlePower = 20
+
+	// GPU 0 is shared, GPU 1 exclusive
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.75, 0)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.25, 0)
+	addFakeProcess(t, fake, procRoot, 102, 1, 0.5, 60)
+	fake.SetPower(0, 100)
+	fake.SetPower(1, 60)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	// Shared GPU: (100W - 20W idle) split 3:1; exclusive GPU: all of it
+	want := map[ProcessKey]float64{{PID: 100}: 60, {PID: 101}: 20, {PID: 102, GPU: 1}: 60}
+	metrics := c.GetMetrics()
+	for key, watts := range want {
+		if got := metrics[key].PowerWatts; !almostEqual(got, watts) {
+			t.Errorf("PID %d: expected %fW, got %f", key.PID, watts, got)
+		}
+	}
+
+	power := c.GetGPUPower()
+	if got := power[0]; !almostEqual(got.MeasuredWatts, 100) || !almostEqual(got.AttributedWatts, 80) {
+		t.Errorf("GPU 0: expected 100W measured, 80W attributed, got %+v", got)
+	}
+	if got := power[1]; !almostEqual(got.MeasuredWatts, 60) || !almostEqual(got.AttributedWatts, 60) {
+		t.Errorf("GPU 1: expected 60W measured and attributed, got %+v", got)
+	}
+
+	// Exited processes draw nothing
+	fake.RemoveProcess(101)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if got := c.GetMetrics()[ProcessKey{PID: 101}].PowerWatts; got != 0 {
+		t.Errorf("Expected exited process to report 0W, got %f", got)
+	}
+}
+
+// TestCollector_AttributionAccuracy tests comparing attributed with measured GPU energy
+func TestCollector_AttributionAccuracy(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.75, 0)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.25, 0)
+	fake.SetTotalEnergy(0, 1000)
+
+	// First scan only sets the baseline
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if _, ok := c.GetAttributionAccuracy()[0]; ok {
+		t.Fatal("Expected no accuracy check before a full window")
+	}
+
+	// All 300J attributed
+	fake.SetTotalEnergy(0, 1300)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if got := c.GetAttributionAccuracy()[0]; got.Count != 1 || !almostEqual(got.ResidualJoules, 0) || got.Exceeded != 0 {
+		t.Errorf("Expected an exact window, got %+v", got)
+	}
+
+	// No utilization: 200J cannot be attributed
+	addFakeProcess(t, fake, procRoot, 100, 0, 0, 0)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0, 0)
+	fake.SetTotalEnergy(0, 1500)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	got := c.GetAttributionAccuracy()[0]
+	if got.Count != 2 || !almostEqual(got.ResidualJoules, 200) || !almostEqual(got.RelativeError, 1) {
+		t.Errorf("Expected 200J residual (100%%), got %+v", got)
+	}
+	if got.Exceeded != 1 {
+		t.Errorf("Expected threshold to be exceeded once, got %d", got.Exceeded)
+	}
+	if got.Buckets[0.01] != 1 || got.Buckets[1] != 2 {
+		t.Errorf("Unexpected histogram buckets: %v", got.Buckets)
+	}
+
+	// A process exits: counters and device energy cover different spans, window skipped
+	fake.RemoveProcess(101)
+	fake.SetTotalEnergy(0, 1600)
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if got := c.GetAttributionAccuracy()[0]; got.Count != 2 {
+		t.Errorf("Expected window with an exited process to be skipped, got %d checks", got.Count)
+	}
+}
+
+// TestCollector_StartShutdown tests that the sampling loop collects on its own and stops cleanly
+func TestCollector_StartShutdown(t *testing.T) {
+	c, fake, procRoot := newTestCollector(t)
+	c.config.ProcessScanInterval = 20 * time.Millisecond
+	c.config.DCGMUpdateFrequency = 5 * time.Millisecond
+
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 0)
+	addFakeProcess(t, fake, procRoot, 101, 0, 0.5, 0)
+	fake.SetPower(0, 100)
+
+	c.Start()
+
+	// Energy should keep growing between scans without anyone calling Collect
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if pm, ok := c.GetMetrics()[ProcessKey{PID: 100}]; ok && pm.EnergyJoules > 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Sampling loop did not estimate energy in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Shutdown()
+		c.Shutdown() // idempotent
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not stop the sampling loop")
+	}
+
+	// No more updates after shutdown
+	before := c.GetMetrics()[ProcessKey{PID: 100}].EnergyJoules
+	time.Sleep(30 * time.Millisecond)
+	if after := c.GetMetrics()[ProcessKey{PID: 100}].EnergyJoules; after != before {
+		t.Errorf("Energy changed after shutdown: %f -> %f", before, after)
+	}
+}
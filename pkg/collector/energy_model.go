@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/attribution"
+	"github.com/vimalk78/my-gpu-exporter/pkg/config"
+)
+
+// EnergyModelMeasured is reported as the energy model when estimation is disabled
+// and per-process counters are used as they are
+const EnergyModelMeasured = "measured"
+
+// newAttributors creates the node's attributor and every per-GPU-model attributor
+func newAttributors(cfg *config.Config) (map[string]attribution.Attributor, error) {
+	attributors := make(map[string]attribution.Attributor)
+
+	names := []string{cfg.EnergyModel}
+	if cfg.EnergyModelMPS != "" {
+		names = append(names, cfg.EnergyModelMPS)
+	}
+	for _, name := range cfg.EnergyModelByModel {
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		if _, ok := attributors[name]; ok {
+			continue
+		}
+
+		attributor, err := attribution.New(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		attributors[name] = attributor
+	}
+
+	return attributors, nil
+}
+
+// attributorFor returns the attributor for a GPU, shared through MPS if mps is set
+// Concurrent MPS clients use --energy-model-mps; otherwise a per-GPU-model choice
+// wins over the node's --energy-model
+// Must be called with c.mu held
+func (c *Collector) attributorFor(gpuID uint, mps bool) attribution.Attributor {
+	if mps && c.config.EnergyModelMPS != "" {
+		return c.attributors[c.config.EnergyModelMPS]
+	}
+
+	model := c.devices[gpuID].ModelName
+	if name, ok := config.MatchModel(c.config.EnergyModelByModel, model); ok && model != "" {
+		return c.attributors[name]
+	}
+
+	return c.attributors[c.config.EnergyModel]
+}
+
+// energyModelName returns the name of the attribution model used for a process's GPU when it is shared
+// Whether the GPU is shared through MPS can depend on the processes running on it
+// at the time, so the name may change while a process runs; the collector keeps
+// the name a process was first given
+// Must be called with c.mu held
+func (c *Collector) energyModelName(gpuID uint, mps bool) string {
+	if !c.config.EnableEnergyEstimation {
+		return EnergyModelMeasured
+	}
+	return c.attributorFor(gpuID, mps).Name()
+}
+
+// attribute shares a GPU's active interval energy between its processes
+// idleWatts is the baseline already removed from activeEnergy; with time series
+// the interval is attributed per sub-interval (see attributeSeries)
+// Must be called with c.mu held
+func (c *Collector) attribute(attributor attribution.Attributor, gpuID uint, processes []*ProcessMetrics, interval gpuEnergyInterval, activeEnergy, idleWatts float64) []float64 {
+	if interval.Series != nil {
+		if shares, ok := c.attributeSeries(attributor, gpuID, processes, interval, activeEnergy, idleWatts); ok {
+			return shares
+		}
+	}
+
+	in := c.attributionInterval(gpuID, activeEnergy, interval.Seconds, interval.End)
+
+	activities := make([]attribution.Activity, len(processes))
+	for i, pm := range processes {
+		activities[i] = activity(pm, in)
+	}
+
+	return c.attributeActivities(attributor, in, activities)
+}
+
+// attributionInterval describes part of a GPU's energy for an attributor
+// Must be called with c.mu held
+func (c *Collector) attributionInterval(gpuID uint, joules, seconds float64, end time.Time) attribution.Interval {
+	in := attribution.Interval{
+		GPU:          gpuID,
+		ModelName:    c.devices[gpuID].ModelName,
+		Joules:       joules,
+		Seconds:      seconds,
+		End:          end,
+		FBTotalBytes: math.NaN(),
+	}
+	if dm := c.deviceMetrics[gpuID]; dm != nil {
+		in.FBTotalBytes = dm.FBUsedBytes + dm.FBFreeBytes
+	}
+
+	return in
+}
+
+// activity is a process's latest activity snapshot within an interval
+func activity(pm *ProcessMetrics, in attribution.Interval) attribution.Activity {
+	return attribution.Activity{
+		PID:             pm.PID,
+		SMUtilization:   pm.SmUtilization,
+		MemUtilization:  pm.MemUtilization,
+		MemoryUsedBytes: pm.MemoryUsedBytes,
+		ActiveSeconds:   activeSeconds(pm, in),
+		MIG:             pm.MIG,
+	}
+}
+
+// attributeActivities runs an attributor over one interval
+// Shares that break the Attributor contract are discarded, leaving the energy unattributed
+func (c *Collector) attributeActivities(attributor attribution.Attributor, in attribution.Interval, activities []attribution.Activity) []float64 {
+	shares := attributor.Attribute(in, activities)
+	if err := validateShares(shares, len(activities), in.Joules); err != nil {
+		slog.Warn("Discarding invalid energy attribution",
+			slog.Uint64("gpu", uint64(in.GPU)),
+			slog.String("energy_model", attributor.Name()),
+			slog.String("error", err.Error()))
+		return make([]float64, len(activities))
+	}
+
+	return shares
+}
+
+// validateShares checks attributor output against the Attributor contract
+func validateShares(shares []float64, processes int, activeEnergy float64) error {
+	if len(shares) != processes {
+		return fmt.Errorf("got %d shares for %d processes", len(shares), processes)
+	}
+
+	var total float64
+	for _, share := range shares {
+		if share < 0 || math.IsNaN(share) || math.IsInf(share, 0) {
+			return fmt.Errorf("invalid share %f", share)
+		}
+		total += share
+	}
+
+	// Allow for floating point rounding
+	if total > activeEnergy*(1+1e-9)+1e-9 {
+		return fmt.Errorf("shares total %fJ exceeds %fJ of active energy", total, activeEnergy)
+	}
+
+	return nil
+}
+
+// activeSeconds returns how long a process existed within an interval
+// Processes without a known start time are assumed present for the whole interval
+func activeSeconds(pm *ProcessMetrics, in attribution.Interval) float64 {
+	start, end := in.Start(), in.End
+	if in.End.IsZero() {
+		return in.Seconds
+	}
+
+	if !pm.StartTime.IsZero() && pm.StartTime.Unix() > 0 && pm.StartTime.After(start) {
+		start = pm.StartTime
+	}
+	if !pm.IsRunning && pm.EndTime.Unix() > 0 && pm.EndTime.Before(end) {
+		end = pm.EndTime
+	}
+
+	if !end.After(start) {
+		return 0
+	}
+	return math.Min(end.Sub(start).Seconds(), in.Seconds)
+}
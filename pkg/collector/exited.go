@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/attribution"
+	"github.com/vimalk78/my-gpu-exporter/pkg/backend"
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+	"github.com/vimalk78/my-gpu-exporter/pkg/kubernetes"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// unseenExited tracks processes that started and exited on a GPU between two ticks
+// They never show up in discovery, only in the driver's accounting records.
+// A process that had the GPU to itself gets the energy of its record (its time
+// share of the interval if the record has none), booked by bookExited. Others
+// ran alongside running processes or each other, so their records cover the
+// whole GPU; they are returned to share the interval's energy with the running
+// processes instead.
+// Their container is resolved through /proc while they run, or when their exited
+// record is first listed; records whose container cannot be resolved are dropped,
+// so non-containerized processes stay excluded.
+// Must be called with c.mu held
+func (c *Collector) unseenExited(gpuID uint, running []*ProcessMetrics, interval gpuEnergyInterval) []*ProcessMetrics {
+	pids, err := c.backend.GetAccountingPIDs(gpuID)
+	if err != nil {
+		if !errors.Is(err, backend.ErrNotSupported) {
+			slog.Debug("Failed to list accounting records",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.String("error", err.Error()))
+		}
+		return nil
+	}
+
+	// The first listing only records what was there before the exporter looked
+	previous, listed := c.accountingPIDs[gpuID]
+	handled := make(map[uint]bool, len(pids))
+	listedNow := make(map[uint]bool, len(pids))
+
+	var exited []*ProcessMetrics
+	records := make(map[*ProcessMetrics]*dcgm.ProcessMetrics)
+	for _, pid := range pids {
+		listedNow[pid] = true
+		key := ProcessKey{PID: pid, GPU: gpuID}
+		if _, tracked := c.processMetrics[key]; !listed || previous[pid] || tracked {
+			handled[pid] = true
+			continue
+		}
+
+		record, err := c.backend.GetAccountingRecord(pid, gpuID)
+		if err != nil {
+			slog.Debug("Failed to get accounting record",
+				slog.Uint64("pid", uint64(pid)),
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.String("error", err.Error()))
+			continue
+		}
+
+		// Still running: discovery picks it up, or a later listing finds it exited.
+		// Its container is resolved now, as /proc forgets it once it exits
+		container, resolved := c.unseenContainers[key]
+		if !resolved {
+			container, resolved = c.resolveUnseenContainer(pid)
+		}
+		if record != nil && record.IsRunning {
+			if resolved {
+				c.unseenContainers[key] = container
+			}
+			continue
+		}
+		handled[pid] = true
+		if record == nil {
+			continue
+		}
+		if !resolved {
+			slog.Debug("Dropping accounting record of a process whose container cannot be resolved",
+				slog.Uint64("pid", uint64(pid)),
+				slog.Uint64("gpu", uint64(gpuID)))
+			continue
+		}
+
+		pm := c.exitedFromRecord(key, record, container)
+		exited = append(exited, pm)
+		records[pm] = record
+	}
+	c.accountingPIDs[gpuID] = handled
+
+	for key := range c.unseenContainers {
+		if key.GPU == gpuID && (handled[key.PID] || !listedNow[key.PID]) {
+			delete(c.unseenContainers, key)
+		}
+	}
+
+	if len(exited) == 0 {
+		return nil
+	}
+
+	c.accuracyWindow(gpuID).missed = true
+
+	participants := append(append([]*ProcessMetrics{}, running...), exited...)
+	mode := c.gpuSharingMode(gpuID, participants)
+	for _, pm := range exited {
+		pm.SharingMode = mode
+		pm.EnergyModel = c.energyModelName(gpuID, mode == SharingModeMPS)
+	}
+
+	if len(running) > 0 || len(exited) > 1 {
+		return exited
+	}
+
+	pm := exited[0]
+	if energy := records[pm].EnergyConsumed; energy > 0 {
+		pm.recordCounter(energy, false, interval.End)
+	} else if interval.Seconds > 0 {
+		in := attribution.Interval{Seconds: interval.Seconds, End: interval.End}
+		share := interval.Joules * activeSeconds(pm, in) / interval.Seconds
+		pm.addEstimate(share)
+		pm.ledger.unbooked += share
+	}
+
+	return nil
+}
+
+// unseenContainer is the container of a process known only from accounting records
+type unseenContainer struct {
+	ContainerID string
+	PodUID      string
+	Pod         *kubernetes.PodInfo // nil if not known when resolved
+}
+
+// resolveUnseenContainer resolves the container of a process through /proc
+// Returns false once the process is gone from /proc, or if it is not containerized
+// Must be called with c.mu held
+func (c *Collector) resolveUnseenContainer(pid uint) (unseenContainer, bool) {
+	containerID, err := process.GetContainerID(pid)
+	if err != nil || containerID == "" {
+		return unseenContainer{}, false
+	}
+
+	container := unseenContainer{ContainerID: containerID}
+	container.PodUID, _ = process.GetPodUID(pid)
+	if container.PodUID != "" && c.podMapper != nil {
+		container.Pod, _ = c.podMapper.GetPodInfoByContainer(container.PodUID, containerID)
+	}
+	return container, true
+}
+
+// exitedFromRecord creates the metrics of a process known only from its accounting record
+// Must be called with c.mu held
+func (c *Collector) exitedFromRecord(key ProcessKey, record *dcgm.ProcessMetrics, container unseenContainer) *ProcessMetrics {
+	pm := &ProcessMetrics{
+		PID:             key.PID,
+		GPU:             key.GPU,
+		ProcessName:     record.ProcessName,
+		SmUtilization:   record.SmUtilization,
+		MemUtilization:  record.MemUtilization,
+		MemoryUsedBytes: record.MemoryUsedBytes,
+		StartTime:       record.StartTime,
+		EndTime:         record.EndTime,
+		ContainerID:     container.ContainerID,
+		ContextType:     process.ContextCompute,
+	}
+
+	// The pod may have been seen by the watch only after the process was resolved
+	info := container.Pod
+	if info == nil && container.PodUID != "" && c.podMapper != nil {
+		info, _ = c.podMapper.GetPodInfoByContainer(container.PodUID, container.ContainerID)
+	}
+	if info != nil {
+		pm.PodName = info.PodName
+		pm.PodNamespace = info.PodNamespace
+		pm.ContainerName = info.ContainerName
+		pm.PodLabels, pm.PodAnnotations = c.podMapper.GetPodMetadata(container.PodUID)
+	}
+
+	c.processMetrics[key] = pm
+	c.retention.MarkExited(key)
+
+	slog.Info("Process exited before it was discovered, tracked from its accounting record",
+		slog.Uint64("pid", uint64(key.PID)),
+		slog.Uint64("gpu", uint64(key.GPU)),
+		slog.String("pod", pm.PodName),
+		slog.Time("start", pm.StartTime),
+		slog.Time("end", pm.EndTime))
+
+	return pm
+}
+
+// bookExited books energy that exited processes received outside of attribution
+// (final accounting records, processes that exited unseen) ahead of the running
+// processes, capped at the interval's energy
+// Returns the part of the interval left for the running processes and the booked energy
+// Must be called with c.mu held
+func (c *Collector) bookExited(gpuID uint, interval gpuEnergyInterval) (gpuEnergyInterval, float64) {
+	var booked float64
+	for _, pm := range c.processMetrics {
+		if pm.IsRunning || pm.GPU != gpuID || pm.ledger.unbooked <= 0 {
+			continue
+		}
+
+		joules := math.Min(pm.ledger.unbooked, interval.Joules-booked)
+		pm.ledger.unbooked = 0
+		booked += joules
+	}
+
+	interval.Joules -= booked
+	return interval, booked
+}
@@ -0,0 +1,190 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// idleUtilizationThreshold is the GPU utilization at or below which a GPU
+	// without processes is considered idle
+	idleUtilizationThreshold = 0.05
+
+	// idlePercentile is the low percentile of idle power samples used as the baseline
+	// A low percentile ignores short bursts (driver housekeeping, clock ramp-down)
+	idlePercentile = 0.10
+
+	// idleMinSamples is the number of samples needed before a baseline is used
+	idleMinSamples = 30
+
+	// idleMaxSamples bounds the rolling window of samples kept per GPU
+	idleMaxSamples = 1000
+
+	// idleSaveInterval limits how often calibration state is written to disk
+	idleSaveInterval = 1 * time.Minute
+)
+
+// Idle power sources, reported in the source label of the idle power metric
+const (
+	IdlePowerSourceOverride   = "override"   // Per-model override from configuration
+	IdlePowerSourceCalibrated = "calibrated" // Learned from idle periods
+	IdlePowerSourceConfigured = "configured" // --gpu-idle-power fallback
+)
+
+// IdlePower is the idle power baseline in use for a GPU
+type IdlePower struct {
+	Watts  float64
+	Source string
+}
+
+// idleCalibrator learns each GPU's idle power from samples taken while it has no processes
+// Samples are keyed by GPU UUID so they survive reboots and index changes
+type idleCalibrator struct {
+	path string // State file, empty to disable persistence
+
+	mu       sync.Mutex
+	samples  map[string][]float64 // GPU UUID -> recent idle power samples (W), oldest first
+	dirty    bool
+	lastSave time.Time
+}
+
+// idleState is the on-disk format of calibration state
+type idleState struct {
+	GPUs map[string]idleGPUState `json:"gpus"`
+}
+
+type idleGPUState struct {
+	Model   string    `json:"model,omitempty"`
+	Samples []float64 `json:"samples"`
+}
+
+// newIdleCalibrator creates a calibrator, loading previous samples from path if it exists
+func newIdleCalibrator(path string) *idleCalibrator {
+	ic := &idleCalibrator{
+		path:    path,
+		samples: make(map[string][]float64),
+	}
+
+	if path == "" {
+		return ic
+	}
+
+	if err := ic.load(); err != nil {
+		slog.Warn("Failed to load idle power calibration, starting fresh",
+			slog.String("path", path),
+			slog.String("error", err.Error()))
+	}
+
+	return ic
+}
+
+// load reads calibration state from disk
+func (ic *idleCalibrator) load() error {
+	data, err := os.ReadFile(ic.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state idleState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", ic.path, err)
+	}
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	for uuid, gpu := range state.GPUs {
+		samples := gpu.Samples
+		if len(samples) > idleMaxSamples {
+			samples = samples[len(samples)-idleMaxSamples:]
+		}
+		ic.samples[uuid] = samples
+	}
+
+	slog.Info("Loaded idle power calibration",
+		slog.String("path", ic.path),
+		slog.Int("gpus", len(state.GPUs)))
+
+	return nil
+}
+
+// observe records an idle power sample for a GPU
+func (ic *idleCalibrator) observe(uuid string, watts float64) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	samples := append(ic.samples[uuid], watts)
+	if len(samples) > idleMaxSamples {
+		samples = samples[len(samples)-idleMaxSamples:]
+	}
+	ic.samples[uuid] = samples
+	ic.dirty = true
+}
+
+// baseline returns the learned idle power for a GPU, or false if not enough samples yet
+func (ic *idleCalibrator) baseline(uuid string) (float64, bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	samples := ic.samples[uuid]
+	if len(samples) < idleMinSamples {
+		return 0, false
+	}
+
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	return sorted[int(idlePercentile*float64(len(sorted)-1))], true
+}
+
+// save writes calibration state to disk if it changed
+// Unless force is set, writes happen at most every idleSaveInterval
+func (ic *idleCalibrator) save(models map[string]string, force bool) error {
+	if ic.path == "" {
+		return nil
+	}
+
+	ic.mu.Lock()
+	if !ic.dirty || (!force && time.Since(ic.lastSave) < idleSaveInterval) {
+		ic.mu.Unlock()
+		return nil
+	}
+
+	state := idleState{GPUs: make(map[string]idleGPUState, len(ic.samples))}
+	for uuid, samples := range ic.samples {
+		state.GPUs[uuid] = idleGPUState{Model: models[uuid], Samples: samples}
+	}
+	data, err := json.Marshal(state)
+	ic.dirty = false
+	ic.lastSave = time.Now()
+	ic.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to encode idle power calibration: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ic.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// Write to a temp file and rename so a crash never leaves a truncated file
+	tmp := ic.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write idle power calibration: %w", err)
+	}
+	if err := os.Rename(tmp, ic.path); err != nil {
+		return fmt.Errorf("failed to write idle power calibration: %w", err)
+	}
+
+	return nil
+}
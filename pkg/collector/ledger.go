@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Energy sources, reported in the source label of the per-source energy metric
+const (
+	EnergySourceMeasured  = "measured"  // Per-process hardware counter while the GPU was exclusive
+	EnergySourceEstimated = "estimated" // Attributed share of GPU energy while the GPU was shared
+)
+
+// energyLedger tracks the per-process counter between scans
+//
+// A process's energy is accumulated from whichever source is valid for each
+// interval, so EnergyJoules never jumps or goes backwards when its GPU switches
+// between exclusive and shared use. The per-process counter is read once per
+// scan; its delta is only kept if the GPU was exclusive for the whole scan
+// (not shared when the scan started, and no estimation during it), since while
+// a GPU is shared the counter reports energy of the whole GPU and estimation
+// covers those intervals instead.
+type energyLedger struct {
+	lastCounter float64 // Per-process counter at the previous scan (J)
+	hasCounter  bool
+	shared      bool // Estimated since the previous scan
+	sharedAt    bool // GPU was shared at the previous scan
+
+	readAt time.Time // When the counter was last read
+	kept   bool      // Whether the last counter delta was added as measured energy
+
+	unbooked float64 // Energy added outside attribution, not yet booked as attributed GPU energy (see bookMeasured, bookExited)
+}
+
+// recordCounter adds the per-process counter delta since the previous scan
+// sharedNow reports whether the GPU is shared at this scan. On first sight the
+// whole counter is kept unless the GPU is already shared, in which case it only
+// becomes the baseline for later deltas
+func (pm *ProcessMetrics) recordCounter(counter float64, sharedNow bool, now time.Time) {
+	l := &pm.ledger
+	l.kept = false
+
+	switch {
+	case !l.hasCounter:
+		if !sharedNow {
+			pm.MeasuredEnergyJoules += counter
+			l.unbooked += counter
+			l.kept = true
+		}
+	case l.shared || l.sharedAt:
+		// Covered by estimation
+	case counter >= l.lastCounter:
+		pm.MeasuredEnergyJoules += counter - l.lastCounter
+		l.unbooked += counter - l.lastCounter
+		l.kept = true
+	default:
+		slog.Debug("Process energy counter went backwards, ignoring interval",
+			slog.Uint64("pid", uint64(pm.PID)),
+			slog.Float64("previous_J", l.lastCounter),
+			slog.Float64("current_J", counter))
+	}
+
+	l.lastCounter = counter
+	l.hasCounter = true
+	l.readAt = now
+	l.sharedAt = sharedNow
+	l.shared = false
+	pm.EnergyJoules = pm.MeasuredEnergyJoules + pm.EstimatedEnergyJoules
+}
+
+// measuredThrough reports whether the last measured counter reading covers time t
+func (pm *ProcessMetrics) measuredThrough(t time.Time) bool {
+	return pm.ledger.kept && pm.ledger.readAt.After(t)
+}
+
+// addEstimate adds an estimated share for a shared interval
+func (pm *ProcessMetrics) addEstimate(joules float64) {
+	pm.ledger.shared = true
+	pm.EstimatedEnergyJoules += joules
+	pm.EnergyJoules = pm.MeasuredEnergyJoules + pm.EstimatedEnergyJoules
+	if joules > 0 {
+		pm.EnergyEstimated = true
+	}
+}
+
+// carryEnergy continues the ledger of a process seen in an earlier scan
+func (pm *ProcessMetrics) carryEnergy(previous *ProcessMetrics) {
+	pm.MeasuredEnergyJoules = previous.MeasuredEnergyJoules
+	pm.EstimatedEnergyJoules = previous.EstimatedEnergyJoules
+	pm.EnergyJoules = previous.EnergyJoules
+	pm.EnergyEstimated = previous.EnergyEstimated
+	pm.EnergyModel = previous.EnergyModel
+	pm.PowerWatts = previous.PowerWatts
+	pm.ledger = previous.ledger
+}
+
+// setPower sets the process's power from the joules it was attributed in an interval
+func (pm *ProcessMetrics) setPower(joules float64, interval gpuEnergyInterval) {
+	if interval.Seconds > 0 {
+		pm.PowerWatts = joules / interval.Seconds
+	}
+}
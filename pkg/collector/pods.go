@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"log/slog"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/kubernetes"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// GPUAllocation is a GPU or MIG device the kubelet allocated to a pod container
+type GPUAllocation struct {
+	kubernetes.Allocation
+	GPU      uint // Index of the GPU, or of the MIG device's parent GPU
+	GPUKnown bool // False if the device is not in the inventory (e.g. a MIG device no process was seen on)
+}
+
+// processDeviceUUID returns the UUID of the GPU or MIG device a process runs on
+func processDeviceUUID(proc process.ProcessInfo, devices map[uint]process.DeviceInfo) string {
+	if proc.MIG != nil && proc.MIG.UUID != "" {
+		return proc.MIG.UUID
+	}
+	return devices[proc.GPU].UUID
+}
+
+// resolvePods maps containers to pods through the kubelet's GPU allocations, keyed
+// by container ID, and refreshes the allocations exported per GPU
+func (c *Collector) resolvePods(refs map[string]*kubernetes.ContainerRef, processes []process.ProcessInfo) map[string]*kubernetes.PodInfo {
+	if c.podMapper == nil {
+		return nil
+	}
+
+	containers := make([]kubernetes.ContainerRef, 0, len(refs))
+	for _, ref := range refs {
+		containers = append(containers, *ref)
+	}
+
+	resolved, err := c.podMapper.Resolve(containers)
+	if err != nil {
+		slog.Debug("Failed to resolve containers through pod resources",
+			slog.String("error", err.Error()))
+	}
+
+	allocations, err := c.podMapper.Allocations()
+	if err != nil {
+		slog.Debug("Failed to list GPU allocations",
+			slog.String("error", err.Error()))
+		return resolved
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// MIG devices are not in the inventory; their parents are learned from processes
+	for _, proc := range processes {
+		if proc.MIG != nil && proc.MIG.UUID != "" {
+			c.migParents[proc.MIG.UUID] = proc.GPU
+		}
+	}
+
+	gpuByUUID := make(map[string]uint, len(c.devices))
+	for gpuID, info := range c.devices {
+		gpuByUUID[info.UUID] = gpuID
+	}
+
+	c.allocations = make([]GPUAllocation, 0, len(allocations))
+	for _, allocation := range allocations {
+		a := GPUAllocation{Allocation: allocation}
+		if gpuID, ok := gpuByUUID[allocation.UUID]; ok {
+			a.GPU, a.GPUKnown = gpuID, true
+		} else if gpuID, ok := c.migParents[allocation.UUID]; ok {
+			a.GPU, a.GPUKnown = gpuID, true
+		}
+		c.allocations = append(c.allocations, a)
+	}
+
+	return resolved
+}
+
+// GetGPUAllocations returns the GPU and MIG devices the kubelet allocated to pod
+// containers, whether or not processes run on them
+func (c *Collector) GetGPUAllocations() []GPUAllocation {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	allocations := make([]GPUAllocation, len(c.allocations))
+	copy(allocations, c.allocations)
+	return allocations
+}
+
+// GetKubernetesAPIStats returns Kubernetes API requests by result, and false if
+// the API server is not used
+func (c *Collector) GetKubernetesAPIStats() (kubernetes.APIStats, bool) {
+	if c.podMapper == nil {
+		return nil, false
+	}
+	return c.podMapper.APIStats()
+}
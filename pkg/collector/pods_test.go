@@ -0,0 +1,217 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/backend"
+	"github.com/vimalk78/my-gpu-exporter/pkg/config"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+	"google.golang.org/grpc"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// fakeKubelet serves a fixed pod-resources List response
+type fakeKubelet struct {
+	podresourcesapi.UnimplementedPodResourcesListerServer
+	response *podresourcesapi.ListPodResourcesResponse
+}
+
+// List implements PodResourcesListerServer
+func (k *fakeKubelet) List(context.Context, *podresourcesapi.ListPodResourcesRequest) (*podresourcesapi.ListPodResourcesResponse, error) {
+	return k.response, nil
+}
+
+// newKubernetesTestCollector creates a collector whose pod mapper talks to a fake kubelet
+// configure, if given, adjusts the configuration before the collector is created
+func newKubernetesTestCollector(t *testing.T, response *podresourcesapi.ListPodResourcesResponse, configure ...func(cfg *config.Config)) (*Collector, *backend.Fake, string) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "kubelet.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on fake kubelet socket: %v", err)
+	}
+	server := grpc.NewServer()
+	podresourcesapi.RegisterPodResourcesListerServer(server, &fakeKubelet{response: response})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	procRoot := t.TempDir()
+	t.Setenv("PROC_ROOT", procRoot)
+
+	cfg := config.NewConfig()
+	cfg.KubernetesEnabled = true
+	cfg.PodResourcesSocket = socket
+	cfg.DCGMUpdateFrequency = 1 * time.Second
+	cfg.IdlePowerStateFile = filepath.Join(t.TempDir(), "idle-power.json")
+	for _, f := range configure {
+		f(cfg)
+	}
+
+	fake := backend.NewFake()
+	c, err := NewCollectorWithBackend(cfg, fake)
+	if err != nil {
+		t.Fatalf("NewCollectorWithBackend failed: %v", err)
+	}
+	t.Cleanup(func() { c.Shutdown() })
+
+	return c, fake, procRoot
+}
+
+// withPodWatch configures a watch of node-1's pods on a fake API server listing pods,
+// the JSON items of a pod list
+func withPodWatch(t *testing.T, pods string) func(cfg *config.Config) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") == "1" {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprintf(w, `{"metadata": {"resourceVersion": "1"}, "items": [%s]}`, pods)
+	}))
+	t.Cleanup(server.Close)
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	err := os.WriteFile(kubeconfig, []byte(fmt.Sprintf(`current-context: test
+contexts: [{name: test, context: {cluster: test, user: test}}]
+clusters: [{name: test, cluster: {server: %s}}]
+users: [{name: test, user: {token: token}}]
+`, server.URL)), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+
+	return func(cfg *config.Config) {
+		cfg.NodeName = "node-1"
+		cfg.Kubeconfig = kubeconfig
+	}
+}
+
+// TestCollector_PodResourcesJoin tests that processes are mapped to pods through the
+// kubelet's device IDs and that allocated GPUs without processes are reported
+func TestCollector_PodResourcesJoin(t *testing.T) {
+	gpuDevices := func(ids ...string) []*podresourcesapi.ContainerDevices {
+		return []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: ids}}
+	}
+
+	c, fake, procRoot := newKubernetesTestCollector(t, &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{Name: "train", Namespace: "ml", Containers: []*podresourcesapi.ContainerResources{
+				{Name: "main", Devices: gpuDevices("GPU-aaaa")},
+			}},
+			{Name: "idle", Namespace: "ml", Containers: []*podresourcesapi.ContainerResources{
+				{Name: "main", Devices: gpuDevices("GPU-bbbb")},
+			}},
+		},
+	})
+
+	fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa"})
+	fake.SetDevice(process.DeviceInfo{Index: 1, UUID: "GPU-bbbb"})
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 1000)
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	pm := c.GetMetrics()[ProcessKey{PID: 100, GPU: 0}]
+	if pm == nil {
+		t.Fatalf("Expected metrics for PID 100")
+	}
+	if pm.PodName != "train" || pm.PodNamespace != "ml" || pm.ContainerName != "main" {
+		t.Errorf("Expected PID 100 in ml/train/main, got %s/%s/%s", pm.PodNamespace, pm.PodName, pm.ContainerName)
+	}
+
+	allocations := c.GetGPUAllocations()
+	if len(allocations) != 2 {
+		t.Fatalf("Expected 2 allocations, got %d", len(allocations))
+	}
+	for _, a := range allocations {
+		if !a.GPUKnown {
+			t.Errorf("Expected %s to map to a GPU", a.DeviceID)
+		}
+		if a.PodName == "idle" && a.GPU != 1 {
+			t.Errorf("Expected the idle pod's allocation on GPU 1, got GPU %d", a.GPU)
+		}
+	}
+}
+
+// TestCollector_PodUIDOverDeviceJoin tests that a container running on a GPU allocated
+// to another pod (e.g. privileged) is mapped to the pod from its cgroup, not the GPU's pod
+func TestCollector_PodUIDOverDeviceJoin(t *testing.T) {
+	c, fake, procRoot := newKubernetesTestCollector(t, &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{Name: "train", Namespace: "ml", Containers: []*podresourcesapi.ContainerResources{
+				{Name: "main", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-aaaa"}}}},
+			}},
+		},
+	}, withPodWatch(t, `
+		{"metadata": {"name": "train", "namespace": "ml", "uid": "pod-train"},
+		 "status": {"containerStatuses": [{"name": "main", "containerID": "containerd://container101"}]}},
+		{"metadata": {"name": "debug", "namespace": "tools", "uid": "pod-100"},
+		 "status": {"containerStatuses": [{"name": "shell", "containerID": "containerd://container100"}]}}`))
+
+	fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa"})
+	addFakeProcess(t, fake, procRoot, 100, 0, 0.5, 1000)
+
+	// Wait until the watch has listed the pods
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if info, _ := c.podMapper.GetPodInfoByContainer("pod-100", "container100"); info != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the pod watch")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	pm := c.GetMetrics()[ProcessKey{PID: 100, GPU: 0}]
+	if pm == nil {
+		t.Fatalf("Expected metrics for PID 100")
+	}
+	if pm.PodName != "debug" || pm.PodNamespace != "tools" || pm.ContainerName != "shell" {
+		t.Errorf("Expected PID 100 in tools/debug/shell, got %s/%s/%s", pm.PodNamespace, pm.PodName, pm.ContainerName)
+	}
+}
+
+// TestNewCollector_PodMetadataLabels tests that pod metadata allowlists mapping to
+// the same metric label, or an unknown target, are rejected
+func TestNewCollector_PodMetadataLabels(t *testing.T) {
+	t.Setenv("PROC_ROOT", t.TempDir())
+
+	tests := map[string]func(cfg *config.Config){
+		"label collision": func(cfg *config.Config) {
+			cfg.PodLabelsAllowlist = []string{"cost-center", "cost_center"}
+		},
+		"unknown target": func(cfg *config.Config) {
+			cfg.PodLabelsAllowlist = []string{"team"}
+			cfg.PodMetadataTarget = "labels"
+		},
+	}
+
+	for name, configure := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.NewConfig()
+			cfg.KubernetesEnabled = false
+			configure(cfg)
+
+			if _, err := NewCollectorWithBackend(cfg, backend.NewFake()); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package collector
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/attribution"
+	"github.com/vimalk78/my-gpu-exporter/pkg/backend"
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+)
+
+// intervalSeries fetches the time series a GPU recorded over an interval, nil if unavailable
+// Samples from up to one interval before the start are included so values at
+// the start can be interpolated
+// Must be called with c.mu held
+func (c *Collector) intervalSeries(gpuID uint, interval gpuEnergyInterval) *dcgm.GPUSeries {
+	since := interval.Start().Add(-time.Duration(interval.Seconds * float64(time.Second)))
+
+	series, err := c.backend.GetValuesSince(gpuID, since)
+	if err != nil {
+		if !errors.Is(err, backend.ErrNotSupported) {
+			slog.Debug("Failed to get GPU time series, using point samples for this interval",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.String("error", err.Error()))
+		}
+		return nil
+	}
+
+	return series
+}
+
+// attributeSeries attributes an interval in sub-intervals of --energy-integration-step
+// Each sub-interval gets the part of the active energy that its integrated power
+// above idle accounts for, shared by the processes' average utilization within it.
+// Bursty kernels are then credited with the power drawn while they ran instead of
+// a utilization snapshot taken when the interval ends. Processes without
+// utilization samples keep their latest utilization.
+// Returns false if the series has no power above idle to weigh sub-intervals with
+// Must be called with c.mu held
+func (c *Collector) attributeSeries(attributor attribution.Attributor, gpuID uint, processes []*ProcessMetrics, interval gpuEnergyInterval, activeEnergy, idleWatts float64) ([]float64, bool) {
+	series := interval.Series
+	start, end := interval.Start(), interval.End
+	if len(series.Power) == 0 || !end.After(start) {
+		return nil, false
+	}
+
+	type subInterval struct {
+		start, end time.Time
+		weight     float64 // Active joules by the power series
+	}
+
+	var subs []subInterval
+	var total float64
+	for from := start; from.Before(end); {
+		to := from.Add(c.config.EnergyIntegrationStep)
+		if to.After(end) {
+			to = end
+		}
+
+		weight := math.Max(integrate(series.Power, from, to)-idleWatts*to.Sub(from).Seconds(), 0)
+		subs = append(subs, subInterval{start: from, end: to, weight: weight})
+		total += weight
+		from = to
+	}
+	if total == 0 {
+		return nil, false
+	}
+
+	shares := make([]float64, len(processes))
+	activities := make([]attribution.Activity, len(processes))
+	for _, sub := range subs {
+		if sub.weight == 0 {
+			continue
+		}
+
+		in := c.attributionInterval(gpuID, activeEnergy*sub.weight/total, sub.end.Sub(sub.start).Seconds(), sub.end)
+		for i, pm := range processes {
+			activities[i] = activity(pm, in)
+			activities[i].SMUtilization = average(series.SMUtilization[pm.PID], sub.start, sub.end, pm.SmUtilization)
+			activities[i].MemUtilization = average(series.MemUtilization[pm.PID], sub.start, sub.end, pm.MemUtilization)
+		}
+
+		for i, share := range c.attributeActivities(attributor, in, activities) {
+			shares[i] += share
+		}
+	}
+
+	return shares, true
+}
+
+// interpolate returns a series' value at t, linear between the samples around it
+// and held at the first and last samples beyond the ends of the series
+func interpolate(samples []dcgm.Sample, t time.Time) float64 {
+	i := sort.Search(len(samples), func(i int) bool {
+		return !samples[i].Time.Before(t)
+	})
+
+	switch i {
+	case 0:
+		return samples[0].Value
+	case len(samples):
+		return samples[len(samples)-1].Value
+	}
+
+	prev, next := samples[i-1], samples[i]
+	span := next.Time.Sub(prev.Time).Seconds()
+	if span <= 0 {
+		return next.Value
+	}
+
+	return prev.Value + (next.Value-prev.Value)*t.Sub(prev.Time).Seconds()/span
+}
+
+// integrate returns the area under a series between from and to (value x seconds)
+// by the trapezoidal rule over the samples in between and interpolated end points
+func integrate(samples []dcgm.Sample, from, to time.Time) float64 {
+	if len(samples) == 0 || !to.After(from) {
+		return 0
+	}
+
+	prevTime, prevValue := from, interpolate(samples, from)
+	var area float64
+
+	first := sort.Search(len(samples), func(i int) bool {
+		return samples[i].Time.After(from)
+	})
+	for _, sample := range samples[first:] {
+		if !sample.Time.Before(to) {
+			break
+		}
+		area += (prevValue + sample.Value) / 2 * sample.Time.Sub(prevTime).Seconds()
+		prevTime, prevValue = sample.Time, sample.Value
+	}
+
+	area += (prevValue + interpolate(samples, to)) / 2 * to.Sub(prevTime).Seconds()
+	return area
+}
+
+// average returns the time-weighted mean of a series between from and to, or
+// fallback if the series has no samples
+func average(samples []dcgm.Sample, from, to time.Time, fallback float64) float64 {
+	if len(samples) == 0 || !to.After(from) {
+		return fallback
+	}
+	return integrate(samples, from, to) / to.Sub(from).Seconds()
+}
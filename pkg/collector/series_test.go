@@ -0,0 +1,189 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+)
+
+// sampleWaveform samples f (seconds since start -> value) every step from start to start+duration
+func sampleWaveform(start time.Time, duration, step time.Duration, f func(float64) float64) []dcgm.Sample {
+	var samples []dcgm.Sample
+	for offset := time.Duration(0); offset <= duration; offset += step {
+		samples = append(samples, dcgm.Sample{Time: start.Add(offset), Value: f(offset.Seconds())})
+	}
+	return samples
+}
+
+// TestIntegrate tests trapezoidal integration over interpolated window ends
+func TestIntegrate(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	at := func(seconds float64) time.Time {
+		return start.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	constant := sampleWaveform(start, 10*time.Second, time.Second, func(float64) float64 { return 100 })
+	ramp := sampleWaveform(start, 10*time.Second, time.Second, func(s float64) float64 { return 10 * s })
+
+	tests := []struct {
+		name     string
+		samples  []dcgm.Sample
+		from, to float64
+		expected float64
+	}{
+		{"constant", constant, 0, 10, 1000},
+		{"ramp", ramp, 0, 10, 500},
+		{"ramp window between samples", ramp, 2.5, 7.5, 250},
+		{"held beyond the samples", ramp, 10, 12, 200},
+		{"empty window", ramp, 5, 5, 0},
+		{"no samples", nil, 0, 10, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := integrate(tt.samples, at(tt.from), at(tt.to)); !almostEqual(got, tt.expected) {
+				t.Errorf("Expected %f, got %f", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestIntegrate_VaryingPower tests that integrating a power series beats one reading x interval
+func TestIntegrate_VaryingPower(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	const seconds, period = 10.0, 3.0
+
+	power := func(s float64) float64 { return 200 + 100*math.Sin(2*math.Pi*s/period) }
+	samples := sampleWaveform(start, 10*time.Second, 100*time.Millisecond, power)
+
+	exact := 200*seconds + 100*period/(2*math.Pi)*(1-math.Cos(2*math.Pi*seconds/period))
+	integrated := integrate(samples, start, start.Add(10*time.Second))
+	point := power(seconds) * seconds
+
+	integratedErr := math.Abs(integrated-exact) / exact
+	pointErr := math.Abs(point-exact) / exact
+
+	if integratedErr > 0.005 {
+		t.Errorf("Expected integrated energy within 0.5%% of %fJ, got %fJ", exact, integrated)
+	}
+	if integratedErr >= pointErr {
+		t.Errorf("Expected integration (error %.4f) to beat a point sample (error %.4f)", integratedErr, pointErr)
+	}
+}
+
+// TestAttributeSeries_BurstyKernels tests that per-sub-interval attribution credits
+// short bursts that a point sample at the end of the interval misses
+func TestAttributeSeries_BurstyKernels(t *testing.T) {
+	c, _, _ := newTestCollector(t)
+
+	// Time-sliced GPU: PID 1 runs a 250W kernel for the first 200ms of every second,
+	// PID 2 a 100W kernel for the rest
+	start := time.Unix(1700000000, 0)
+	burst := func(s float64) bool { return math.Mod(s, 1) < 0.2 }
+	on := func(running bool) float64 {
+		if running {
+			return 1
+		}
+		return 0
+	}
+
+	step := 10 * time.Millisecond
+	series := &dcgm.GPUSeries{
+		Power: sampleWaveform(start, 10*time.Second, step, func(s float64) float64 {
+			if burst(s) {
+				return 250
+			}
+			return 100
+		}),
+		SMUtilization: map[uint][]dcgm.Sample{
+			1: sampleWaveform(start, 10*time.Second, step, func(s float64) float64 { return on(burst(s)) }),
+			2: sampleWaveform(start, 10*time.Second, step, func(s float64) float64 { return on(!burst(s)) }),
+		},
+	}
+	truth := []float64{10 * 0.2 * 250, 10 * 0.8 * 100}
+
+	// The latest utilization samples land in PID 2's longer turn
+	processes := []*ProcessMetrics{
+		{PID: 1, IsRunning: true, SmUtilization: 0},
+		{PID: 2, IsRunning: true, SmUtilization: 1},
+	}
+	interval := gpuEnergyInterval{
+		Joules:      truth[0] + truth[1],
+		Seconds:     10,
+		FromCounter: true,
+		End:         start.Add(10 * time.Second),
+	}
+
+	attributionErr := func(shares []float64) float64 {
+		var total float64
+		for i, share := range shares {
+			total += math.Abs(share - truth[i])
+		}
+		return total / interval.Joules
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	attributor := c.attributorFor(0, false)
+	point := c.attribute(attributor, 0, processes, interval, interval.Joules, 0)
+
+	interval.Series = series
+	integrated := c.attribute(attributor, 0, processes, interval, interval.Joules, 0)
+
+	if err := attributionErr(integrated); err > 0.02 {
+		t.Errorf("Expected series attribution within 2%% of %v, got %v (error %.4f)", truth, integrated, err)
+	}
+	if attributionErr(integrated) >= attributionErr(point) {
+		t.Errorf("Expected series attribution (%v) to beat point samples (%v)", integrated, point)
+	}
+}
+
+// TestAttributeSeries_IdleBaseline tests that sub-intervals are weighed by power above idle
+func TestAttributeSeries_IdleBaseline(t *testing.T) {
+	c, _, _ := newTestCollector(t)
+
+	// PID 1 runs for the first half at 150W, PID 2 for the second half at 100W,
+	// over a 50W idle baseline: active energy is 100J + 50J
+	start := time.Unix(1700000000, 0)
+	firstHalf := func(s float64) bool { return s < 1 }
+	step := time.Millisecond
+	series := &dcgm.GPUSeries{
+		Power: sampleWaveform(start, 2*time.Second, step, func(s float64) float64 {
+			if firstHalf(s) {
+				return 150
+			}
+			return 100
+		}),
+		SMUtilization: map[uint][]dcgm.Sample{
+			1: sampleWaveform(start, 2*time.Second, step, func(s float64) float64 {
+				if firstHalf(s) {
+					return 1
+				}
+				return 0
+			}),
+			2: sampleWaveform(start, 2*time.Second, step, func(s float64) float64 {
+				if firstHalf(s) {
+					return 0
+				}
+				return 1
+			}),
+		},
+	}
+
+	processes := []*ProcessMetrics{
+		{PID: 1, IsRunning: true},
+		{PID: 2, IsRunning: true},
+	}
+	interval := gpuEnergyInterval{Joules: 250, Seconds: 2, End: start.Add(2 * time.Second), Series: series}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	shares := c.attribute(c.attributorFor(0, false), 0, processes, interval, 150, 50)
+	if math.Abs(shares[0]-100) > 0.5 || math.Abs(shares[1]-50) > 0.5 {
+		t.Errorf("Expected 100J/50J of active energy, got %v", shares)
+	}
+}
@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/vimalk78/my-gpu-exporter/pkg/backend"
+	"github.com/vimalk78/my-gpu-exporter/pkg/kubernetes"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// How a GPU is shared between the processes running on it
+const (
+	SharingModeExclusive   = "exclusive"    // One container owns the whole GPU
+	SharingModeTimeSlicing = "time-slicing" // Containers take turns on the GPU
+	SharingModeMPS         = "mps"          // MPS clients run kernels concurrently
+	SharingModeMIG         = "mig"          // Processes run on MIG slices of the GPU
+)
+
+// GPUSharing is how a GPU is configured to be shared
+type GPUSharing struct {
+	Mode                string // Configured sharing mode (SharingMode* constants)
+	MIGEnabled          bool
+	ComputeMode         string // NVML compute mode (process.ComputeMode* constants), empty if unknown
+	MPSDaemon           bool   // An MPS control daemon runs on the node
+	TimeSlicingReplicas int    // Device plugin time-slicing replicas, 0 if not configured
+	MPSReplicas         int    // Device plugin MPS replicas, 0 if not configured
+}
+
+// configuredMode derives the sharing mode a GPU is set up for
+// Without a device plugin config an MPS control daemon is taken to serve every GPU
+func (s GPUSharing) configuredMode(pluginConfigured bool) string {
+	switch {
+	case s.MIGEnabled:
+		return SharingModeMIG
+	case s.MPSReplicas > 0, s.MPSDaemon && !pluginConfigured:
+		return SharingModeMPS
+	case s.TimeSlicingReplicas > 1:
+		return SharingModeTimeSlicing
+	default:
+		return SharingModeExclusive
+	}
+}
+
+// loadSharing refreshes every GPU's sharing configuration from NVML, the MPS
+// control daemon and the device plugin config
+func (c *Collector) loadSharing() {
+	var plugin *kubernetes.DevicePluginConfig
+	if path := c.config.DevicePluginConfig; path != "" {
+		var err error
+		plugin, err = kubernetes.LoadDevicePluginConfig(path)
+		if err != nil {
+			slog.Warn("Failed to load device plugin config, ignoring configured replicas",
+				slog.String("path", path),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	mpsDaemon, err := process.MPSControlDaemonRunning()
+	if err != nil {
+		slog.Debug("Failed to look for the MPS control daemon",
+			slog.String("error", err.Error()))
+	}
+
+	sharing := make(map[uint]GPUSharing)
+	for gpuID, info := range c.GetDevices() {
+		s := GPUSharing{MPSDaemon: mpsDaemon}
+
+		modes, err := c.backend.GetDeviceModes(gpuID)
+		switch {
+		case err == nil:
+			s.MIGEnabled = modes.MIGEnabled
+			s.ComputeMode = modes.ComputeMode
+		case errors.Is(err, backend.ErrNotSupported):
+		default:
+			slog.Debug("Failed to get device modes",
+				slog.Uint64("gpu", uint64(gpuID)),
+				slog.String("error", err.Error()))
+		}
+
+		if plugin != nil {
+			s.TimeSlicingReplicas, s.MPSReplicas = plugin.Replicas(gpuID, info.UUID)
+		}
+
+		s.Mode = s.configuredMode(plugin != nil)
+		sharing[gpuID] = s
+	}
+
+	c.mu.Lock()
+	c.sharing = sharing
+	c.mu.Unlock()
+}
+
+// gpuSharingMode decides how a GPU is shared between the processes running on it
+// MIG and MPS come from the processes or the GPU's configuration. Otherwise the GPU
+// is only time-sliced between containers: processes of one container are a single
+// tenant that has the GPU to itself.
+// Must be called with c.mu held
+func (c *Collector) gpuSharingMode(gpuID uint, processes []*ProcessMetrics) string {
+	configured := c.sharing[gpuID].Mode
+
+	var mps bool
+	containers := make(map[string]bool)
+	for _, pm := range processes {
+		mps = mps || pm.MPS
+		containers[pm.ContainerID] = true
+	}
+
+	switch {
+	case hasMIGProcesses(processes) || configured == SharingModeMIG:
+		return SharingModeMIG
+	case mps || configured == SharingModeMPS:
+		return SharingModeMPS
+	case len(containers) > 1:
+		return SharingModeTimeSlicing
+	default:
+		return SharingModeExclusive
+	}
+}
+
+// sharedCounterGPUs returns the GPUs whose per-process counters report whole-GPU
+// energy: GPUs with several processes, even of one container, and MIG and MPS GPUs
+// (same rule as accountInterval)
+// Must be called with c.mu held
+func (c *Collector) sharedCounterGPUs(processes []process.ProcessInfo) map[uint]bool {
+	counts := make(map[uint]int)
+	shared := make(map[uint]bool)
+	for _, proc := range processes {
+		counts[proc.GPU]++
+		mode := c.sharing[proc.GPU].Mode
+		if counts[proc.GPU] > 1 || proc.MIG != nil || proc.MPS || proc.MPSServer ||
+			mode == SharingModeMIG || mode == SharingModeMPS {
+			shared[proc.GPU] = true
+		}
+	}
+
+	return shared
+}
+
+// GetGPUSharing returns the sharing configuration of every GPU in the inventory keyed by GPU ID
+func (c *Collector) GetGPUSharing() map[uint]GPUSharing {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	sharing := make(map[uint]GPUSharing, len(c.sharing))
+	for gpuID, s := range c.sharing {
+		sharing[gpuID] = s
+	}
+
+	return sharing
+}
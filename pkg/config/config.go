@@ -2,11 +2,52 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Idle energy attribution modes
+const (
+	IdleAttributionNone         = "none"         // Idle energy is reported per GPU only
+	IdleAttributionProportional = "proportional" // Spread like active energy (by utilization)
+	IdleAttributionTimeShare    = "time-share"   // Spread evenly across processes on the GPU
+)
+
+// How interval energy and activity are sampled for estimation
+const (
+	EnergyIntegrationPoint  = "point"  // One power reading and utilization snapshot per interval
+	EnergyIntegrationSeries = "series" // Power and utilization time series, attributed per sub-interval
+)
+
+// Where allowlisted pod labels and annotations are exported
+const (
+	PodMetadataInfo   = "info"   // On a pod info metric, joined on exported_namespace and exported_pod
+	PodMetadataSeries = "series" // As extra labels on every per-process series
+)
+
+// Built-in energy attribution models (see pkg/attribution)
+const (
+	EnergyModelSM         = "sm"          // Share active energy by SM utilization
+	EnergyModelWeighted   = "weighted"    // Share by weighted SM, memory bandwidth and memory footprint
+	EnergyModelEqualShare = "equal-share" // Split evenly between processes
+	EnergyModelTimeShare  = "time-share"  // Share by time each process was present in the interval
+)
+
+// ModelCoefficients weights the activity signals of the weighted energy model
+type ModelCoefficients struct {
+	SM        float64 // SM utilization (0.0-1.0)
+	Memory    float64 // Memory bandwidth utilization (0.0-1.0)
+	Footprint float64 // Fraction of the GPU's framebuffer used by the process
+}
+
 // Config holds all configuration for the exporter
 type Config struct {
+	// Telemetry backend
+	Backend string // "auto", "dcgm" or "nvml"
+
 	// DCGM
 	DCGMUpdateFrequency time.Duration
 
@@ -16,14 +57,42 @@ type Config struct {
 	// Kubernetes
 	KubernetesEnabled  bool
 	PodResourcesSocket string
+	DevicePluginConfig string // NVIDIA device plugin config file with time-slicing/MPS replicas ("" = none)
+	NodeName           string // Node whose pods are watched for pod UID lookups ("" = no watch)
+	PodCacheSize       int    // Maximum number of watched pods kept (0 = unbounded)
+	Kubeconfig         string // Kubeconfig for out-of-cluster runs ("" = in-cluster service account)
+
+	// Pod labels and annotations exported as metric labels (label_<name>, annotation_<name>)
+	PodLabelsAllowlist      []string
+	PodAnnotationsAllowlist []string
+	PodMetadataTarget       string // "info" or "series"
 
 	// Metrics
 	MetricRetention time.Duration
 	MetricPrefix    string
+	Hostname        string // Value of the hostname label
 
 	// Energy Estimation
-	EnableEnergyEstimation bool    // Enable SM-based energy estimation for time-slicing
-	GPUIdlePower           float64 // GPU idle power in Watts (subtracted before attribution)
+	EnableEnergyEstimation bool          // Enable SM-based energy estimation for time-slicing
+	GPUIdlePower           float64       // GPU idle power in Watts (subtracted before attribution)
+	IdleEnergyAttribution  string        // How idle energy is attributed: "none", "proportional" or "time-share"
+	EnergyIntegration      string        // How interval energy and activity are sampled: "point" or "series"
+	EnergyIntegrationStep  time.Duration // Sub-interval length when integrating time series
+
+	// Energy attribution model
+	EnergyModel                    string                       // Attribution model for the node, e.g. "sm" or "weighted"
+	EnergyModelByModel             map[string]string            // Words of the GPU model name -> attribution model
+	EnergyModelMPS                 string                       // Attribution model for GPUs shared through MPS ("" = as for time-slicing)
+	EnergyModelCoefficients        ModelCoefficients            // Weighted model coefficients (default 0.7 SM, 0.3 memory)
+	EnergyModelCoefficientsByModel map[string]ModelCoefficients // Words of the GPU model name -> coefficients
+
+	// Attribution accuracy self-check
+	AttributionErrorThreshold float64 // Relative error above which a check window is logged and counted (0 = off)
+
+	// Idle power calibration
+	IdlePowerCalibration bool               // Learn each GPU's idle power from idle periods
+	IdlePowerStateFile   string             // Where learned idle power is persisted ("" = not persisted)
+	GPUIdlePowerByModel  map[string]float64 // Words of the GPU model name -> idle power in Watts
 
 	// Server
 	ListenAddress string
@@ -36,24 +105,45 @@ type Config struct {
 // NewConfig creates a new configuration with defaults
 func NewConfig() *Config {
 	return &Config{
-		DCGMUpdateFrequency:    1 * time.Second,
-		ProcessScanInterval:    10 * time.Second,
-		KubernetesEnabled:      true,
-		PodResourcesSocket:     "/var/lib/kubelet/pod-resources/kubelet.sock",
-		MetricRetention:        5 * time.Minute,
-		MetricPrefix:           "my_gpu_process",
-		EnableEnergyEstimation: true, // Enabled by default for time-slicing support
-		GPUIdlePower:           0,    // Default 0 = no idle power subtraction
-		ListenAddress:          ":9400",
-		MetricsPath:            "/metrics",
-		LogLevel:               "info",
+		Backend:                        "auto",
+		DCGMUpdateFrequency:            1 * time.Second,
+		ProcessScanInterval:            10 * time.Second,
+		KubernetesEnabled:              true,
+		PodResourcesSocket:             "/var/lib/kubelet/pod-resources/kubelet.sock",
+		NodeName:                       os.Getenv("NODE_NAME"),
+		PodCacheSize:                   1024,
+		Kubeconfig:                     os.Getenv("KUBECONFIG"),
+		PodMetadataTarget:              PodMetadataInfo,
+		MetricRetention:                5 * time.Minute,
+		MetricPrefix:                   "my_gpu_process",
+		Hostname:                       defaultHostname(),
+		EnableEnergyEstimation:         true, // Enabled by default for time-slicing support
+		GPUIdlePower:                   0,    // Default 0 = no idle power subtraction
+		IdleEnergyAttribution:          IdleAttributionNone,
+		EnergyIntegration:              EnergyIntegrationPoint,
+		EnergyIntegrationStep:          100 * time.Millisecond,
+		EnergyModel:                    EnergyModelSM,
+		EnergyModelCoefficients:        ModelCoefficients{SM: 0.7, Memory: 0.3},
+		EnergyModelByModel:             map[string]string{},
+		EnergyModelMPS:                 EnergyModelWeighted,
+		EnergyModelCoefficientsByModel: map[string]ModelCoefficients{},
+		AttributionErrorThreshold:      0.1,
+		IdlePowerCalibration:           true,
+		IdlePowerStateFile:             "/var/lib/my-gpu-exporter/idle-power.json",
+		GPUIdlePowerByModel:            map[string]float64{},
+		ListenAddress:                  ":9400",
+		MetricsPath:                    "/metrics",
+		LogLevel:                       "info",
 	}
 }
 
 // LoadFromFlags loads configuration from command-line flags
 func (c *Config) LoadFromFlags() {
+	flag.StringVar(&c.Backend, "backend", c.Backend,
+		"GPU telemetry backend (auto, dcgm, nvml); auto falls back to nvml when DCGM is unavailable")
+
 	flag.DurationVar(&c.DCGMUpdateFrequency, "dcgm-update-frequency", c.DCGMUpdateFrequency,
-		"DCGM sampling frequency")
+		"How often GPU energy is sampled and attributed between process scans")
 
 	flag.DurationVar(&c.ProcessScanInterval, "process-scan-interval", c.ProcessScanInterval,
 		"How often to scan for new GPU processes")
@@ -64,17 +154,117 @@ func (c *Config) LoadFromFlags() {
 	flag.StringVar(&c.PodResourcesSocket, "pod-resources-socket", c.PodResourcesSocket,
 		"Path to kubelet pod-resources socket")
 
+	flag.StringVar(&c.DevicePluginConfig, "device-plugin-config", c.DevicePluginConfig,
+		"NVIDIA device plugin config file to read time-slicing and MPS replicas from (empty to disable)")
+
+	flag.StringVar(&c.NodeName, "node-name", c.NodeName,
+		"Kubernetes node this exporter runs on; only its pods are watched for pod UID lookups (defaults to $NODE_NAME)")
+
+	flag.IntVar(&c.PodCacheSize, "pod-cache-size", c.PodCacheSize,
+		"Maximum number of watched pods kept in memory (0 = unbounded)")
+
+	flag.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig,
+		"Kubeconfig to reach the API server when running outside the cluster (defaults to $KUBECONFIG, else the in-cluster service account)")
+
+	flag.Func("pod-labels-allowlist",
+		"Comma-separated pod labels to export as label_<name>, e.g. \"team,cost-center,app.kubernetes.io/name\"",
+		func(value string) error {
+			c.PodLabelsAllowlist = ParseList(value)
+			return nil
+		})
+
+	flag.Func("pod-annotations-allowlist",
+		"Comma-separated pod annotations to export as annotation_<name>",
+		func(value string) error {
+			c.PodAnnotationsAllowlist = ParseList(value)
+			return nil
+		})
+
+	flag.StringVar(&c.PodMetadataTarget, "pod-metadata-target", c.PodMetadataTarget,
+		"Where allowlisted pod labels and annotations are exported: info (a pod_info metric to join on) or series (every per-process series)")
+
 	flag.DurationVar(&c.MetricRetention, "metric-retention", c.MetricRetention,
 		"How long to retain metrics for exited processes")
 
 	flag.StringVar(&c.MetricPrefix, "metric-prefix", c.MetricPrefix,
 		"Prefix for Prometheus metric names")
 
+	flag.StringVar(&c.Hostname, "hostname", c.Hostname,
+		"Value of the hostname label (defaults to $NODE_NAME, then the OS hostname)")
+
 	flag.BoolVar(&c.EnableEnergyEstimation, "enable-energy-estimation", c.EnableEnergyEstimation,
 		"Enable SM-based energy estimation when time-slicing is detected")
 
 	flag.Float64Var(&c.GPUIdlePower, "gpu-idle-power", c.GPUIdlePower,
-		"GPU idle power in Watts (subtracted before per-process attribution)")
+		"GPU idle power in Watts (subtracted before per-process attribution), used until calibrated")
+
+	flag.BoolVar(&c.IdlePowerCalibration, "idle-power-calibration", c.IdlePowerCalibration,
+		"Learn each GPU's idle power from periods with no processes and near-zero utilization")
+
+	flag.StringVar(&c.IdlePowerStateFile, "idle-power-state-file", c.IdlePowerStateFile,
+		"File where learned idle power is persisted across restarts (empty to disable)")
+
+	flag.Func("gpu-idle-power-by-model",
+		"Per-model idle power overrides, e.g. \"T4=10,A10=20,A100=50\" (matched as whole words of the model name)",
+		func(value string) error {
+			overrides, err := ParseModelValues(value)
+			if err != nil {
+				return err
+			}
+			c.GPUIdlePowerByModel = overrides
+			return nil
+		})
+
+	flag.StringVar(&c.IdleEnergyAttribution, "idle-energy-attribution", c.IdleEnergyAttribution,
+		"How idle energy is attributed while processes run: none (report per GPU only), proportional, time-share")
+
+	flag.StringVar(&c.EnergyIntegration, "energy-integration", c.EnergyIntegration,
+		"How shared GPU energy is sampled: point (one power reading and utilization snapshot per interval) or series (integrate power and per-process utilization time series)")
+
+	flag.DurationVar(&c.EnergyIntegrationStep, "energy-integration-step", c.EnergyIntegrationStep,
+		"Sub-interval over which energy is attributed when --energy-integration=series")
+
+	flag.StringVar(&c.EnergyModel, "energy-model", c.EnergyModel,
+		"How estimated energy is shared between processes: sm (SM utilization), weighted (SM, memory bandwidth and memory footprint), equal-share, time-share (time present in the interval)")
+
+	flag.Func("energy-model-by-model",
+		"Per-model attribution models, e.g. \"A100=weighted,T4=time-share\" (matched as whole words of the model name)",
+		func(value string) error {
+			models, err := ParseModelNames(value)
+			if err != nil {
+				return err
+			}
+			c.EnergyModelByModel = models
+			return nil
+		})
+
+	flag.StringVar(&c.EnergyModelMPS, "energy-model-mps", c.EnergyModelMPS,
+		"Attribution model for GPUs shared through MPS, whose clients run kernels concurrently rather than in turns (empty to use the time-slicing choice)")
+
+	flag.Func("energy-model-coefficients",
+		"Weighted model coefficients, e.g. \"sm=0.7,mem=0.3,footprint=0\" (omitted signals weigh 0)",
+		func(value string) error {
+			coefficients, err := ParseCoefficients(value)
+			if err != nil {
+				return err
+			}
+			c.EnergyModelCoefficients = coefficients
+			return nil
+		})
+
+	flag.Func("energy-model-coefficients-by-model",
+		"Per-model weighted model coefficients, e.g. \"A100:sm=0.6,mem=0.4;T4:sm=0.8,mem=0.2\" (matched as whole words of the model name)",
+		func(value string) error {
+			coefficients, err := ParseModelCoefficients(value)
+			if err != nil {
+				return err
+			}
+			c.EnergyModelCoefficientsByModel = coefficients
+			return nil
+		})
+
+	flag.Float64Var(&c.AttributionErrorThreshold, "attribution-error-threshold", c.AttributionErrorThreshold,
+		"Relative error between attributed and measured GPU energy above which a warning is logged (0 to disable)")
 
 	flag.StringVar(&c.ListenAddress, "listen-address", c.ListenAddress,
 		"Address to listen on for HTTP requests")
@@ -87,3 +277,239 @@ func (c *Config) LoadFromFlags() {
 
 	flag.Parse()
 }
+
+// defaultHostname prefers the Kubernetes node name (set via the downward API)
+// over the OS hostname, which is the pod name when not using host networking
+func defaultHostname() string {
+	if name := os.Getenv("NODE_NAME"); name != "" {
+		return name
+	}
+
+	name, _ := os.Hostname()
+	return name
+}
+
+// ParseList parses a comma-separated list, dropping blank entries
+func ParseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// PodMetadataLabels returns the Prometheus label names of the allowlisted pod
+// labels and annotations, in allowlist order: label_<name>, then annotation_<name>,
+// with characters other than letters, digits and underscores replaced by "_"
+// Fails if two names map to the same label
+func (c *Config) PodMetadataLabels() ([]string, error) {
+	var names []string
+	seen := make(map[string]string)
+
+	for _, list := range []struct {
+		prefix string
+		keys   []string
+	}{
+		{"label_", c.PodLabelsAllowlist},
+		{"annotation_", c.PodAnnotationsAllowlist},
+	} {
+		for _, key := range list.keys {
+			name := list.prefix + sanitizeLabelName(key)
+			if other, ok := seen[name]; ok {
+				return nil, fmt.Errorf("pod metadata %q and %q both map to label %s", other, key, name)
+			}
+			seen[name] = key
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// sanitizeLabelName replaces characters that are invalid in Prometheus label names with "_"
+func sanitizeLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// ParseModelValues parses "model=value,model=value" into a map
+// Model keys are matched as whole words of the GPU model name (see MatchModel)
+func ParseModelValues(value string) (map[string]float64, error) {
+	values := make(map[string]float64)
+	if strings.TrimSpace(value) == "" {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		model, number, ok := strings.Cut(pair, "=")
+		model = strings.TrimSpace(model)
+		if !ok || model == "" {
+			return nil, fmt.Errorf("invalid entry %q (expected model=value)", pair)
+		}
+
+		if _, ok := values[model]; ok {
+			return nil, fmt.Errorf("model %q is listed more than once", model)
+		}
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %w", model, err)
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("value for %q must not be negative", model)
+		}
+		values[model] = v
+	}
+
+	return values, nil
+}
+
+// ParseModelNames parses "model=name,model=name" into a map
+// Model keys are matched as whole words of the GPU model name (see MatchModel)
+func ParseModelNames(value string) (map[string]string, error) {
+	values := make(map[string]string)
+	if strings.TrimSpace(value) == "" {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		model, name, ok := strings.Cut(pair, "=")
+		model, name = strings.TrimSpace(model), strings.TrimSpace(name)
+		if !ok || model == "" || name == "" {
+			return nil, fmt.Errorf("invalid entry %q (expected model=name)", pair)
+		}
+		if _, ok := values[model]; ok {
+			return nil, fmt.Errorf("model %q is listed more than once", model)
+		}
+		values[model] = name
+	}
+
+	return values, nil
+}
+
+// ParseCoefficients parses "sm=0.7,mem=0.3,footprint=0" into weighted model coefficients
+// Signals that are not listed weigh 0
+func ParseCoefficients(value string) (ModelCoefficients, error) {
+	var coefficients ModelCoefficients
+	seen := make(map[string]bool)
+
+	for _, pair := range strings.Split(value, ",") {
+		name, number, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return ModelCoefficients{}, fmt.Errorf("invalid coefficient %q (expected signal=value)", pair)
+		}
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil {
+			return ModelCoefficients{}, fmt.Errorf("invalid value for %q: %w", name, err)
+		}
+		if v < 0 {
+			return ModelCoefficients{}, fmt.Errorf("coefficient %q must not be negative", name)
+		}
+
+		if seen[name] {
+			return ModelCoefficients{}, fmt.Errorf("coefficient %q is listed more than once", name)
+		}
+		seen[name] = true
+
+		switch name {
+		case "sm":
+			coefficients.SM = v
+		case "mem":
+			coefficients.Memory = v
+		case "footprint":
+			coefficients.Footprint = v
+		default:
+			return ModelCoefficients{}, fmt.Errorf("unknown signal %q (expected sm, mem or footprint)", name)
+		}
+	}
+
+	if coefficients.SM+coefficients.Memory+coefficients.Footprint == 0 {
+		return ModelCoefficients{}, fmt.Errorf("at least one coefficient must be positive")
+	}
+
+	return coefficients, nil
+}
+
+// ParseModelCoefficients parses "model:sm=0.6,mem=0.4;model:..." into per-model coefficients
+// Model keys are matched as whole words of the GPU model name (see MatchModel)
+func ParseModelCoefficients(value string) (map[string]ModelCoefficients, error) {
+	values := make(map[string]ModelCoefficients)
+	if strings.TrimSpace(value) == "" {
+		return values, nil
+	}
+
+	for _, entry := range strings.Split(value, ";") {
+		model, list, ok := strings.Cut(entry, ":")
+		model = strings.TrimSpace(model)
+		if !ok || model == "" {
+			return nil, fmt.Errorf("invalid entry %q (expected model:sm=value,...)", entry)
+		}
+
+		if _, ok := values[model]; ok {
+			return nil, fmt.Errorf("model %q is listed more than once", model)
+		}
+
+		coefficients, err := ParseCoefficients(list)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coefficients for %q: %w", model, err)
+		}
+		values[model] = coefficients
+	}
+
+	return values, nil
+}
+
+// MatchModel returns the value configured for a GPU model
+// Keys match whole words of the model name, words being separated by spaces,
+// hyphens or underscores, so "A10" does not match an A100. The longest matching
+// key wins, so "A100-SXM4-80GB" takes precedence over "A100"; among matching
+// keys of the same length, the lexically smallest wins
+func MatchModel[V any](values map[string]V, model string) (V, bool) {
+	var bestKey string
+	var bestValue V
+	found := false
+
+	for key, value := range values {
+		if !containsWords(model, key) {
+			continue
+		}
+		if !found || len(key) > len(bestKey) || (len(key) == len(bestKey) && key < bestKey) {
+			bestKey, bestValue, found = key, value, true
+		}
+	}
+
+	return bestValue, found
+}
+
+// containsWords reports whether key occurs in model starting and ending on word boundaries
+func containsWords(model, key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for offset := 0; ; {
+		i := strings.Index(model[offset:], key)
+		if i < 0 {
+			return false
+		}
+
+		start, end := offset+i, offset+i+len(key)
+		if (start == 0 || isWordSeparator(model[start-1])) && (end == len(model) || isWordSeparator(model[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// isWordSeparator reports whether b separates words in a GPU model name
+func isWordSeparator(b byte) bool {
+	return b == ' ' || b == '-' || b == '_'
+}
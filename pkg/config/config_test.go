@@ -0,0 +1,214 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseModelValues tests parsing of per-model values such as --gpu-idle-power-by-model
+func TestParseModelValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{"empty", "", map[string]float64{}, false},
+		{"blank", "  ", map[string]float64{}, false},
+		{"single", "T4=10", map[string]float64{"T4": 10}, false},
+		{"several with spaces", "T4=10, A100 = 50.5", map[string]float64{"T4": 10, "A100": 50.5}, false},
+		{"model with spaces", "Tesla T4=12", map[string]float64{"Tesla T4": 12}, false},
+		{"missing value", "T4", nil, true},
+		{"missing model", "=10", nil, true},
+		{"not a number", "T4=ten", nil, true},
+		{"negative", "T4=-1", nil, true},
+		{"trailing comma", "T4=10,", nil, true},
+		{"duplicate model", "T4=10,T4=12", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseModelValues(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseModelValues(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseModelValues(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseModelNames tests parsing of per-model attribution models (--energy-model-by-model)
+// Model names are not checked here: the attribution registry can be extended, so
+// unknown names are rejected when the collector creates its attributors
+func TestParseModelNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", "", map[string]string{}, false},
+		{"several", "A100=weighted, T4=time-share", map[string]string{"A100": "weighted", "T4": "time-share"}, false},
+		{"missing name", "A100=", nil, true},
+		{"missing model", "=weighted", nil, true},
+		{"no separator", "A100:weighted", nil, true},
+		{"duplicate model", "A100=weighted,A100=sm", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseModelNames(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseModelNames(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseModelNames(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseCoefficients tests parsing of weighted model coefficients (--energy-model-coefficients)
+func TestParseCoefficients(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    ModelCoefficients
+		wantErr bool
+	}{
+		{"all signals", "sm=0.6,mem=0.3,footprint=0.1", ModelCoefficients{SM: 0.6, Memory: 0.3, Footprint: 0.1}, false},
+		{"omitted signals weigh 0", " sm = 1 ", ModelCoefficients{SM: 1}, false},
+		{"empty", "", ModelCoefficients{}, true},
+		{"unknown signal", "sm=0.5,power=0.5", ModelCoefficients{}, true},
+		{"not a number", "sm=high", ModelCoefficients{}, true},
+		{"negative", "sm=1,mem=-0.5", ModelCoefficients{}, true},
+		{"all zero", "sm=0,mem=0", ModelCoefficients{}, true},
+		{"duplicate signal", "sm=0.5,sm=0.7", ModelCoefficients{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCoefficients(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCoefficients(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCoefficients(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseModelCoefficients tests parsing of per-model coefficients (--energy-model-coefficients-by-model)
+func TestParseModelCoefficients(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]ModelCoefficients
+		wantErr bool
+	}{
+		{"empty", "", map[string]ModelCoefficients{}, false},
+		{"several", "A100:sm=0.6,mem=0.4; T4:sm=1", map[string]ModelCoefficients{
+			"A100": {SM: 0.6, Memory: 0.4},
+			"T4":   {SM: 1},
+		}, false},
+		{"missing model", ":sm=1", nil, true},
+		{"missing separator", "A100=sm=1", nil, true},
+		{"invalid coefficients", "A100:sm=x", nil, true},
+		{"duplicate model", "A100:sm=1;A100:mem=1", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseModelCoefficients(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseModelCoefficients(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseModelCoefficients(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMatchModel tests that model keys match whole words, the longest key wins and
+// keys of the same length are tie-broken in lexical order
+func TestMatchModel(t *testing.T) {
+	values := map[string]float64{"A10": 20, "A100": 50, "A100-SXM4-80GB": 60, "T4": 10, "SXM4": 70, "80GB": 80}
+
+	tests := []struct {
+		model  string
+		want   float64
+		wantOK bool
+	}{
+		{"NVIDIA A100-SXM4-80GB", 60, true},
+		{"NVIDIA A100-PCIE-40GB", 50, true},
+		{"NVIDIA A10", 20, true},
+		{"NVIDIA A10G", 0, false},
+		{"Tesla T4", 10, true},
+		{"NVIDIA H100 80GB HBM3", 80, true},
+		{"NVIDIA H100-SXM4-80GB", 80, true},
+		{"NVIDIA H100 PCIe", 0, false},
+	}
+
+	for _, tt := range tests {
+		// Map order varies between runs; the result must not
+		for i := 0; i < 10; i++ {
+			got, ok := MatchModel(values, tt.model)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("MatchModel(%q) = %v, %v, want %v, %v", tt.model, got, ok, tt.want, tt.wantOK)
+				break
+			}
+		}
+	}
+}
+
+// TestParseList tests that lists are split on commas and blank entries dropped
+func TestParseList(t *testing.T) {
+	tests := map[string][]string{
+		"":     nil,
+		" , ":  nil,
+		"team": {"team"},
+		"team, cost-center,,app.kubernetes.io/name": {"team", "cost-center", "app.kubernetes.io/name"},
+	}
+
+	for value, want := range tests {
+		if got := ParseList(value); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseList(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+// TestPodMetadataLabels tests label names for the pod label and annotation allowlists
+func TestPodMetadataLabels(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      []string
+		annotations []string
+		want        []string
+		wantErr     bool
+	}{
+		{"none", nil, nil, nil, false},
+		{"sanitized in order", []string{"team", "app.kubernetes.io/name"}, []string{"cost-center"},
+			[]string{"label_team", "label_app_kubernetes_io_name", "annotation_cost_center"}, false},
+		{"same key as label and annotation", []string{"team"}, []string{"team"},
+			[]string{"label_team", "annotation_team"}, false},
+		{"duplicate label", []string{"team", "team"}, nil, nil, true},
+		{"collision after sanitizing", []string{"cost-center", "cost.center"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{PodLabelsAllowlist: tt.labels, PodAnnotationsAllowlist: tt.annotations}
+			got, err := cfg.PodMetadataLabels()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PodMetadataLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PodMetadataLabels() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package dcgm
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -8,10 +9,21 @@ import (
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 )
 
+// ErrFieldNotSupported is returned when a GPU does not expose a requested field
+var ErrFieldNotSupported = errors.New("field not supported by GPU")
+
 // Client wraps DCGM functionality for per-process energy tracking
 type Client struct {
 	groupHandle dcgm.GroupHandle
 	initialized bool
+
+	// Device-level fields watched for GetDeviceMetrics
+	deviceFieldGroup dcgm.FieldHandle
+	watchingDevices  bool
+
+	// Power watched at a high rate for GetPowerSince, started on first use
+	powerFieldGroup dcgm.FieldHandle
+	watchingPower   bool
 }
 
 // ProcessMetrics contains per-process GPU metrics from DCGM
@@ -79,6 +91,12 @@ func (c *Client) StartWatching() error {
 	slog.Info("Per-process metrics collection started",
 		slog.Any("groupHandle", groupHandle))
 
+	// Device metrics are optional - per-process collection works without them
+	if err := c.watchDeviceFields(); err != nil {
+		slog.Warn("Failed to watch device fields, device metrics may be stale or missing",
+			slog.String("error", err.Error()))
+	}
+
 	// Wait for initial data collection
 	// DCGM needs time to collect first samples
 	slog.Info("Waiting 3 seconds for initial DCGM data collection...")
@@ -87,9 +105,9 @@ func (c *Client) StartWatching() error {
 	return nil
 }
 
-// GetProcessMetrics retrieves metrics for a specific process
+// GetProcessMetrics retrieves metrics for a specific process, one entry per GPU it uses
 // Returns nil if process not found or no data available
-func (c *Client) GetProcessMetrics(pid uint) (*ProcessMetrics, error) {
+func (c *Client) GetProcessMetrics(pid uint) ([]*ProcessMetrics, error) {
 	if !c.initialized {
 		return nil, fmt.Errorf("DCGM client not initialized")
 	}
@@ -105,10 +123,17 @@ func (c *Client) GetProcessMetrics(pid uint) (*ProcessMetrics, error) {
 		return nil, nil
 	}
 
-	// Use the first GPU's info (processes can use multiple GPUs)
-	// TODO: In the future, we could return metrics for all GPUs the process uses
-	info := processInfos[0]
+	// Processes can use multiple GPUs - DCGM returns one entry per GPU
+	allMetrics := make([]*ProcessMetrics, 0, len(processInfos))
+	for _, info := range processInfos {
+		allMetrics = append(allMetrics, processMetricsFromInfo(pid, info))
+	}
 
+	return allMetrics, nil
+}
+
+// processMetricsFromInfo converts DCGM process info for one GPU into ProcessMetrics
+func processMetricsFromInfo(pid uint, info dcgm.ProcessInfo) *ProcessMetrics {
 	metrics := &ProcessMetrics{
 		PID:         pid,
 		GPU:         info.GPU,
@@ -148,7 +173,7 @@ func (c *Client) GetProcessMetrics(pid uint) (*ProcessMetrics, error) {
 		slog.Float64("energy_joules", metrics.EnergyConsumed),
 		slog.Bool("is_running", metrics.IsRunning))
 
-	return metrics, nil
+	return metrics
 }
 
 // GetGPUPowerUsage retrieves current power usage for a GPU in watts
@@ -174,6 +199,34 @@ func (c *Client) GetGPUPowerUsage(gpuID uint) (float64, error) {
 	return power, nil
 }
 
+// GetGPUTotalEnergy retrieves the cumulative energy counter for a GPU in joules
+// The counter starts from zero when the driver is loaded; GPUs older than Volta
+// do not expose it and return ErrFieldNotSupported
+func (c *Client) GetGPUTotalEnergy(gpuID uint) (float64, error) {
+	if !c.initialized {
+		return 0, fmt.Errorf("DCGM client not initialized")
+	}
+
+	fields := []dcgm.Short{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION}
+	values, err := dcgm.GetLatestValuesForFields(gpuID, fields)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get total energy for GPU %d: %w", gpuID, err)
+	}
+
+	if len(values) == 0 {
+		return 0, fmt.Errorf("no energy data available for GPU %d", gpuID)
+	}
+
+	// Blank, not-found and not-supported are all encoded at or above the blank sentinel
+	energy := values[0].Int64()
+	if energy >= dcgm.DCGM_FT_INT64_BLANK || energy < 0 {
+		return 0, ErrFieldNotSupported
+	}
+
+	// Counter is in millijoules
+	return float64(energy) / 1000.0, nil
+}
+
 // Shutdown cleans up DCGM resources
 func (c *Client) Shutdown() error {
 	if !c.initialized {
@@ -181,6 +234,14 @@ func (c *Client) Shutdown() error {
 	}
 
 	slog.Info("Shutting down DCGM client")
+	if c.watchingDevices {
+		dcgm.FieldGroupDestroy(c.deviceFieldGroup)
+		c.watchingDevices = false
+	}
+	if c.watchingPower {
+		dcgm.FieldGroupDestroy(c.powerFieldGroup)
+		c.watchingPower = false
+	}
 	dcgm.Shutdown()
 	c.initialized = false
 
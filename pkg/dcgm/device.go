@@ -0,0 +1,175 @@
+package dcgm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// DeviceMetrics contains device-level GPU metrics
+// Values the GPU does not report are NaN; ThrottleReasons is only valid if
+// ThrottleReasonsSupported is set
+type DeviceMetrics struct {
+	GPU uint
+
+	// Power and energy
+	PowerWatts      float64
+	EnergyJoules    float64 // Hardware energy counter since driver load
+	PowerLimitWatts float64 // Enforced power limit
+
+	// Thermal and clocks
+	TemperatureCelsius float64
+	SMClockMHz         float64
+	MemClockMHz        float64
+
+	// Utilization
+	GPUUtilization float64 // 0.0-1.0
+	MemUtilization float64 // 0.0-1.0
+
+	// Framebuffer
+	FBUsedBytes float64
+	FBFreeBytes float64
+
+	// Clock throttle (event) reasons bitmask, see ThrottleReasons
+	ThrottleReasons          uint64
+	ThrottleReasonsSupported bool
+}
+
+// NewDeviceMetrics creates DeviceMetrics with every value unavailable
+func NewDeviceMetrics(gpu uint) *DeviceMetrics {
+	nan := math.NaN()
+	return &DeviceMetrics{
+		GPU:                gpu,
+		PowerWatts:         nan,
+		EnergyJoules:       nan,
+		PowerLimitWatts:    nan,
+		TemperatureCelsius: nan,
+		SMClockMHz:         nan,
+		MemClockMHz:        nan,
+		GPUUtilization:     nan,
+		MemUtilization:     nan,
+		FBUsedBytes:        nan,
+		FBFreeBytes:        nan,
+	}
+}
+
+// ThrottleReason names one bit of the clock throttle reasons bitmask
+// Bits are shared by NVML (nvmlClocksEventReason*) and DCGM (DCGM_CLOCKS_EVENT_REASON_*)
+type ThrottleReason struct {
+	Bit  uint64
+	Name string
+}
+
+// ThrottleReasons lists the throttle reasons exported as metrics
+var ThrottleReasons = []ThrottleReason{
+	{0x1, "gpu_idle"},
+	{0x2, "applications_clocks_setting"},
+	{0x4, "sw_power_cap"},
+	{0x8, "hw_slowdown"},
+	{0x10, "sync_boost"},
+	{0x20, "sw_thermal_slowdown"},
+	{0x40, "hw_thermal_slowdown"},
+	{0x80, "hw_power_brake_slowdown"},
+	{0x100, "display_clock_setting"},
+}
+
+// deviceFields are the DCGM fields read by GetDeviceMetrics
+var deviceFields = []dcgm.Short{
+	dcgm.DCGM_FI_DEV_POWER_USAGE,
+	dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION,
+	dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT,
+	dcgm.DCGM_FI_DEV_GPU_TEMP,
+	dcgm.DCGM_FI_DEV_SM_CLOCK,
+	dcgm.DCGM_FI_DEV_MEM_CLOCK,
+	dcgm.DCGM_FI_DEV_GPU_UTIL,
+	dcgm.DCGM_FI_DEV_MEM_COPY_UTIL,
+	dcgm.DCGM_FI_DEV_FB_USED,
+	dcgm.DCGM_FI_DEV_FB_FREE,
+	dcgm.DCGM_FI_DEV_CLOCKS_EVENT_REASONS,
+}
+
+// watchDeviceFields makes DCGM sample deviceFields on all GPUs
+func (c *Client) watchDeviceFields() error {
+	fieldGroup, err := dcgm.FieldGroupCreate("my-gpu-exporter-device", deviceFields)
+	if err != nil {
+		return fmt.Errorf("failed to create device field group: %w", err)
+	}
+
+	if err := dcgm.WatchFieldsWithGroup(fieldGroup, dcgm.GroupAllGPUs()); err != nil {
+		dcgm.FieldGroupDestroy(fieldGroup)
+		return fmt.Errorf("failed to watch device fields: %w", err)
+	}
+
+	c.deviceFieldGroup = fieldGroup
+	c.watchingDevices = true
+	return nil
+}
+
+// GetDeviceMetrics retrieves device-level metrics for a GPU
+func (c *Client) GetDeviceMetrics(gpuID uint) (*DeviceMetrics, error) {
+	if !c.initialized {
+		return nil, fmt.Errorf("DCGM client not initialized")
+	}
+
+	values, err := dcgm.GetLatestValuesForFields(gpuID, deviceFields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device metrics for GPU %d: %w", gpuID, err)
+	}
+
+	metrics := NewDeviceMetrics(gpuID)
+	for _, value := range values {
+		v, ok := fieldFloat64(value)
+		if !ok {
+			continue
+		}
+
+		switch value.FieldID {
+		case dcgm.DCGM_FI_DEV_POWER_USAGE:
+			metrics.PowerWatts = v
+		case dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION:
+			metrics.EnergyJoules = v / 1000.0 // mJ -> J
+		case dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT:
+			metrics.PowerLimitWatts = v
+		case dcgm.DCGM_FI_DEV_GPU_TEMP:
+			metrics.TemperatureCelsius = v
+		case dcgm.DCGM_FI_DEV_SM_CLOCK:
+			metrics.SMClockMHz = v
+		case dcgm.DCGM_FI_DEV_MEM_CLOCK:
+			metrics.MemClockMHz = v
+		case dcgm.DCGM_FI_DEV_GPU_UTIL:
+			metrics.GPUUtilization = v / 100.0
+		case dcgm.DCGM_FI_DEV_MEM_COPY_UTIL:
+			metrics.MemUtilization = v / 100.0
+		case dcgm.DCGM_FI_DEV_FB_USED:
+			metrics.FBUsedBytes = v * 1024 * 1024 // MiB -> bytes
+		case dcgm.DCGM_FI_DEV_FB_FREE:
+			metrics.FBFreeBytes = v * 1024 * 1024 // MiB -> bytes
+		case dcgm.DCGM_FI_DEV_CLOCKS_EVENT_REASONS:
+			metrics.ThrottleReasons = uint64(value.Int64())
+			metrics.ThrottleReasonsSupported = true
+		}
+	}
+
+	return metrics, nil
+}
+
+// fieldFloat64 returns a field value as float64, or false if it is blank or unsupported
+func fieldFloat64(value dcgm.FieldValue_v1) (float64, bool) {
+	switch value.FieldType {
+	case dcgm.DCGM_FT_INT64:
+		v := value.Int64()
+		if v >= dcgm.DCGM_FT_INT64_BLANK || v < 0 {
+			return 0, false
+		}
+		return float64(v), true
+	case dcgm.DCGM_FT_DOUBLE:
+		v := value.Float64()
+		if v >= dcgm.DCGM_FT_FP64_BLANK || math.IsNaN(v) {
+			return 0, false
+		}
+		return v, true
+	default:
+		return 0, false
+	}
+}
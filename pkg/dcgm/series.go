@@ -0,0 +1,93 @@
+package dcgm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// How often DCGM samples GPU power for time series, and how long samples are kept
+// Kept samples must cover the longest interval between two energy measurements
+const (
+	seriesUpdateFrequency = 100 * time.Millisecond
+	seriesMaxKeepAge      = 5 * time.Minute
+)
+
+// Sample is one timestamped reading of a time series
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// GPUSeries holds what a GPU recorded over a period, every series oldest first
+type GPUSeries struct {
+	Power          []Sample          // GPU power in watts
+	SMUtilization  map[uint][]Sample // PID -> SM utilization (0.0-1.0)
+	MemUtilization map[uint][]Sample // PID -> memory bandwidth utilization (0.0-1.0)
+}
+
+// SortSamples orders samples oldest first
+func SortSamples(samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+}
+
+// watchPowerSeries makes DCGM keep a history of GPU power on all GPUs
+// Device fields are watched at DCGM's default rate, too slow for a time series,
+// so power gets its own field group
+func (c *Client) watchPowerSeries() error {
+	fieldGroup, err := dcgm.FieldGroupCreate("my-gpu-exporter-power", []dcgm.Short{dcgm.DCGM_FI_DEV_POWER_USAGE})
+	if err != nil {
+		return fmt.Errorf("failed to create power field group: %w", err)
+	}
+
+	err = dcgm.WatchFieldsWithGroupEx(fieldGroup, dcgm.GroupAllGPUs(),
+		seriesUpdateFrequency.Microseconds(), seriesMaxKeepAge.Seconds(), 0)
+	if err != nil {
+		dcgm.FieldGroupDestroy(fieldGroup)
+		return fmt.Errorf("failed to watch power: %w", err)
+	}
+
+	c.powerFieldGroup = fieldGroup
+	c.watchingPower = true
+	return nil
+}
+
+// GetPowerSince retrieves the power samples DCGM recorded for a GPU since a time, oldest first
+// The power watch starts on first use, so the first call returns little history
+func (c *Client) GetPowerSince(gpuID uint, since time.Time) ([]Sample, error) {
+	if !c.initialized {
+		return nil, fmt.Errorf("DCGM client not initialized")
+	}
+
+	if !c.watchingPower {
+		if err := c.watchPowerSeries(); err != nil {
+			return nil, err
+		}
+	}
+
+	values, _, err := dcgm.GetValuesSince(dcgm.GroupAllGPUs(), c.powerFieldGroup, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get power samples for GPU %d: %w", gpuID, err)
+	}
+
+	samples := make([]Sample, 0, len(values))
+	for _, value := range values {
+		if value.EntityID != gpuID || value.FieldID != dcgm.DCGM_FI_DEV_POWER_USAGE || value.Status != 0 {
+			continue
+		}
+
+		watts := value.Float64()
+		if watts >= dcgm.DCGM_FT_FP64_BLANK || math.IsNaN(watts) {
+			continue
+		}
+		samples = append(samples, Sample{Time: time.UnixMicro(value.TS), Value: watts})
+	}
+	SortSamples(samples)
+
+	return samples, nil
+}
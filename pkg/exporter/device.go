@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// deviceDescs holds descriptors for device-level GPU metrics
+type deviceDescs struct {
+	power          *prometheus.Desc
+	energy         *prometheus.Desc
+	powerLimit     *prometheus.Desc
+	temperature    *prometheus.Desc
+	smClock        *prometheus.Desc
+	memClock       *prometheus.Desc
+	utilization    *prometheus.Desc
+	memUtilization *prometheus.Desc
+	fbUsed         *prometheus.Desc
+	fbFree         *prometheus.Desc
+	throttleReason *prometheus.Desc
+}
+
+// newDeviceDescs creates device metric descriptors labeled with GPU identity
+func newDeviceDescs(prefix string, gpuLabels []string) deviceDescs {
+	desc := func(name, help string, labels []string) *prometheus.Desc {
+		return prometheus.NewDesc(fmt.Sprintf("%s_device_%s", prefix, name), help, labels, nil)
+	}
+
+	return deviceDescs{
+		power:          desc("power_watts", "Current GPU power draw in watts", gpuLabels),
+		energy:         desc("energy_joules_total", "GPU hardware energy counter in Joules since driver load", gpuLabels),
+		powerLimit:     desc("power_limit_watts", "Enforced GPU power limit in watts", gpuLabels),
+		temperature:    desc("temperature_celsius", "GPU temperature in degrees Celsius", gpuLabels),
+		smClock:        desc("sm_clock_hertz", "Current SM clock in hertz", gpuLabels),
+		memClock:       desc("memory_clock_hertz", "Current memory clock in hertz", gpuLabels),
+		utilization:    desc("utilization_ratio", "GPU utilization ratio (0.0-1.0)", gpuLabels),
+		memUtilization: desc("memory_utilization_ratio", "GPU memory bandwidth utilization ratio (0.0-1.0)", gpuLabels),
+		fbUsed:         desc("framebuffer_used_bytes", "GPU framebuffer memory used in bytes", gpuLabels),
+		fbFree:         desc("framebuffer_free_bytes", "GPU framebuffer memory free in bytes", gpuLabels),
+		throttleReason: desc("throttle_reason", "Whether clocks are currently throttled for the given reason (1=active)",
+			append(append([]string{}, gpuLabels...), "reason")),
+	}
+}
+
+// describe sends all device descriptors
+func (d deviceDescs) describe(ch chan<- *prometheus.Desc) {
+	ch <- d.power
+	ch <- d.energy
+	ch <- d.powerLimit
+	ch <- d.temperature
+	ch <- d.smClock
+	ch <- d.memClock
+	ch <- d.utilization
+	ch <- d.memUtilization
+	ch <- d.fbUsed
+	ch <- d.fbFree
+	ch <- d.throttleReason
+}
+
+// exportDeviceMetrics exports device-level metrics per GPU
+// Values the GPU does not report are skipped rather than exported as NaN
+func (e *Exporter) exportDeviceMetrics(ch chan<- prometheus.Metric, deviceMetrics map[uint]*dcgm.DeviceMetrics, devices map[uint]process.DeviceInfo) {
+	for gpuID, dm := range deviceMetrics {
+		labels := e.gpuLabelValues(gpuID, devices)
+
+		gauge := func(desc *prometheus.Desc, value float64) {
+			if !math.IsNaN(value) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+			}
+		}
+
+		gauge(e.device.power, dm.PowerWatts)
+		gauge(e.device.powerLimit, dm.PowerLimitWatts)
+		gauge(e.device.temperature, dm.TemperatureCelsius)
+		gauge(e.device.smClock, dm.SMClockMHz*1e6)
+		gauge(e.device.memClock, dm.MemClockMHz*1e6)
+		gauge(e.device.utilization, dm.GPUUtilization)
+		gauge(e.device.memUtilization, dm.MemUtilization)
+		gauge(e.device.fbUsed, dm.FBUsedBytes)
+		gauge(e.device.fbFree, dm.FBFreeBytes)
+
+		if !math.IsNaN(dm.EnergyJoules) {
+			ch <- prometheus.MustNewConstMetric(e.device.energy, prometheus.CounterValue, dm.EnergyJoules, labels...)
+		}
+
+		if dm.ThrottleReasonsSupported {
+			for _, reason := range dcgm.ThrottleReasons {
+				active := 0.0
+				if dm.ThrottleReasons&reason.Bit != 0 {
+					active = 1.0
+				}
+				ch <- prometheus.MustNewConstMetric(e.device.throttleReason, prometheus.GaugeValue, active,
+					append(append([]string{}, labels...), reason.Name)...)
+			}
+		}
+	}
+}
@@ -3,10 +3,13 @@ package exporter
 import (
 	"fmt"
 	"log/slog"
+	"math"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/vimalk78/my-gpu-exporter/pkg/collector"
 	"github.com/vimalk78/my-gpu-exporter/pkg/config"
+	"github.com/vimalk78/my-gpu-exporter/pkg/kubernetes"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
 )
 
 // Exporter implements prometheus.Collector
@@ -16,6 +19,8 @@ type Exporter struct {
 
 	// Per-process metric descriptors
 	energyDesc         *prometheus.Desc
+	energySourceDesc   *prometheus.Desc
+	powerDesc          *prometheus.Desc
 	smUtilDesc         *prometheus.Desc
 	memUtilDesc        *prometheus.Desc
 	memoryUsedDesc     *prometheus.Desc
@@ -25,6 +30,40 @@ type Exporter struct {
 	// GPU-level aggregation metrics (for time-slicing validation)
 	gpuEnergyTotalDesc *prometheus.Desc
 	gpuProcessCountDesc *prometheus.Desc
+
+	// GPU energy accounting (idle + attributed + unattributed = device energy)
+	gpuIdleEnergyDesc         *prometheus.Desc
+	gpuAttributedEnergyDesc   *prometheus.Desc
+	gpuUnattributedEnergyDesc *prometheus.Desc
+	gpuIdlePowerDesc          *prometheus.Desc
+
+	// GPU power over the latest interval: measured vs attributed to processes
+	gpuMeasuredPowerDesc   *prometheus.Desc
+	gpuAttributedPowerDesc *prometheus.Desc
+
+	// Attribution accuracy self-check
+	gpuResidualDesc      *prometheus.Desc
+	gpuRelativeErrorDesc *prometheus.Desc
+	gpuErrorRatioDesc    *prometheus.Desc
+	gpuErrorExceededDesc *prometheus.Desc
+
+	// GPU sharing configuration
+	gpuSharingInfoDesc     *prometheus.Desc
+	gpuSharingReplicasDesc *prometheus.Desc
+
+	// Kubelet GPU allocations
+	gpuAllocationInfoDesc *prometheus.Desc
+
+	// Kubernetes API client
+	kubernetesAPIRequestsDesc *prometheus.Desc
+
+	// Allowlisted pod labels and annotations, on per-process series or on a pod
+	// info metric (nil unless --pod-metadata-target=info and an allowlist is set)
+	podMetadataOnSeries bool
+	podInfoDesc         *prometheus.Desc
+
+	// Device-level metrics
+	device deviceDescs
 }
 
 // NewExporter creates a new Prometheus exporter
@@ -33,35 +72,80 @@ func NewExporter(cfg *config.Config, col *collector.Collector) *Exporter {
 
 	// Common labels for all metrics
 	// Use exported_ prefix for pod/namespace/container to match DCGM convention
-	labels := []string{"pid", "gpu", "process_name", "exported_pod", "exported_namespace", "exported_container", "container_id"}
+	// MIG labels are empty for processes on whole GPUs
+	labels := []string{"pid", "gpu", "gpu_uuid", "pci_bus_id", "modelName", "hostname", "gpu_instance_id", "compute_instance_id", "mig_profile", "process_name", "exported_pod", "exported_namespace", "exported_container", "container_id"}
+
+	// Allowlisted pod labels and annotations (label_<name>, annotation_<name>),
+	// validated when the collector was created
+	podMetadataLabels, _ := cfg.PodMetadataLabels()
+	podMetadataOnSeries := cfg.PodMetadataTarget == config.PodMetadataSeries && len(podMetadataLabels) > 0
+	if podMetadataOnSeries {
+		labels = append(labels, podMetadataLabels...)
+	}
 
-	// Energy metric has additional label to indicate if estimated
-	energyLabels := append(labels, "energy_estimated")
+	var podInfoDesc *prometheus.Desc
+	if cfg.PodMetadataTarget == config.PodMetadataInfo && len(podMetadataLabels) > 0 {
+		podInfoDesc = prometheus.NewDesc(
+			fmt.Sprintf("%s_pod_info", prefix),
+			"Allowlisted labels and annotations of pods with GPU processes, always 1; join on exported_namespace and exported_pod",
+			append([]string{"hostname", "exported_pod", "exported_namespace"}, podMetadataLabels...),
+			nil,
+		)
+	}
+
+	// GPU identity labels, shared by per-process and per-GPU metrics
+	gpuLabels := []string{"gpu", "gpu_uuid", "pci_bus_id", "modelName", "hostname"}
+
+	// Energy metric has an additional label naming the attribution model used while the GPU is shared
+	// It is fixed for a process's lifetime so the counter stays a single continuous series
+	energyLabels := append(append([]string{}, labels...), "energy_model")
+
+	// Gauges also carry how the GPU is shared and which kinds of context the process
+	// holds; both can change while a process runs, so the energy counters leave them
+	// out to stay continuous
+	gaugeLabels := append(append([]string{}, labels...), "sharing_mode", "context_type")
 
 	return &Exporter{
 		config:    cfg,
 		collector: col,
 
+		podMetadataOnSeries: podMetadataOnSeries,
+		podInfoDesc:         podInfoDesc,
+
 		// Energy metric - may be measured or estimated (indicated by label)
 		energyDesc: prometheus.NewDesc(
 			fmt.Sprintf("%s_energy_joules_total", prefix),
-			"Cumulative energy consumed by process in Joules (energy_estimated=true if SM-based estimation used)",
+			"Cumulative energy consumed by process in Joules, measured while the GPU is exclusive and estimated while it is shared",
 			energyLabels,
 			nil,
 		),
 
+		energySourceDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_energy_by_source_joules_total", prefix),
+			"Cumulative energy consumed by process in Joules by source (measured or estimated), summing to energy_joules_total",
+			append(append([]string{}, labels...), "source"),
+			nil,
+		),
+
+		powerDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_power_watts", prefix),
+			"Power attributed to process over the latest attribution interval in watts",
+			gaugeLabels,
+			nil,
+		),
+
 		// Utilization metrics
 		smUtilDesc: prometheus.NewDesc(
 			fmt.Sprintf("%s_sm_utilization_ratio", prefix),
 			"SM (Streaming Multiprocessor) utilization ratio (0.0-1.0)",
-			labels,
+			gaugeLabels,
 			nil,
 		),
 
 		memUtilDesc: prometheus.NewDesc(
 			fmt.Sprintf("%s_memory_utilization_ratio", prefix),
 			"Memory utilization ratio (0.0-1.0)",
-			labels,
+			gaugeLabels,
 			nil,
 		),
 
@@ -69,7 +153,7 @@ func NewExporter(cfg *config.Config, col *collector.Collector) *Exporter {
 		memoryUsedDesc: prometheus.NewDesc(
 			fmt.Sprintf("%s_memory_used_bytes", prefix),
 			"GPU memory used by process in bytes",
-			labels,
+			gaugeLabels,
 			nil,
 		),
 
@@ -77,14 +161,14 @@ func NewExporter(cfg *config.Config, col *collector.Collector) *Exporter {
 		startTimeDesc: prometheus.NewDesc(
 			fmt.Sprintf("%s_start_time_seconds", prefix),
 			"Process start time in seconds since epoch",
-			labels,
+			gaugeLabels,
 			nil,
 		),
 
 		activeDesc: prometheus.NewDesc(
 			fmt.Sprintf("%s_active", prefix),
 			"Process active status (1=running, 0=exited)",
-			labels,
+			gaugeLabels,
 			nil,
 		),
 
@@ -92,22 +176,125 @@ func NewExporter(cfg *config.Config, col *collector.Collector) *Exporter {
 		gpuEnergyTotalDesc: prometheus.NewDesc(
 			fmt.Sprintf("%s_gpu_energy_joules_total", prefix),
 			"Total energy consumed by all processes on this GPU (sum of per-process energy)",
-			[]string{"gpu"},
+			gpuLabels,
 			nil,
 		),
 
 		gpuProcessCountDesc: prometheus.NewDesc(
 			fmt.Sprintf("%s_gpu_process_count", prefix),
 			"Number of active processes on this GPU (indicates time-slicing when > 1)",
-			[]string{"gpu"},
+			gpuLabels,
 			nil,
 		),
+
+		// GPU energy accounting
+		gpuIdleEnergyDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_idle_energy_joules_total", prefix),
+			"GPU energy consumed while idle (no processes, or idle baseline not spread to processes) in Joules",
+			gpuLabels,
+			nil,
+		),
+
+		gpuAttributedEnergyDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_attributed_energy_joules_total", prefix),
+			"GPU energy attributed to processes in Joules",
+			gpuLabels,
+			nil,
+		),
+
+		gpuUnattributedEnergyDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_unattributed_energy_joules_total", prefix),
+			"GPU energy consumed by processes that could not be attributed to any of them in Joules",
+			gpuLabels,
+			nil,
+		),
+
+		gpuIdlePowerDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_idle_power_watts", prefix),
+			"Idle power baseline in use for this GPU (source: override, calibrated or configured)",
+			append(append([]string{}, gpuLabels...), "source"),
+			nil,
+		),
+
+		gpuMeasuredPowerDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_measured_power_watts", prefix),
+			"GPU power measured over the latest attribution interval in watts",
+			gpuLabels,
+			nil,
+		),
+
+		gpuAttributedPowerDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_attributed_power_watts", prefix),
+			"GPU power attributed to processes over the latest attribution interval in watts",
+			gpuLabels,
+			nil,
+		),
+
+		gpuResidualDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_attribution_residual_joules", prefix),
+			"Device energy that should have gone to processes minus energy added to process counters, over the latest check window",
+			gpuLabels,
+			nil,
+		),
+
+		gpuRelativeErrorDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_attribution_relative_error", prefix),
+			"Attribution residual divided by the expected energy, over the latest check window",
+			gpuLabels,
+			nil,
+		),
+
+		gpuErrorRatioDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_attribution_error_ratio", prefix),
+			"Absolute relative attribution error per check window",
+			gpuLabels,
+			nil,
+		),
+
+		gpuErrorExceededDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_attribution_error_threshold_exceeded_total", prefix),
+			"Check windows whose absolute relative attribution error exceeded --attribution-error-threshold",
+			gpuLabels,
+			nil,
+		),
+
+		gpuSharingInfoDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_sharing_info", prefix),
+			"How this GPU is configured to be shared (configured_mode: exclusive, time-slicing, mps or mig), always 1",
+			append(append([]string{}, gpuLabels...), "configured_mode", "mig_mode", "compute_mode", "mps_daemon"),
+			nil,
+		),
+
+		gpuSharingReplicasDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_sharing_replicas", prefix),
+			"Replicas the device plugin advertises for this GPU (mechanism: time-slicing or mps)",
+			append(append([]string{}, gpuLabels...), "mechanism"),
+			nil,
+		),
+
+		gpuAllocationInfoDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_gpu_allocation_info", prefix),
+			"GPU or MIG device (device_id) the kubelet allocated to a pod container, with or without running processes, always 1",
+			append(append([]string{}, gpuLabels...), "device_id", "resource", "exported_pod", "exported_namespace", "exported_container"),
+			nil,
+		),
+
+		kubernetesAPIRequestsDesc: prometheus.NewDesc(
+			fmt.Sprintf("%s_kubernetes_api_requests_total", prefix),
+			"Requests to the Kubernetes API server watching this node's pods (result: success, unauthorized, forbidden or error)",
+			[]string{"hostname", "result"},
+			nil,
+		),
+
+		device: newDeviceDescs(prefix, gpuLabels),
 	}
 }
 
 // Describe implements prometheus.Collector
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.energyDesc
+	ch <- e.energySourceDesc
+	ch <- e.powerDesc
 	ch <- e.smUtilDesc
 	ch <- e.memUtilDesc
 	ch <- e.memoryUsedDesc
@@ -115,40 +302,65 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.activeDesc
 	ch <- e.gpuEnergyTotalDesc
 	ch <- e.gpuProcessCountDesc
+	ch <- e.gpuIdleEnergyDesc
+	ch <- e.gpuAttributedEnergyDesc
+	ch <- e.gpuUnattributedEnergyDesc
+	ch <- e.gpuIdlePowerDesc
+	ch <- e.gpuMeasuredPowerDesc
+	ch <- e.gpuAttributedPowerDesc
+	ch <- e.gpuResidualDesc
+	ch <- e.gpuRelativeErrorDesc
+	ch <- e.gpuErrorRatioDesc
+	ch <- e.gpuErrorExceededDesc
+	ch <- e.gpuSharingInfoDesc
+	ch <- e.gpuSharingReplicasDesc
+	ch <- e.gpuAllocationInfoDesc
+	ch <- e.kubernetesAPIRequestsDesc
+	if e.podInfoDesc != nil {
+		ch <- e.podInfoDesc
+	}
+	e.device.describe(ch)
 }
 
 // Collect implements prometheus.Collector
+// Reads the snapshot maintained by the collector's sampling loop; scrapes never
+// trigger collection, so scrape frequency does not affect energy estimation
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	// Trigger collection
-	if err := e.collector.Collect(); err != nil {
-		slog.Error("Collection failed", slog.String("error", err.Error()))
-		return
-	}
-
 	// Get metrics
 	metrics := e.collector.GetMetrics()
+	devices := e.collector.GetDevices()
 
 	slog.Debug("Exporting metrics", slog.Int("process_count", len(metrics)))
 
 	for _, pm := range metrics {
 		// Build label values
-		labels := []string{
-			fmt.Sprintf("%d", pm.PID),
-			fmt.Sprintf("%d", pm.GPU),
+		var gpuInstanceID, computeInstanceID, migProfile string
+		if pm.MIG != nil {
+			gpuInstanceID = fmt.Sprintf("%d", pm.MIG.GPUInstanceID)
+			computeInstanceID = fmt.Sprintf("%d", pm.MIG.ComputeInstanceID)
+			migProfile = pm.MIG.Profile
+		}
+
+		labels := []string{fmt.Sprintf("%d", pm.PID)}
+		labels = append(labels, e.gpuLabelValues(pm.GPU, devices)...)
+		labels = append(labels,
+			gpuInstanceID,
+			computeInstanceID,
+			migProfile,
 			pm.ProcessName,
 			pm.PodName,
 			pm.PodNamespace,
 			pm.ContainerName,
 			pm.ContainerID,
+		)
+		if e.podMetadataOnSeries {
+			labels = append(labels, e.podMetadataValues(pm)...)
 		}
 
+		gaugeLabels := append(append([]string{}, labels...), pm.SharingMode, pm.ContextType)
+
 		// Energy - COUNTER (cumulative)
-		// Include energy_estimated label to indicate if value is estimated or measured
-		estimatedLabel := "false"
-		if pm.EnergyEstimated {
-			estimatedLabel = "true"
-		}
-		energyLabels := append(labels, estimatedLabel)
+		energyLabels := append(append([]string{}, labels...), pm.EnergyModel)
 
 		ch <- prometheus.MustNewConstMetric(
 			e.energyDesc,
@@ -157,12 +369,35 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 			energyLabels...,
 		)
 
+		// Energy by source - COUNTERS, measured + estimated = total
+		for source, joules := range map[string]float64{
+			collector.EnergySourceMeasured:  pm.MeasuredEnergyJoules,
+			collector.EnergySourceEstimated: pm.EstimatedEnergyJoules,
+		} {
+			ch <- prometheus.MustNewConstMetric(
+				e.energySourceDesc,
+				prometheus.CounterValue,
+				joules,
+				append(append([]string{}, labels...), source)...,
+			)
+		}
+
+		// Power - GAUGE, skipped until the process has been attributed an interval
+		if !math.IsNaN(pm.PowerWatts) {
+			ch <- prometheus.MustNewConstMetric(
+				e.powerDesc,
+				prometheus.GaugeValue,
+				pm.PowerWatts,
+				gaugeLabels...,
+			)
+		}
+
 		// SM Utilization - GAUGE
 		ch <- prometheus.MustNewConstMetric(
 			e.smUtilDesc,
 			prometheus.GaugeValue,
 			pm.SmUtilization,
-			labels...,
+			gaugeLabels...,
 		)
 
 		// Memory Utilization - GAUGE
@@ -170,7 +405,7 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 			e.memUtilDesc,
 			prometheus.GaugeValue,
 			pm.MemUtilization,
-			labels...,
+			gaugeLabels...,
 		)
 
 		// Memory Used - GAUGE
@@ -178,7 +413,7 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 			e.memoryUsedDesc,
 			prometheus.GaugeValue,
 			float64(pm.MemoryUsedBytes),
-			labels...,
+			gaugeLabels...,
 		)
 
 		// Start Time - GAUGE
@@ -186,7 +421,7 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 			e.startTimeDesc,
 			prometheus.GaugeValue,
 			float64(pm.StartTime.Unix()),
-			labels...,
+			gaugeLabels...,
 		)
 
 		// Active Status - GAUGE
@@ -198,16 +433,164 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 			e.activeDesc,
 			prometheus.GaugeValue,
 			activeValue,
-			labels...,
+			gaugeLabels...,
 		)
 	}
 
 	// Export GPU-level aggregation metrics (for time-slicing validation)
-	e.exportGPUAggregations(ch, metrics)
+	e.exportGPUAggregations(ch, metrics, devices)
+
+	// Export GPU sharing configuration
+	e.exportGPUSharing(ch, devices)
+
+	// Export kubelet GPU allocations
+	e.exportGPUAllocations(ch, devices)
+
+	// Export allowlisted pod labels and annotations
+	e.exportPodInfo(ch, metrics)
+
+	// Export Kubernetes API client health
+	e.exportKubernetesAPIStats(ch)
+
+	// Export device-level metrics
+	e.exportDeviceMetrics(ch, e.collector.GetDeviceMetrics(), devices)
+}
+
+// exportGPUSharing exports how each GPU is configured to be shared
+func (e *Exporter) exportGPUSharing(ch chan<- prometheus.Metric, devices map[uint]process.DeviceInfo) {
+	for gpuID, sharing := range e.collector.GetGPUSharing() {
+		labels := e.gpuLabelValues(gpuID, devices)
+
+		migMode := "disabled"
+		if sharing.MIGEnabled {
+			migMode = "enabled"
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			e.gpuSharingInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			append(labels, sharing.Mode, migMode, sharing.ComputeMode, fmt.Sprintf("%t", sharing.MPSDaemon))...,
+		)
+
+		for mechanism, replicas := range map[string]int{
+			collector.SharingModeTimeSlicing: sharing.TimeSlicingReplicas,
+			collector.SharingModeMPS:         sharing.MPSReplicas,
+		} {
+			if replicas > 0 {
+				ch <- prometheus.MustNewConstMetric(
+					e.gpuSharingReplicasDesc,
+					prometheus.GaugeValue,
+					float64(replicas),
+					append(append([]string{}, labels...), mechanism)...,
+				)
+			}
+		}
+	}
+}
+
+// exportGPUAllocations exports which pod containers the kubelet allocated each device to
+// GPU identity labels are empty for devices that are not in the inventory
+func (e *Exporter) exportGPUAllocations(ch chan<- prometheus.Metric, devices map[uint]process.DeviceInfo) {
+	for _, allocation := range e.collector.GetGPUAllocations() {
+		labels := []string{"", "", "", "", e.config.Hostname}
+		if allocation.GPUKnown {
+			labels = e.gpuLabelValues(allocation.GPU, devices)
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			e.gpuAllocationInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			append(labels,
+				allocation.DeviceID,
+				allocation.ResourceName,
+				allocation.PodName,
+				allocation.PodNamespace,
+				allocation.ContainerName,
+			)...,
+		)
+	}
+}
+
+// podMetadataValues returns the values of the allowlisted pod labels and
+// annotations of a process, in the order of config.PodMetadataLabels
+// Labels and annotations the pod does not have are empty
+func (e *Exporter) podMetadataValues(pm *collector.ProcessMetrics) []string {
+	values := make([]string, 0, len(e.config.PodLabelsAllowlist)+len(e.config.PodAnnotationsAllowlist))
+	for _, key := range e.config.PodLabelsAllowlist {
+		values = append(values, pm.PodLabels[key])
+	}
+	for _, key := range e.config.PodAnnotationsAllowlist {
+		values = append(values, pm.PodAnnotations[key])
+	}
+	return values
+}
+
+// exportPodInfo exports one pod info series per pod with GPU processes
+// Pods live as long as their processes' series, exited ones included, so
+// short-lived pods can still be joined within the retention period
+func (e *Exporter) exportPodInfo(ch chan<- prometheus.Metric, metrics map[collector.ProcessKey]*collector.ProcessMetrics) {
+	if e.podInfoDesc == nil {
+		return
+	}
+
+	exported := make(map[string]bool)
+	for _, pm := range metrics {
+		key := pm.PodNamespace + "/" + pm.PodName
+		if pm.PodName == "" || exported[key] {
+			continue
+		}
+		exported[key] = true
+
+		ch <- prometheus.MustNewConstMetric(
+			e.podInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			append([]string{e.config.Hostname, pm.PodName, pm.PodNamespace}, e.podMetadataValues(pm)...)...,
+		)
+	}
+}
+
+// exportKubernetesAPIStats exports Kubernetes API requests by result, so that
+// authentication and RBAC failures can be alerted on
+// Every result is exported, starting at 0, once the API server is used
+func (e *Exporter) exportKubernetesAPIStats(ch chan<- prometheus.Metric) {
+	stats, ok := e.collector.GetKubernetesAPIStats()
+	if !ok {
+		return
+	}
+
+	for _, result := range []string{
+		kubernetes.APIResultSuccess,
+		kubernetes.APIResultUnauthorized,
+		kubernetes.APIResultForbidden,
+		kubernetes.APIResultError,
+	} {
+		ch <- prometheus.MustNewConstMetric(
+			e.kubernetesAPIRequestsDesc,
+			prometheus.CounterValue,
+			float64(stats[result]),
+			e.config.Hostname, result,
+		)
+	}
+}
+
+// gpuLabelValues returns the GPU identity label values for a GPU index
+// Identity labels are empty if the device inventory is unavailable
+func (e *Exporter) gpuLabelValues(gpuID uint, devices map[uint]process.DeviceInfo) []string {
+	info := devices[gpuID]
+	return []string{
+		fmt.Sprintf("%d", gpuID),
+		info.UUID,
+		info.PCIBusID,
+		info.ModelName,
+		e.config.Hostname,
+	}
 }
 
 // exportGPUAggregations exports aggregated metrics per GPU
-func (e *Exporter) exportGPUAggregations(ch chan<- prometheus.Metric, metrics map[uint]*collector.ProcessMetrics) {
+func (e *Exporter) exportGPUAggregations(ch chan<- prometheus.Metric, metrics map[collector.ProcessKey]*collector.ProcessMetrics, devices map[uint]process.DeviceInfo) {
 	// Aggregate energy and count processes per GPU
 	gpuEnergy := make(map[uint]float64)
 	gpuProcessCount := make(map[uint]int)
@@ -225,7 +608,7 @@ func (e *Exporter) exportGPUAggregations(ch chan<- prometheus.Metric, metrics ma
 			e.gpuEnergyTotalDesc,
 			prometheus.CounterValue,
 			totalEnergy,
-			fmt.Sprintf("%d", gpuID),
+			e.gpuLabelValues(gpuID, devices)...,
 		)
 	}
 
@@ -234,7 +617,33 @@ func (e *Exporter) exportGPUAggregations(ch chan<- prometheus.Metric, metrics ma
 			e.gpuProcessCountDesc,
 			prometheus.GaugeValue,
 			float64(processCount),
-			fmt.Sprintf("%d", gpuID),
+			e.gpuLabelValues(gpuID, devices)...,
 		)
 	}
+
+	for gpuID, account := range e.collector.GetEnergyAccounts() {
+		labels := e.gpuLabelValues(gpuID, devices)
+		ch <- prometheus.MustNewConstMetric(e.gpuIdleEnergyDesc, prometheus.CounterValue, account.IdleJoules, labels...)
+		ch <- prometheus.MustNewConstMetric(e.gpuAttributedEnergyDesc, prometheus.CounterValue, account.AttributedJoules, labels...)
+		ch <- prometheus.MustNewConstMetric(e.gpuUnattributedEnergyDesc, prometheus.CounterValue, account.UnattributedJoules, labels...)
+	}
+
+	for gpuID, idle := range e.collector.GetIdlePower() {
+		labels := append(e.gpuLabelValues(gpuID, devices), idle.Source)
+		ch <- prometheus.MustNewConstMetric(e.gpuIdlePowerDesc, prometheus.GaugeValue, idle.Watts, labels...)
+	}
+
+	for gpuID, power := range e.collector.GetGPUPower() {
+		labels := e.gpuLabelValues(gpuID, devices)
+		ch <- prometheus.MustNewConstMetric(e.gpuMeasuredPowerDesc, prometheus.GaugeValue, power.MeasuredWatts, labels...)
+		ch <- prometheus.MustNewConstMetric(e.gpuAttributedPowerDesc, prometheus.GaugeValue, power.AttributedWatts, labels...)
+	}
+
+	for gpuID, accuracy := range e.collector.GetAttributionAccuracy() {
+		labels := e.gpuLabelValues(gpuID, devices)
+		ch <- prometheus.MustNewConstMetric(e.gpuResidualDesc, prometheus.GaugeValue, accuracy.ResidualJoules, labels...)
+		ch <- prometheus.MustNewConstMetric(e.gpuRelativeErrorDesc, prometheus.GaugeValue, accuracy.RelativeError, labels...)
+		ch <- prometheus.MustNewConstHistogram(e.gpuErrorRatioDesc, accuracy.Count, accuracy.Sum, accuracy.Buckets, labels...)
+		ch <- prometheus.MustNewConstMetric(e.gpuErrorExceededDesc, prometheus.CounterValue, float64(accuracy.Exceeded), labels...)
+	}
 }
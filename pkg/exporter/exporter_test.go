@@ -0,0 +1,345 @@
+package exporter
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vimalk78/my-gpu-exporter/pkg/backend"
+	"github.com/vimalk78/my-gpu-exporter/pkg/collector"
+	"github.com/vimalk78/my-gpu-exporter/pkg/config"
+	"github.com/vimalk78/my-gpu-exporter/pkg/dcgm"
+	"github.com/vimalk78/my-gpu-exporter/pkg/process"
+)
+
+// newTestExporter creates an exporter over a collector backed by a fake backend
+func newTestExporter(t *testing.T) (*Exporter, *collector.Collector, *backend.Fake) {
+	t.Helper()
+
+	t.Setenv("PROC_ROOT", t.TempDir())
+
+	cfg := config.NewConfig()
+	cfg.KubernetesEnabled = false
+	cfg.DCGMUpdateFrequency = 1 * time.Second
+	cfg.Hostname = "node-1"
+	cfg.IdlePowerStateFile = ""
+
+	fake := backend.NewFake()
+	col, err := collector.NewCollectorWithBackend(cfg, fake)
+	if err != nil {
+		t.Fatalf("NewCollectorWithBackend failed: %v", err)
+	}
+
+	return NewExporter(cfg, col), col, fake
+}
+
+// TestExporter_DeviceMetrics tests device metrics, unit conversion and skipping of unsupported values
+func TestExporter_DeviceMetrics(t *testing.T) {
+	e, col, fake := newTestExporter(t)
+
+	fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa", PCIBusID: "00000000:3B:00.0", ModelName: "NVIDIA A100-SXM4-40GB"})
+
+	dm := dcgm.NewDeviceMetrics(0)
+	dm.PowerWatts = 250
+	dm.SMClockMHz = 1410
+	dm.ThrottleReasons = 0x4 // sw_power_cap
+	dm.ThrottleReasonsSupported = true
+	dm.TemperatureCelsius = math.NaN() // unsupported
+	fake.SetDeviceMetrics(dm)
+
+	if err := col.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	expected := `
+# HELP my_gpu_process_device_power_watts Current GPU power draw in watts
+# TYPE my_gpu_process_device_power_watts gauge
+my_gpu_process_device_power_watts{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="NVIDIA A100-SXM4-40GB",pci_bus_id="00000000:3B:00.0"} 250
+# HELP my_gpu_process_device_sm_clock_hertz Current SM clock in hertz
+# TYPE my_gpu_process_device_sm_clock_hertz gauge
+my_gpu_process_device_sm_clock_hertz{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="NVIDIA A100-SXM4-40GB",pci_bus_id="00000000:3B:00.0"} 1.41e+09
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"my_gpu_process_device_power_watts", "my_gpu_process_device_sm_clock_hertz"); err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(e, "my_gpu_process_device_temperature_celsius"); n != 0 {
+		t.Errorf("Expected unsupported temperature to be skipped, got %d series", n)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(e)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+
+	active := map[string]float64{}
+	for _, mf := range families {
+		if mf.GetName() != "my_gpu_process_device_throttle_reason" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "reason" {
+					active[l.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+
+	if len(active) != len(dcgm.ThrottleReasons) {
+		t.Errorf("Expected %d throttle reasons, got %d", len(dcgm.ThrottleReasons), len(active))
+	}
+	if active["sw_power_cap"] != 1 || active["gpu_idle"] != 0 {
+		t.Errorf("Unexpected throttle reasons: %v", active)
+	}
+}
+
+// TestExporter_GPUSharing tests the per-GPU sharing info metric
+func TestExporter_GPUSharing(t *testing.T) {
+	e, col, fake := newTestExporter(t)
+
+	fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa", PCIBusID: "00000000:3B:00.0", ModelName: "NVIDIA A100-SXM4-40GB"})
+	fake.SetDeviceModes(0, process.DeviceModes{MIGEnabled: true, ComputeMode: process.ComputeModeDefault})
+
+	if err := col.Collect(); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	expected := `
+# HELP my_gpu_process_gpu_sharing_info How this GPU is configured to be shared (configured_mode: exclusive, time-slicing, mps or mig), always 1
+# TYPE my_gpu_process_gpu_sharing_info gauge
+my_gpu_process_gpu_sharing_info{compute_mode="default",configured_mode="mig",gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",mig_mode="enabled",modelName="NVIDIA A100-SXM4-40GB",mps_daemon="false",pci_bus_id="00000000:3B:00.0"} 1
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "my_gpu_process_gpu_sharing_info"); err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(e, "my_gpu_process_gpu_sharing_replicas"); n != 0 {
+		t.Errorf("Expected no replicas without a device plugin config, got %d series", n)
+	}
+}
+
+// TestExporter_AttributionErrorHistogram tests that the attribution error histogram
+// exports every configured bucket, including buckets no window has hit
+func TestExporter_AttributionErrorHistogram(t *testing.T) {
+	e, col, fake := newTestExporter(t)
+
+	// Two containers without utilization: nothing can be attributed, a relative error of 1
+	procRoot := os.Getenv("PROC_ROOT")
+	for _, pid := range []uint{100, 101} {
+		dir := filepath.Join(procRoot, fmt.Sprintf("%d", pid))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("failed to create fake proc dir: %v", err)
+		}
+		cgroup := fmt.Sprintf("0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-poduid_%d.slice/cri-containerd-c%d.scope\n", pid, pid)
+		if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0o644); err != nil {
+			t.Fatalf("failed to write fake cgroup: %v", err)
+		}
+		fake.SetProcess(
+			process.ProcessInfo{PID: pid, GPU: 0, MemoryUsed: 1024},
+			&dcgm.ProcessMetrics{PID: pid, GPU: 0, IsRunning: true},
+		)
+	}
+	fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa"})
+
+	for _, joules := range []float64{1000, 1200} {
+		fake.SetTotalEnergy(0, joules)
+		if err := col.Collect(); err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+	}
+
+	expected := `
+# HELP my_gpu_process_gpu_attribution_error_ratio Absolute relative attribution error per check window
+# TYPE my_gpu_process_gpu_attribution_error_ratio histogram
+my_gpu_process_gpu_attribution_error_ratio_bucket{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id="",le="0.01"} 0
+my_gpu_process_gpu_attribution_error_ratio_bucket{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id="",le="0.02"} 0
+my_gpu_process_gpu_attribution_error_ratio_bucket{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id="",le="0.05"} 0
+my_gpu_process_gpu_attribution_error_ratio_bucket{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id="",le="0.1"} 0
+my_gpu_process_gpu_attribution_error_ratio_bucket{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id="",le="0.2"} 0
+my_gpu_process_gpu_attribution_error_ratio_bucket{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id="",le="0.5"} 0
+my_gpu_process_gpu_attribution_error_ratio_bucket{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id="",le="1"} 1
+my_gpu_process_gpu_attribution_error_ratio_bucket{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id="",le="+Inf"} 1
+my_gpu_process_gpu_attribution_error_ratio_sum{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id=""} 1
+my_gpu_process_gpu_attribution_error_ratio_count{gpu="0",gpu_uuid="GPU-aaaa",hostname="node-1",modelName="",pci_bus_id=""} 1
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "my_gpu_process_gpu_attribution_error_ratio"); err != nil {
+		t.Error(err)
+	}
+}
+
+// newPodMetadataTestExporter creates an exporter whose collector watches a fake API
+// server with one pod, "ml/trainer", running process 100 in container "abc"
+func newPodMetadataTestExporter(t *testing.T, target string) (*Exporter, *collector.Collector) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") == "1" {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, `{"metadata": {"resourceVersion": "1"}, "items": [{
+			"metadata": {
+				"name": "trainer", "namespace": "ml", "uid": "uid-1",
+				"labels": {"team": "vision", "cost-center": "cc-42", "pod-template-hash": "abc123"},
+				"annotations": {"owner.example.com/workload": "job-7"}
+			},
+			"status": {"containerStatuses": [{"name": "main", "containerID": "containerd://abc"}]}
+		}]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	err := os.WriteFile(kubeconfig, []byte(fmt.Sprintf(`current-context: test
+contexts: [{name: test, context: {cluster: test, user: test}}]
+clusters: [{name: test, cluster: {server: %s}}]
+users: [{name: test, user: {token: token}}]
+`, server.URL)), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+
+	// The socket only needs to exist; pods are then found through the watch
+	socket := filepath.Join(dir, "kubelet.sock")
+	if err := os.WriteFile(socket, nil, 0o600); err != nil {
+		t.Fatalf("failed to create socket placeholder: %v", err)
+	}
+
+	procRoot := t.TempDir()
+	t.Setenv("PROC_ROOT", procRoot)
+	if err := os.MkdirAll(filepath.Join(procRoot, "100"), 0o755); err != nil {
+		t.Fatalf("failed to create fake proc dir: %v", err)
+	}
+	cgroup := "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-poduid_1.slice/cri-containerd-abc.scope\n"
+	if err := os.WriteFile(filepath.Join(procRoot, "100", "cgroup"), []byte(cgroup), 0o644); err != nil {
+		t.Fatalf("failed to write fake cgroup: %v", err)
+	}
+
+	cfg := config.NewConfig()
+	cfg.DCGMUpdateFrequency = 1 * time.Second
+	cfg.Hostname = "node-1"
+	cfg.IdlePowerStateFile = ""
+	cfg.KubernetesEnabled = true
+	cfg.PodResourcesSocket = socket
+	cfg.NodeName = "node-1"
+	cfg.Kubeconfig = kubeconfig
+	cfg.PodLabelsAllowlist = []string{"team", "cost-center"}
+	cfg.PodAnnotationsAllowlist = []string{"owner.example.com/workload"}
+	cfg.PodMetadataTarget = target
+
+	fake := backend.NewFake()
+	fake.SetDevice(process.DeviceInfo{Index: 0, UUID: "GPU-aaaa"})
+	fake.SetProcess(
+		process.ProcessInfo{PID: 100, GPU: 0, MemoryUsed: 1024},
+		&dcgm.ProcessMetrics{PID: 100, GPU: 0, ProcessName: "python", IsRunning: true},
+	)
+
+	col, err := collector.NewCollectorWithBackend(cfg, fake)
+	if err != nil {
+		t.Fatalf("NewCollectorWithBackend failed: %v", err)
+	}
+	t.Cleanup(func() { col.Shutdown() })
+
+	// Collect until the watch has listed the pod
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := col.Collect(); err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+		if pm := col.GetMetrics()[collector.ProcessKey{PID: 100, GPU: 0}]; pm != nil && pm.PodLabels != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for pod labels")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return NewExporter(cfg, col), col
+}
+
+// TestExporter_PodInfo tests that allowlisted pod labels and annotations are
+// exported on a pod info metric, and only there, by default
+func TestExporter_PodInfo(t *testing.T) {
+	e, _ := newPodMetadataTestExporter(t, config.PodMetadataInfo)
+
+	expected := `
+# HELP my_gpu_process_pod_info Allowlisted labels and annotations of pods with GPU processes, always 1; join on exported_namespace and exported_pod
+# TYPE my_gpu_process_pod_info gauge
+my_gpu_process_pod_info{annotation_owner_example_com_workload="job-7",exported_namespace="ml",exported_pod="trainer",hostname="node-1",label_cost_center="cc-42",label_team="vision"} 1
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "my_gpu_process_pod_info"); err != nil {
+		t.Error(err)
+	}
+
+	labels := metricLabels(t, e, "my_gpu_process_active")
+	if _, ok := labels["label_team"]; ok {
+		t.Errorf("Expected no pod labels on per-process series, got %v", labels)
+	}
+	if labels["exported_container"] != "main" {
+		t.Errorf("Expected container main, got %q", labels["exported_container"])
+	}
+}
+
+// TestExporter_PodMetadataOnSeries tests that allowlisted pod labels and
+// annotations are added to every per-process series when asked to
+func TestExporter_PodMetadataOnSeries(t *testing.T) {
+	e, _ := newPodMetadataTestExporter(t, config.PodMetadataSeries)
+
+	if n := testutil.CollectAndCount(e, "my_gpu_process_pod_info"); n != 0 {
+		t.Errorf("Expected no pod info metric, got %d series", n)
+	}
+
+	for _, name := range []string{"my_gpu_process_active", "my_gpu_process_energy_joules_total"} {
+		labels := metricLabels(t, e, name)
+		if labels["label_team"] != "vision" || labels["label_cost_center"] != "cc-42" ||
+			labels["annotation_owner_example_com_workload"] != "job-7" {
+			t.Errorf("Expected pod metadata labels on %s, got %v", name, labels)
+		}
+		if _, ok := labels["label_pod_template_hash"]; ok {
+			t.Errorf("Expected labels outside the allowlist to be dropped, got %v", labels)
+		}
+	}
+}
+
+// metricLabels returns the labels of the only series of a metric
+func metricLabels(t *testing.T, e *Exporter, name string) map[string]string {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(e)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("Expected one %s series, got %d", name, len(mf.GetMetric()))
+		}
+		labels := make(map[string]string)
+		for _, l := range mf.GetMetric()[0].GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		return labels
+	}
+
+	t.Fatalf("Metric %s not found", name)
+	return nil
+}
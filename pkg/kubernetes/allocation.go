@@ -0,0 +1,213 @@
+package kubernetes
+
+import (
+	"sort"
+	"strings"
+)
+
+// Allocation is a GPU or MIG device the kubelet allocated to a container
+type Allocation struct {
+	PodName       string
+	PodNamespace  string
+	ContainerName string
+	ResourceName  string // e.g. "nvidia.com/gpu" or "nvidia.com/mig-1g.5gb"
+	DeviceID      string // As advertised by the device plugin, e.g. "GPU-<uuid>::1" for a shared replica
+	UUID          string // GPU or MIG device UUID the device ID refers to
+}
+
+// ContainerRef is what the node knows about a container using GPUs, without the API server
+type ContainerRef struct {
+	ContainerID string   // From the cgroup of its processes
+	PodUID      string   // From the cgroup of its processes
+	DeviceUUIDs []string // GPU or MIG device UUID of every device its processes run on
+}
+
+// podContainer names a container of a pod
+type podContainer struct {
+	namespace, pod, container string
+}
+
+// podKey names the pod of a container
+func (p podContainer) podKey() string {
+	return p.namespace + "/" + p.pod
+}
+
+// DeviceUUID returns the GPU or MIG device UUID a device plugin device ID refers to
+// Time-slicing and MPS replicas are advertised as "<uuid>::<replica>"
+func DeviceUUID(deviceID string) string {
+	uuid, _, _ := strings.Cut(deviceID, "::")
+	return uuid
+}
+
+// isGPUResource reports whether a resource is an NVIDIA GPU, shared GPU or MIG resource
+func isGPUResource(name string) bool {
+	return strings.HasPrefix(name, nvidiaResourceName) || strings.HasPrefix(name, "nvidia.com/mig")
+}
+
+// ResolveContainers maps containers to the pod containers allocated the devices they run on
+//
+// A container's candidates are the pod containers allocated every device its
+// processes use. Devices shared through time-slicing or MPS are allocated to
+// several containers, so candidates are narrowed further: containers with the
+// same pod UID belong to one pod, and a pod (or a pod's container) claimed by
+// one UID (or container ID) cannot be another's. Containers that stay ambiguous
+// are left out, or get only pod labels if their pod is known.
+// The result is keyed by container ID.
+func ResolveContainers(allocations []Allocation, containers []ContainerRef) map[string]*PodInfo {
+	allocatedTo := make(map[string]map[podContainer]bool) // UUID -> pod containers
+	for _, a := range allocations {
+		if allocatedTo[a.UUID] == nil {
+			allocatedTo[a.UUID] = make(map[podContainer]bool)
+		}
+		allocatedTo[a.UUID][podContainer{a.PodNamespace, a.PodName, a.ContainerName}] = true
+	}
+
+	// Pod containers allocated every device of the container
+	// Devices without allocations (e.g. exposed through NVIDIA_VISIBLE_DEVICES=all) say nothing
+	candidates := make(map[string]map[podContainer]bool) // container ID -> pod containers
+	for _, ref := range containers {
+		var set map[podContainer]bool
+		for _, uuid := range ref.DeviceUUIDs {
+			allocated, ok := allocatedTo[uuid]
+			if !ok {
+				continue
+			}
+			if set == nil {
+				set = copySet(allocated)
+			} else {
+				set = intersect(set, allocated)
+			}
+		}
+		if len(set) > 0 {
+			candidates[ref.ContainerID] = set
+		}
+	}
+
+	// Pods possible for each pod UID: those of all its containers
+	podCandidates := make(map[string]map[string]bool) // pod UID -> pod keys
+	for _, ref := range containers {
+		set, ok := candidates[ref.ContainerID]
+		if !ok || ref.PodUID == "" {
+			continue
+		}
+
+		pods := make(map[string]bool)
+		for pc := range set {
+			pods[pc.podKey()] = true
+		}
+		if existing, ok := podCandidates[ref.PodUID]; ok {
+			pods = intersect(existing, pods)
+		}
+		podCandidates[ref.PodUID] = pods
+	}
+	eliminate(podCandidates)
+
+	// Keep the containers of the pod their UID resolved to, then narrow containers
+	for _, ref := range containers {
+		set, ok := candidates[ref.ContainerID]
+		if !ok {
+			continue
+		}
+		if pod, ok := single(podCandidates[ref.PodUID]); ok {
+			for pc := range set {
+				if pc.podKey() != pod {
+					delete(set, pc)
+				}
+			}
+		}
+	}
+	eliminate(candidates)
+
+	resolved := make(map[string]*PodInfo)
+	for _, ref := range containers {
+		if pc, ok := single(candidates[ref.ContainerID]); ok {
+			resolved[ref.ContainerID] = &PodInfo{
+				PodName:       pc.pod,
+				PodNamespace:  pc.namespace,
+				ContainerName: pc.container,
+				ContainerID:   ref.ContainerID,
+			}
+			continue
+		}
+
+		if pod, ok := single(podCandidates[ref.PodUID]); ok {
+			namespace, name, _ := strings.Cut(pod, "/")
+			resolved[ref.ContainerID] = &PodInfo{
+				PodName:      name,
+				PodNamespace: namespace,
+				ContainerID:  ref.ContainerID,
+			}
+		}
+	}
+
+	return resolved
+}
+
+// eliminate removes values claimed by a key with a single candidate from every other key,
+// until nothing changes; sets are never emptied
+func eliminate[K, V comparable](candidates map[K]map[V]bool) {
+	for changed := true; changed; {
+		changed = false
+		for key, set := range candidates {
+			value, ok := single(set)
+			if !ok {
+				continue
+			}
+			for other, otherSet := range candidates {
+				if other != key && otherSet[value] && len(otherSet) > 1 {
+					delete(otherSet, value)
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// single returns the only value of a set
+func single[V comparable](set map[V]bool) (V, bool) {
+	var only V
+	if len(set) != 1 {
+		return only, false
+	}
+	for value := range set {
+		only = value
+	}
+	return only, true
+}
+
+// intersect returns the values in both sets
+func intersect[V comparable](a, b map[V]bool) map[V]bool {
+	result := make(map[V]bool)
+	for value := range a {
+		if b[value] {
+			result[value] = true
+		}
+	}
+	return result
+}
+
+// copySet returns a copy of a set
+func copySet[V comparable](set map[V]bool) map[V]bool {
+	result := make(map[V]bool, len(set))
+	for value := range set {
+		result[value] = true
+	}
+	return result
+}
+
+// sortAllocations orders allocations by namespace, pod, container and device
+func sortAllocations(allocations []Allocation) {
+	sort.Slice(allocations, func(i, j int) bool {
+		a, b := allocations[i], allocations[j]
+		if a.PodNamespace != b.PodNamespace {
+			return a.PodNamespace < b.PodNamespace
+		}
+		if a.PodName != b.PodName {
+			return a.PodName < b.PodName
+		}
+		if a.ContainerName != b.ContainerName {
+			return a.ContainerName < b.ContainerName
+		}
+		return a.DeviceID < b.DeviceID
+	})
+}
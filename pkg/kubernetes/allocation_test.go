@@ -0,0 +1,184 @@
+package kubernetes
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// fakeKubelet serves a fixed pod-resources List response
+type fakeKubelet struct {
+	podresourcesapi.UnimplementedPodResourcesListerServer
+	response *podresourcesapi.ListPodResourcesResponse
+}
+
+// List implements PodResourcesListerServer
+func (k *fakeKubelet) List(context.Context, *podresourcesapi.ListPodResourcesRequest) (*podresourcesapi.ListPodResourcesResponse, error) {
+	return k.response, nil
+}
+
+// startFakeKubelet serves pod resources on a unix socket and returns its path
+func startFakeKubelet(t *testing.T, response *podresourcesapi.ListPodResourcesResponse) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "kubelet.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on fake kubelet socket: %v", err)
+	}
+
+	server := grpc.NewServer()
+	podresourcesapi.RegisterPodResourcesListerServer(server, &fakeKubelet{response: response})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return socket
+}
+
+// TestDeviceUUID tests that replica suffixes are stripped from device IDs
+func TestDeviceUUID(t *testing.T) {
+	tests := map[string]string{
+		"GPU-aaaa":    "GPU-aaaa",
+		"GPU-aaaa::3": "GPU-aaaa",
+		"MIG-bbbb":    "MIG-bbbb",
+		"MIG-bbbb::0": "MIG-bbbb",
+		"":            "",
+	}
+
+	for deviceID, expected := range tests {
+		if got := DeviceUUID(deviceID); got != expected {
+			t.Errorf("DeviceUUID(%q): expected %q, got %q", deviceID, expected, got)
+		}
+	}
+}
+
+// TestResolveContainers tests that shared devices are resolved by elimination
+// and that ambiguous containers keep only what is certain
+func TestResolveContainers(t *testing.T) {
+	allocation := func(pod, container, deviceID string) Allocation {
+		return Allocation{
+			PodName:       pod,
+			PodNamespace:  "ml",
+			ContainerName: container,
+			ResourceName:  nvidiaResourceName,
+			DeviceID:      deviceID,
+			UUID:          DeviceUUID(deviceID),
+		}
+	}
+
+	allocations := []Allocation{
+		// Exclusive GPU
+		allocation("train", "main", "GPU-a"),
+		// Replicas of a time-sliced GPU; infer also has GPU-b to itself
+		allocation("infer", "server", "GPU-s::0"),
+		allocation("infer", "server", "GPU-b"),
+		allocation("batch", "worker", "GPU-s::1"),
+		// Two containers of one pod and another pod on replicas of GPU-t; notebook also has GPU-u
+		allocation("pipeline", "prep", "GPU-t::0"),
+		allocation("pipeline", "fit", "GPU-t::1"),
+		allocation("notebook", "jupyter", "GPU-t::2"),
+		allocation("notebook", "jupyter", "GPU-u"),
+	}
+
+	containers := []ContainerRef{
+		{ContainerID: "c-train", PodUID: "uid-train", DeviceUUIDs: []string{"GPU-a"}},
+		{ContainerID: "c-infer", PodUID: "uid-infer", DeviceUUIDs: []string{"GPU-s", "GPU-b"}},
+		// Only GPU-s: resolved because infer already claimed its other replica
+		{ContainerID: "c-batch", PodUID: "uid-batch", DeviceUUIDs: []string{"GPU-s"}},
+		{ContainerID: "c-notebook", PodUID: "uid-notebook", DeviceUUIDs: []string{"GPU-t", "GPU-u"}},
+		// Both pipeline containers only use GPU-t: the pod is known, not which container is which
+		{ContainerID: "c-prep", PodUID: "uid-pipeline", DeviceUUIDs: []string{"GPU-t"}},
+		{ContainerID: "c-fit", PodUID: "uid-pipeline", DeviceUUIDs: []string{"GPU-t"}},
+		// Device not allocated through the kubelet
+		{ContainerID: "c-rogue", PodUID: "uid-rogue", DeviceUUIDs: []string{"GPU-z"}},
+	}
+
+	expected := map[string]*PodInfo{
+		"c-train":    {PodName: "train", PodNamespace: "ml", ContainerName: "main", ContainerID: "c-train"},
+		"c-infer":    {PodName: "infer", PodNamespace: "ml", ContainerName: "server", ContainerID: "c-infer"},
+		"c-batch":    {PodName: "batch", PodNamespace: "ml", ContainerName: "worker", ContainerID: "c-batch"},
+		"c-notebook": {PodName: "notebook", PodNamespace: "ml", ContainerName: "jupyter", ContainerID: "c-notebook"},
+		"c-prep":     {PodName: "pipeline", PodNamespace: "ml", ContainerID: "c-prep"},
+		"c-fit":      {PodName: "pipeline", PodNamespace: "ml", ContainerID: "c-fit"},
+	}
+
+	resolved := ResolveContainers(allocations, containers)
+	if !reflect.DeepEqual(resolved, expected) {
+		for id, info := range resolved {
+			t.Logf("%s: %+v", id, *info)
+		}
+		t.Errorf("Unexpected resolution")
+	}
+}
+
+// TestPodMapper_Resolve tests that GPU allocations listed by the kubelet resolve containers
+func TestPodMapper_Resolve(t *testing.T) {
+	socket := startFakeKubelet(t, &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Name:      "train",
+				Namespace: "ml",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name: "main",
+						Devices: []*podresourcesapi.ContainerDevices{
+							{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-a"}},
+							{ResourceName: "example.com/nic", DeviceIds: []string{"nic-0"}},
+						},
+					},
+					{Name: "sidecar"},
+				},
+			},
+			{
+				Name:      "slice",
+				Namespace: "ml",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name: "main",
+						Devices: []*podresourcesapi.ContainerDevices{
+							{ResourceName: "nvidia.com/mig-1g.5gb", DeviceIds: []string{"MIG-m"}},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	pm, err := NewPodMapper(socket, PodWatchOptions{})
+	if err != nil {
+		t.Fatalf("NewPodMapper failed: %v", err)
+	}
+
+	resolved, err := pm.Resolve([]ContainerRef{
+		{ContainerID: "c1", PodUID: "uid-train", DeviceUUIDs: []string{"GPU-a"}},
+		{ContainerID: "c2", PodUID: "uid-slice", DeviceUUIDs: []string{"MIG-m"}},
+	})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	if info := resolved["c1"]; info == nil || info.PodName != "train" || info.ContainerName != "main" {
+		t.Errorf("Expected c1 to resolve to train/main, got %+v", info)
+	}
+	if info := resolved["c2"]; info == nil || info.PodName != "slice" || info.ContainerName != "main" {
+		t.Errorf("Expected c2 to resolve to slice/main, got %+v", info)
+	}
+
+	allocations, err := pm.Allocations()
+	if err != nil {
+		t.Fatalf("Allocations failed: %v", err)
+	}
+
+	expected := []Allocation{
+		{PodName: "slice", PodNamespace: "ml", ContainerName: "main", ResourceName: "nvidia.com/mig-1g.5gb", DeviceID: "MIG-m", UUID: "MIG-m"},
+		{PodName: "train", PodNamespace: "ml", ContainerName: "main", ResourceName: "nvidia.com/gpu", DeviceID: "GPU-a", UUID: "GPU-a"},
+	}
+	if !reflect.DeepEqual(allocations, expected) {
+		t.Errorf("Expected allocations %+v, got %+v", expected, allocations)
+	}
+}
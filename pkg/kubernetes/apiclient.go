@@ -0,0 +1,362 @@
+package kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// Bound service account tokens are rotated by the kubelet well before they
+	// expire (after about an hour); re-reading them every minute follows rotation
+	tokenReloadInterval = 1 * time.Minute
+)
+
+// API request results counted in APIStats
+const (
+	APIResultSuccess      = "success"
+	APIResultUnauthorized = "unauthorized" // 401: token missing, expired or revoked
+	APIResultForbidden    = "forbidden"    // 403: RBAC does not allow the request
+	APIResultError        = "error"        // Connection, TLS or other HTTP errors
+)
+
+// errNoCredentials means there is neither a kubeconfig nor an in-cluster service account
+var errNoCredentials = errors.New("no kubeconfig and no in-cluster service account")
+
+// APIStats counts Kubernetes API requests by result (APIResult* constants)
+type APIStats map[string]uint64
+
+// apiClient is an authenticated, TLS-verifying client for the Kubernetes API server
+type apiClient struct {
+	baseURL string
+	client  *http.Client
+	token   *tokenFile // nil without bearer token authentication
+
+	requests sync.Map // Result -> *atomic.Uint64
+}
+
+// tokenFile is a bearer token, re-read from its file every tokenReloadInterval
+// so that rotated service account tokens are picked up
+type tokenFile struct {
+	path string // "" for a fixed token
+
+	mu     sync.Mutex
+	token  string
+	readAt time.Time
+}
+
+// get returns the current token, re-reading the file if it is due
+// The previous token is kept if the file cannot be read
+func (t *tokenFile) get() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.path == "" || time.Since(t.readAt) < tokenReloadInterval {
+		return t.token, nil
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		if t.token != "" {
+			slog.Warn("Failed to reload Kubernetes API token, keeping the previous one",
+				slog.String("path", t.path),
+				slog.String("error", err.Error()))
+			return t.token, nil
+		}
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+
+	t.token = strings.TrimSpace(string(data))
+	t.readAt = time.Now()
+	return t.token, nil
+}
+
+// invalidate makes the next get re-read the file
+func (t *tokenFile) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.readAt = time.Time{}
+}
+
+// bearerTransport adds the current token to every request
+type bearerTransport struct {
+	next  http.RoundTripper
+	token *tokenFile
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.token.get()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.next.RoundTrip(req)
+}
+
+// newAPIClient creates a client for the API server at baseURL
+// token may be nil; no client timeout is set since watches are long-running,
+// so requests carry their own deadlines
+func newAPIClient(baseURL string, tlsConfig *tls.Config, token *tokenFile) *apiClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	var roundTripper http.RoundTripper = transport
+	if token != nil {
+		roundTripper = &bearerTransport{next: transport, token: token}
+	}
+
+	return &apiClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Transport: roundTripper},
+		token:   token,
+	}
+}
+
+// loadAPIClient creates a client from a kubeconfig, or from the in-cluster
+// service account if kubeconfig is empty
+func loadAPIClient(kubeconfig string) (*apiClient, error) {
+	if kubeconfig != "" {
+		return kubeconfigAPIClient(kubeconfig)
+	}
+	return inClusterAPIClient()
+}
+
+// inClusterAPIClient creates a client using the pod's service account, verifying
+// the API server against the service account's CA
+func inClusterAPIClient() (*apiClient, error) {
+	tokenPath := filepath.Join(serviceAccountDir, "token")
+	if _, err := os.Stat(tokenPath); err != nil {
+		return nil, errNoCredentials
+	}
+
+	caPath := filepath.Join(serviceAccountDir, "ca.crt")
+	caData, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("no certificates found in %s", caPath)
+	}
+
+	// Get API server address from environment (works with hostNetwork)
+	apiHost := os.Getenv("KUBERNETES_SERVICE_HOST")
+	apiPort := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if apiHost == "" {
+		apiHost = "kubernetes.default.svc"
+	}
+	if apiPort == "" {
+		apiPort = "443"
+	}
+
+	token := &tokenFile{path: tokenPath}
+	if _, err := token.get(); err != nil {
+		return nil, err
+	}
+
+	return newAPIClient("https://"+net.JoinHostPort(apiHost, apiPort), &tls.Config{RootCAs: roots}, token), nil
+}
+
+// kubeconfig is the part of a kubeconfig file the exporter reads
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string    `yaml:"token"`
+			TokenFile             string    `yaml:"tokenFile"`
+			ClientCertificate     string    `yaml:"client-certificate"`
+			ClientCertificateData string    `yaml:"client-certificate-data"`
+			ClientKey             string    `yaml:"client-key"`
+			ClientKeyData         string    `yaml:"client-key-data"`
+			Exec                  yaml.Node `yaml:"exec"`
+			AuthProvider          yaml.Node `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// kubeconfigAPIClient creates a client for the current context of a kubeconfig
+// Tokens, token files and client certificates are supported; exec and
+// auth-provider plugins are not
+func kubeconfigAPIClient(path string) (*apiClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig %s: %w", path, err)
+	}
+
+	// Relative paths in a kubeconfig are relative to the file
+	dir := filepath.Dir(path)
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+
+	var clusterName, userName string
+	for _, c := range config.Contexts {
+		if c.Name == config.CurrentContext {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+		}
+	}
+	if clusterName == "" {
+		return nil, fmt.Errorf("kubeconfig %s: current context %q not found", path, config.CurrentContext)
+	}
+
+	tlsConfig := &tls.Config{}
+	var server string
+	for _, c := range config.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		server = c.Cluster.Server
+		tlsConfig.ServerName = c.Cluster.TLSServerName
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+
+		caData, err := fileOrData(resolve(c.Cluster.CertificateAuthority), c.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: certificate authority: %w", path, err)
+		}
+		if caData != nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caData) {
+				return nil, fmt.Errorf("kubeconfig %s: no certificates in the certificate authority of cluster %q", path, clusterName)
+			}
+		}
+	}
+	if server == "" {
+		return nil, fmt.Errorf("kubeconfig %s: cluster %q not found or has no server", path, clusterName)
+	}
+	if tlsConfig.InsecureSkipVerify {
+		slog.Warn("Kubeconfig disables API server certificate verification",
+			slog.String("kubeconfig", path),
+			slog.String("cluster", clusterName))
+	}
+
+	var token *tokenFile
+	for _, u := range config.Users {
+		if u.Name != userName {
+			continue
+		}
+		if !u.User.Exec.IsZero() || !u.User.AuthProvider.IsZero() {
+			return nil, fmt.Errorf("kubeconfig %s: user %q uses an exec or auth-provider plugin, which is not supported; use a token or client certificate", path, userName)
+		}
+
+		switch {
+		case u.User.TokenFile != "":
+			token = &tokenFile{path: resolve(u.User.TokenFile)}
+			if _, err := token.get(); err != nil {
+				return nil, fmt.Errorf("kubeconfig %s: %w", path, err)
+			}
+		case u.User.Token != "":
+			token = &tokenFile{token: u.User.Token}
+		}
+
+		certData, err := fileOrData(resolve(u.User.ClientCertificate), u.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: client certificate: %w", path, err)
+		}
+		keyData, err := fileOrData(resolve(u.User.ClientKey), u.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: client key: %w", path, err)
+		}
+		if certData != nil || keyData != nil {
+			cert, err := tls.X509KeyPair(certData, keyData)
+			if err != nil {
+				return nil, fmt.Errorf("kubeconfig %s: invalid client certificate: %w", path, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	slog.Info("Using kubeconfig for the Kubernetes API",
+		slog.String("kubeconfig", path),
+		slog.String("context", config.CurrentContext),
+		slog.String("server", server))
+
+	return newAPIClient(server, tlsConfig, token), nil
+}
+
+// fileOrData returns the contents of file, or base64-decoded data if file is empty
+// Returns nil if both are empty
+func fileOrData(file, data string) ([]byte, error) {
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	return nil, nil
+}
+
+// record counts a request and logs authentication and authorization failures
+// On a 401 the token is re-read before the next request, in case it was rotated
+func (c *apiClient) record(result string, status int, body string) {
+	counter, _ := c.requests.LoadOrStore(result, new(atomic.Uint64))
+	counter.(*atomic.Uint64).Add(1)
+
+	switch result {
+	case APIResultUnauthorized:
+		if c.token != nil {
+			c.token.invalidate()
+		}
+		slog.Error("Kubernetes API rejected the exporter's credentials, check that the service account token is mounted and valid",
+			slog.Int("status", status),
+			slog.String("response", body))
+	case APIResultForbidden:
+		slog.Error("Kubernetes API denied access to pods, check that the exporter's role allows get, list and watch on pods",
+			slog.Int("status", status),
+			slog.String("response", body))
+	}
+}
+
+// stats returns the request counts by result
+func (c *apiClient) stats() APIStats {
+	stats := make(APIStats)
+	c.requests.Range(func(result, counter any) bool {
+		stats[result.(string)] = counter.(*atomic.Uint64).Load()
+		return true
+	})
+	return stats
+}
@@ -0,0 +1,178 @@
+package kubernetes
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeFile writes a test file and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// TestTokenFile_Reload tests that tokens are re-read when due or after invalidation
+func TestTokenFile_Reload(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "token", "first\n")
+	token := &tokenFile{path: path}
+
+	if got, err := token.get(); err != nil || got != "first" {
+		t.Fatalf("Expected first, got %q (%v)", got, err)
+	}
+
+	writeFile(t, filepath.Dir(path), "token", "second")
+	if got, _ := token.get(); got != "first" {
+		t.Errorf("Expected the token to be kept until it is due, got %q", got)
+	}
+
+	token.readAt = time.Now().Add(-tokenReloadInterval)
+	if got, _ := token.get(); got != "second" {
+		t.Errorf("Expected the rotated token once due, got %q", got)
+	}
+
+	writeFile(t, filepath.Dir(path), "token", "third")
+	token.invalidate()
+	if got, _ := token.get(); got != "third" {
+		t.Errorf("Expected the rotated token after invalidation, got %q", got)
+	}
+
+	os.Remove(path)
+	token.invalidate()
+	if got, err := token.get(); err != nil || got != "third" {
+		t.Errorf("Expected the previous token when the file is gone, got %q (%v)", got, err)
+	}
+}
+
+// TestPodWatcher_AuthFailures tests that rejected credentials and RBAC denials are
+// counted, and that a rotated token is picked up right after a 401
+func TestPodWatcher_AuthFailures(t *testing.T) {
+	var forbidden atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "Bearer rotated":
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case !forbidden.Swap(true):
+			http.Error(w, `pods is forbidden: cannot list resource "pods"`, http.StatusForbidden)
+		case r.URL.Query().Get("watch") == "1":
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			fmt.Fprint(w, `{"metadata": {"resourceVersion": "1"}, "items": []}`)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := writeFile(t, dir, "token", "expired")
+	token := &tokenFile{path: path}
+	if _, err := token.get(); err != nil {
+		t.Fatalf("Failed to read token: %v", err)
+	}
+
+	// The kubelet rotates the token before the watcher starts; it would only be
+	// re-read after tokenReloadInterval without the 401
+	writeFile(t, dir, "token", "rotated")
+
+	w := newPodWatcher(newAPIClient(server.URL, nil, token), PodWatchOptions{NodeName: "node-1"})
+	w.minBackoff = time.Millisecond
+	w.maxBackoff = 10 * time.Millisecond
+	w.start()
+	defer w.stop()
+
+	waitFor(t, "a successful list", func() bool {
+		return w.api.stats()[APIResultSuccess] > 0
+	})
+
+	stats := w.api.stats()
+	if stats[APIResultUnauthorized] != 1 {
+		t.Errorf("Expected 1 unauthorized request, got %d", stats[APIResultUnauthorized])
+	}
+	if stats[APIResultForbidden] != 1 {
+		t.Errorf("Expected 1 forbidden request, got %d", stats[APIResultForbidden])
+	}
+}
+
+// TestKubeconfigAPIClient tests that a kubeconfig's server, CA and token are used
+// and that the server certificate is verified
+func TestKubeconfigAPIClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer from-file" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"metadata": {"resourceVersion": "1"}, "items": []}`)
+	}))
+	defer server.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	dir := t.TempDir()
+	writeFile(t, dir, "token", "from-file")
+
+	kubeconfig := func(name, clusterExtra, userExtra string) string {
+		return writeFile(t, dir, name, fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+contexts:
+- name: other
+  context: {cluster: other, user: other}
+- name: test
+  context: {cluster: test, user: test}
+clusters:
+- name: test
+  cluster:
+    server: %s
+%s
+users:
+- name: test
+  user:
+%s
+`, server.URL, clusterExtra, userExtra))
+	}
+
+	list := func(api *apiClient) error {
+		_, err := newPodWatcher(api, PodWatchOptions{NodeName: "node-1"}).list(t.Context())
+		return err
+	}
+
+	// Relative token file, CA data
+	api, err := kubeconfigAPIClient(kubeconfig("verified",
+		"    certificate-authority-data: "+base64.StdEncoding.EncodeToString(ca),
+		"    tokenFile: token"))
+	if err != nil {
+		t.Fatalf("kubeconfigAPIClient failed: %v", err)
+	}
+	if err := list(api); err != nil {
+		t.Errorf("Expected a verified, authenticated list, got %v", err)
+	}
+
+	// No CA: the test server's certificate is not trusted
+	api, err = kubeconfigAPIClient(kubeconfig("unverified", "", "    token: from-file"))
+	if err != nil {
+		t.Fatalf("kubeconfigAPIClient failed: %v", err)
+	}
+	if err := list(api); err == nil {
+		t.Errorf("Expected certificate verification to fail without the CA")
+	}
+	if n := api.stats()[APIResultError]; n != 1 {
+		t.Errorf("Expected the failure to be counted as an error, got %d", n)
+	}
+
+	// Exec plugins are not supported
+	_, err = kubeconfigAPIClient(kubeconfig("exec", "", "    exec: {command: get-token}"))
+	if err == nil {
+		t.Errorf("Expected an error for an exec plugin")
+	}
+}
@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DevicePluginConfig is the sharing section of an NVIDIA device plugin configuration file
+// Only the fields the exporter needs are read; JSON configs parse as YAML too
+type DevicePluginConfig struct {
+	Sharing struct {
+		TimeSlicing SharedResources `yaml:"timeSlicing"`
+		MPS         SharedResources `yaml:"mps"`
+	} `yaml:"sharing"`
+}
+
+// SharedResources lists the resources shared by one mechanism (time-slicing or MPS)
+type SharedResources struct {
+	Resources []SharedResource `yaml:"resources"`
+}
+
+// SharedResource is a resource advertised as several replicas per GPU
+type SharedResource struct {
+	Name     string `yaml:"name"`
+	Replicas int    `yaml:"replicas"`
+
+	// "all", a count of GPUs (by index), or a list of GPU indexes and UUIDs
+	// Absent means all GPUs
+	Devices yaml.Node `yaml:"devices"`
+}
+
+// LoadDevicePluginConfig reads an NVIDIA device plugin configuration file
+func LoadDevicePluginConfig(path string) (*DevicePluginConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device plugin config: %w", err)
+	}
+
+	var cfg DevicePluginConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse device plugin config %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// Replicas returns how many time-slicing and MPS replicas the device plugin
+// advertises for a GPU, 0 if the GPU is not shared by that mechanism
+func (c *DevicePluginConfig) Replicas(index uint, uuid string) (timeSlicing, mps int) {
+	return c.Sharing.TimeSlicing.replicas(index, uuid), c.Sharing.MPS.replicas(index, uuid)
+}
+
+// replicas returns the largest replica count of the resources covering a GPU
+func (s SharedResources) replicas(index uint, uuid string) int {
+	var replicas int
+	for _, resource := range s.Resources {
+		if resource.covers(index, uuid) {
+			replicas = max(replicas, resource.Replicas)
+		}
+	}
+	return replicas
+}
+
+// covers reports whether a resource's device selection includes a GPU
+func (r SharedResource) covers(index uint, uuid string) bool {
+	switch r.Devices.Kind {
+	case 0:
+		return true
+	case yaml.ScalarNode:
+		if r.Devices.Value == "all" {
+			return true
+		}
+		// A count selects the first GPUs by index
+		if count, err := strconv.Atoi(r.Devices.Value); err == nil {
+			return int(index) < count
+		}
+		return r.Devices.Value == uuid
+	case yaml.SequenceNode:
+		for _, device := range r.Devices.Content {
+			if device.Value == strconv.Itoa(int(index)) || (uuid != "" && device.Value == uuid) {
+				return true
+			}
+		}
+	}
+	return false
+}
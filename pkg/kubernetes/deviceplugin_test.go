@@ -0,0 +1,66 @@
+package kubernetes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDevicePluginConfig_Replicas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := `
+version: v1
+sharing:
+  timeSlicing:
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 4
+      devices: ["0", "GPU-cccc"]
+    - name: nvidia.com/gpu
+      replicas: 2
+      devices: all
+  mps:
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 3
+      devices: 2
+`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadDevicePluginConfig(path)
+	if err != nil {
+		t.Fatalf("LoadDevicePluginConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		index           uint
+		uuid            string
+		wantTimeSlicing int
+		wantMPS         int
+	}{
+		{0, "GPU-aaaa", 4, 3},
+		{1, "GPU-bbbb", 2, 3},
+		{2, "GPU-cccc", 4, 0},
+		{3, "GPU-dddd", 2, 0},
+	}
+
+	for _, tt := range tests {
+		timeSlicing, mps := cfg.Replicas(tt.index, tt.uuid)
+		if timeSlicing != tt.wantTimeSlicing || mps != tt.wantMPS {
+			t.Errorf("GPU %d: expected %d/%d replicas, got %d/%d", tt.index, tt.wantTimeSlicing, tt.wantMPS, timeSlicing, mps)
+		}
+	}
+}
+
+func TestLoadDevicePluginConfig_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("sharing: [unclosed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadDevicePluginConfig(path); err == nil {
+		t.Fatal("Expected error for invalid config")
+	}
+}
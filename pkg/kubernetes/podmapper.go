@@ -2,14 +2,9 @@ package kubernetes
 
 import (
 	"context"
-	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
-	"os"
-	"strings"
 	"time"
 
 	"google.golang.org/grpc"
@@ -21,6 +16,11 @@ const (
 	connectionTimeout   = 10 * time.Second
 	defaultSocketPath   = "/var/lib/kubelet/pod-resources/kubelet.sock"
 	nvidiaResourceName  = "nvidia.com/gpu"
+
+	// Kubelet pod resources are re-read at most every cacheMinRefresh, and at
+	// least every cacheMaxAge
+	cacheMinRefresh = 5 * time.Second
+	cacheMaxAge     = 30 * time.Second
 )
 
 // PodInfo contains Kubernetes pod metadata
@@ -33,176 +33,146 @@ type PodInfo struct {
 
 // PodMapper maps container IDs to Kubernetes pod information
 type PodMapper struct {
-	socketPath   string
-	cache        map[string]*PodInfo // keyed by container_id or pod_uid
-	uidCache     map[string]*PodInfo // keyed by pod_uid
-	lastUpdate   time.Time
-	k8sAPIClient *http.Client
-	k8sToken     string
+	socketPath  string
+	allocations []Allocation // GPU devices allocated by the kubelet
+	lastUpdate  time.Time
+	pods        *podWatcher // Pods on this node by UID, nil without API server access
+}
+
+// PodWatchOptions configures the watch of this node's pods on the API server
+type PodWatchOptions struct {
+	NodeName   string // Node whose pods are watched for lookups by pod UID ("" = no watch)
+	MaxPods    int    // Maximum number of pods kept (0 = unbounded)
+	Kubeconfig string // Kubeconfig for out-of-cluster runs ("" = in-cluster service account)
+
+	// Pod labels and annotations kept for GetPodMetadata; others are dropped
+	Labels      []string
+	Annotations []string
 }
 
 // NewPodMapper creates a new pod mapper
-func NewPodMapper(socketPath string) *PodMapper {
+// Fails only if an explicitly given kubeconfig cannot be used; without
+// API server credentials, pods are mapped through the kubelet alone
+func NewPodMapper(socketPath string, watch PodWatchOptions) (*PodMapper, error) {
 	if socketPath == "" {
 		socketPath = defaultSocketPath
 	}
 
 	pm := &PodMapper{
 		socketPath: socketPath,
-		cache:      make(map[string]*PodInfo),
-		uidCache:   make(map[string]*PodInfo),
 	}
 
-	// Set up K8s API client for in-cluster access
-	token, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
-	if err == nil {
-		pm.k8sToken = string(token)
-		pm.k8sAPIClient = &http.Client{
-			Timeout: 10 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-		}
-		slog.Debug("Kubernetes API client initialized")
-	} else {
+	if watch.NodeName == "" {
+		slog.Warn("Node name not set (--node-name or $NODE_NAME), pod UID lookup disabled")
+		return pm, nil
+	}
+
+	api, err := loadAPIClient(watch.Kubeconfig)
+	switch {
+	case err == nil:
+	case watch.Kubeconfig != "":
+		return nil, err
+	case errors.Is(err, errNoCredentials):
 		slog.Debug("No service account token found, pod UID lookup disabled")
+		return pm, nil
+	default:
+		slog.Warn("Failed to set up the Kubernetes API client, pod UID lookup disabled",
+			slog.String("error", err.Error()))
+		return pm, nil
 	}
 
-	return pm
-}
+	pm.pods = newPodWatcher(api, watch)
+	pm.pods.start()
+	slog.Debug("Kubernetes API client initialized",
+		slog.String("server", api.baseURL),
+		slog.String("node", watch.NodeName))
 
-// GetPodInfo returns pod information for a given container ID
-// Returns nil if container is not part of a Kubernetes pod
-func (pm *PodMapper) GetPodInfo(containerID string) (*PodInfo, error) {
-	// Refresh cache if stale (older than 30 seconds)
-	if time.Since(pm.lastUpdate) > 30*time.Second {
-		if err := pm.refreshCache(); err != nil {
-			return nil, fmt.Errorf("failed to refresh pod cache: %w", err)
-		}
-	}
+	return pm, nil
+}
 
-	// Lookup in cache by container ID
-	if info, ok := pm.cache[containerID]; ok {
-		return info, nil
+// GetPodMetadata returns the allowlisted labels and annotations of a pod
+// (PodWatchOptions), nil if the pod is not known or the API server is not used
+func (pm *PodMapper) GetPodMetadata(podUID string) (labels, annotations map[string]string) {
+	if pm.pods == nil || podUID == "" {
+		return nil, nil
 	}
 
-	// Not found - not a Kubernetes pod
-	return nil, nil
+	labels, annotations, _ = pm.pods.metadata(podUID)
+	return labels, annotations
 }
 
-// GetPodInfoByUID returns pod information for a given pod UID
-func (pm *PodMapper) GetPodInfoByUID(podUID string) (*PodInfo, error) {
-	// Check UID cache first
-	if info, ok := pm.uidCache[podUID]; ok {
-		return info, nil
+// APIStats returns Kubernetes API requests by result, and false if the API server is not used
+func (pm *PodMapper) APIStats() (APIStats, bool) {
+	if pm.pods == nil {
+		return nil, false
 	}
+	return pm.pods.api.stats(), true
+}
 
-	// Query Kubernetes API for pod info
-	if pm.k8sAPIClient != nil && podUID != "" {
-		info, err := pm.queryPodByUID(podUID)
-		if err != nil {
-			slog.Debug("Failed to query pod by UID", slog.String("uid", podUID), slog.String("error", err.Error()))
-		} else if info != nil {
-			pm.uidCache[podUID] = info
-			return info, nil
-		}
+// Stop stops watching pods
+func (pm *PodMapper) Stop() {
+	if pm.pods != nil {
+		pm.pods.stop()
 	}
-
-	return nil, nil
 }
 
-// queryPodByUID queries Kubernetes API to get pod info by UID
-func (pm *PodMapper) queryPodByUID(podUID string) (*PodInfo, error) {
-	if pm.k8sAPIClient == nil {
-		return nil, nil
+// Resolve maps containers to the pod containers allocated their GPUs (see ResolveContainers)
+// The kubelet is queried again when the cache is stale, or when a container is
+// not resolved and the cache is older than cacheMinRefresh (new pods)
+func (pm *PodMapper) Resolve(containers []ContainerRef) (map[string]*PodInfo, error) {
+	if err := pm.refreshIfOlder(cacheMaxAge); err != nil {
+		return nil, err
 	}
 
-	// Check cache first
-	if info, ok := pm.uidCache[podUID]; ok {
-		return info, nil
+	resolved := ResolveContainers(pm.allocations, containers)
+	if len(resolved) == len(containers) {
+		return resolved, nil
 	}
 
-	// Not in cache - refresh and try again (new pod may have been created)
-	if err := pm.refreshUIDCache(); err != nil {
+	if err := pm.refreshIfOlder(cacheMinRefresh); err != nil {
 		return nil, err
 	}
+	return ResolveContainers(pm.allocations, containers), nil
+}
 
-	if info, ok := pm.uidCache[podUID]; ok {
-		return info, nil
+// Allocations returns the GPU devices the kubelet allocated to containers on this node
+func (pm *PodMapper) Allocations() ([]Allocation, error) {
+	if err := pm.refreshIfOlder(cacheMaxAge); err != nil {
+		return nil, err
 	}
 
-	return nil, nil
+	allocations := make([]Allocation, len(pm.allocations))
+	copy(allocations, pm.allocations)
+	return allocations, nil
 }
 
-// refreshUIDCache fetches all pods from K8s API and builds UID -> PodInfo cache
-func (pm *PodMapper) refreshUIDCache() error {
-	if pm.k8sAPIClient == nil {
+// refreshIfOlder refreshes the cache if it is older than maxAge
+func (pm *PodMapper) refreshIfOlder(maxAge time.Duration) error {
+	if time.Since(pm.lastUpdate) <= maxAge {
 		return nil
 	}
 
-	// Get API server address from environment (works with hostNetwork)
-	apiHost := os.Getenv("KUBERNETES_SERVICE_HOST")
-	apiPort := os.Getenv("KUBERNETES_SERVICE_PORT")
-	if apiHost == "" {
-		apiHost = "kubernetes.default.svc"
-	}
-	if apiPort == "" {
-		apiPort = "443"
-	}
-
-	url := fmt.Sprintf("https://%s:%s/api/v1/pods", apiHost, apiPort)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+pm.k8sToken)
-
-	resp, err := pm.k8sAPIClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("K8s API returned %d: %s", resp.StatusCode, string(body))
-	}
-
-	var result struct {
-		Items []struct {
-			Metadata struct {
-				Name      string `json:"name"`
-				Namespace string `json:"namespace"`
-				UID       string `json:"uid"`
-			} `json:"metadata"`
-			Spec struct {
-				Containers []struct {
-					Name string `json:"name"`
-				} `json:"containers"`
-			} `json:"spec"`
-		} `json:"items"`
+	if err := pm.refreshCache(); err != nil {
+		return fmt.Errorf("failed to refresh pod cache: %w", err)
 	}
+	return nil
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return err
+// GetPodInfoByContainer returns pod information for a container of a pod, by
+// the pod UID and container ID read from the container's cgroup
+// ContainerName is matched against the pod's container statuses (regular, init
+// and ephemeral) and left empty until the container shows up in them. Pods come
+// from the watch of this node's pods; the API server is never queried here.
+func (pm *PodMapper) GetPodInfoByContainer(podUID, containerID string) (*PodInfo, error) {
+	if pm.pods == nil || podUID == "" {
+		return nil, nil
 	}
 
-	// Build UID cache
-	for _, pod := range result.Items {
-		containerName := ""
-		if len(pod.Spec.Containers) > 0 {
-			containerName = pod.Spec.Containers[0].Name // Use first container
-		}
-		pm.uidCache[pod.Metadata.UID] = &PodInfo{
-			PodName:       pod.Metadata.Name,
-			PodNamespace:  pod.Metadata.Namespace,
-			ContainerName: containerName,
-		}
+	if info, ok := pm.pods.get(podUID, containerID); ok {
+		return info, nil
 	}
 
-	slog.Debug("Refreshed pod UID cache", slog.Int("pods", len(result.Items)))
-	return nil
+	return nil, nil
 }
 
 // refreshCache updates the pod information cache
@@ -222,8 +192,7 @@ func (pm *PodMapper) refreshCache() error {
 		return err
 	}
 
-	// Build new cache
-	newCache := make(map[string]*PodInfo)
+	var allocations []Allocation
 
 	for _, pod := range pods.GetPodResources() {
 		podName := pod.GetName()
@@ -232,89 +201,47 @@ func (pm *PodMapper) refreshCache() error {
 		for _, container := range pod.GetContainers() {
 			containerName := container.GetName()
 
-			// Get container ID from devices
-			// The container ID is embedded in device IDs for GPU resources
+			// Device IDs are GPU or MIG UUIDs, which ResolveContainers joins with
+			// the devices processes run on; the API gives no container IDs
 			for _, device := range container.GetDevices() {
 				resourceName := device.GetResourceName()
 
 				// Check if this is an NVIDIA GPU resource
-				if !strings.HasPrefix(resourceName, nvidiaResourceName) &&
-					!strings.HasPrefix(resourceName, "nvidia.com/mig") {
+				if !isGPUResource(resourceName) {
 					continue
 				}
 
-				// For Kubernetes, the container ID is available via the runtime
-				// We'll need to extract it from the pod resources response
-				// Note: The pod-resources API doesn't directly provide container IDs
-				// We need to get it from the container runtime or cgroup info
-
-				// For now, we'll use a workaround: extract from device IDs if available
-				// or we'll populate this mapping in the collector by cross-referencing
-				// PIDs with container IDs from cgroup
-
-				// Store pod info with a placeholder container ID
-				// The collector will update this with actual container IDs
-				info := &PodInfo{
-					PodName:       podName,
-					PodNamespace:  podNamespace,
-					ContainerName: containerName,
-				}
-
-				// Try to extract container ID from device IDs if available
 				for _, deviceID := range device.GetDeviceIds() {
-					// Device IDs sometimes contain container ID
-					if cid := extractContainerIDFromDeviceID(deviceID); cid != "" {
-						info.ContainerID = cid
-						newCache[cid] = info
-					}
+					allocations = append(allocations, Allocation{
+						PodName:       podName,
+						PodNamespace:  podNamespace,
+						ContainerName: containerName,
+						ResourceName:  resourceName,
+						DeviceID:      deviceID,
+						UUID:          DeviceUUID(deviceID),
+					})
 				}
 
-				// Also store by pod+container key for lookup
-				key := fmt.Sprintf("%s/%s/%s", podNamespace, podName, containerName)
-				newCache[key] = info
-
-				slog.Debug("Cached pod info",
+				slog.Debug("Cached pod GPU allocation",
 					slog.String("pod", podName),
 					slog.String("namespace", podNamespace),
-					slog.String("container", containerName))
+					slog.String("container", containerName),
+					slog.String("resource", resourceName),
+					slog.Any("device_ids", device.GetDeviceIds()))
 			}
 		}
 	}
+	sortAllocations(allocations)
 
-	pm.cache = newCache
+	pm.allocations = allocations
 	pm.lastUpdate = time.Now()
 
-	slog.Debug("Pod cache refreshed", slog.Int("entries", len(newCache)))
+	slog.Debug("Pod cache refreshed",
+		slog.Int("allocations", len(allocations)))
 
 	return nil
 }
 
-// AddContainerMapping manually adds a container ID to pod info mapping
-// Used by collector to populate cache with actual container IDs from cgroup
-func (pm *PodMapper) AddContainerMapping(containerID string, info *PodInfo) {
-	pm.cache[containerID] = info
-}
-
-// GetPodInfoByPodContainer looks up pod info by pod name and container name
-func (pm *PodMapper) GetPodInfoByPodContainer(namespace, podName, containerName string) (*PodInfo, error) {
-	key := fmt.Sprintf("%s/%s/%s", namespace, podName, containerName)
-
-	if info, ok := pm.cache[key]; ok {
-		return info, nil
-	}
-
-	// Try refreshing cache
-	if err := pm.refreshCache(); err != nil {
-		return nil, err
-	}
-
-	if info, ok := pm.cache[key]; ok {
-		return info, nil
-	}
-
-	return nil, nil
-}
-
 // connectToKubelet establishes gRPC connection to kubelet
 func connectToKubelet(socketPath string) (*grpc.ClientConn, func(), error) {
 	// Use unix:// scheme for gRPC to properly resolve the socket path
@@ -348,23 +275,3 @@ func listPodResources(conn *grpc.ClientConn) (*podresourcesapi.ListPodResourcesR
 
 	return resp, nil
 }
-
-// extractContainerIDFromDeviceID attempts to extract container ID from device ID
-func extractContainerIDFromDeviceID(deviceID string) string {
-	// Some device plugins include container ID in the device ID
-	// Format varies by plugin, this is a best-effort extraction
-
-	// containerd format: might have cri-containerd-<containerID>
-	if idx := strings.Index(deviceID, "cri-containerd-"); idx != -1 {
-		start := idx + len("cri-containerd-")
-		// Extract until next delimiter
-		for i, ch := range deviceID[start:] {
-			if ch == '-' || ch == '/' || ch == '.' {
-				return deviceID[start : start+i]
-			}
-		}
-		return deviceID[start:]
-	}
-
-	return ""
-}
@@ -0,0 +1,504 @@
+package kubernetes
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	podListTimeout     = 30 * time.Second
+	podListPageSize    = 500
+	podWatchTimeout    = 5 * time.Minute // Server-side timeout of each watch request
+	podWatchMinBackoff = 1 * time.Second
+	podWatchMaxBackoff = 1 * time.Minute
+)
+
+// errResourceExpired means the resourceVersion to resume from is too old and pods must be listed again
+var errResourceExpired = errors.New("resource version expired")
+
+// podObject is the part of a pod the watcher reads
+type podObject struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		UID             string            `json:"uid"`
+		ResourceVersion string            `json:"resourceVersion"`
+		Labels          map[string]string `json:"labels"`
+		Annotations     map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Status struct {
+		ContainerStatuses          []containerStatus `json:"containerStatuses"`
+		InitContainerStatuses      []containerStatus `json:"initContainerStatuses"`
+		EphemeralContainerStatuses []containerStatus `json:"ephemeralContainerStatuses"`
+	} `json:"status"`
+}
+
+// containerStatus is the part of a container status the watcher reads
+type containerStatus struct {
+	Name        string `json:"name"`
+	ContainerID string `json:"containerID"` // "<runtime>://<id>", empty until the container is created
+}
+
+// watchedPod is a pod on the node and the IDs of its containers
+type watchedPod struct {
+	name        string
+	namespace   string
+	containers  map[string]string // Container ID without runtime prefix -> container name
+	labels      map[string]string // Allowlisted labels only
+	annotations map[string]string // Allowlisted annotations only
+}
+
+// watched returns what the watcher keeps of the pod
+// Regular, init and ephemeral containers are all included, since any of them can
+// use a GPU; only allowlisted labels and annotations are kept
+func (p *podObject) watched(labels, annotations []string) *watchedPod {
+	pod := &watchedPod{
+		name:        p.Metadata.Name,
+		namespace:   p.Metadata.Namespace,
+		containers:  make(map[string]string),
+		labels:      allowed(p.Metadata.Labels, labels),
+		annotations: allowed(p.Metadata.Annotations, annotations),
+	}
+
+	for _, statuses := range [][]containerStatus{
+		p.Status.ContainerStatuses,
+		p.Status.InitContainerStatuses,
+		p.Status.EphemeralContainerStatuses,
+	} {
+		for _, status := range statuses {
+			if id := trimRuntimePrefix(status.ContainerID); id != "" {
+				pod.containers[id] = status.Name
+			}
+		}
+	}
+
+	return pod
+}
+
+// podInfo returns the pod metadata exported for processes of a container of the pod
+// ContainerName is empty if the container ID is not in the pod's status (yet)
+func (p *watchedPod) podInfo(containerID string) *PodInfo {
+	return &PodInfo{
+		PodName:       p.name,
+		PodNamespace:  p.namespace,
+		ContainerName: p.containers[containerID],
+		ContainerID:   containerID,
+	}
+}
+
+// allowed returns the entries of values whose keys are in the allowlist, nil if none
+func allowed(values map[string]string, allowlist []string) map[string]string {
+	var result map[string]string
+	for _, key := range allowlist {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]string)
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// trimRuntimePrefix strips the runtime prefix from a container ID in pod status,
+// e.g. "containerd://<id>" or "cri-o://<id>", to match IDs read from cgroups
+func trimRuntimePrefix(containerID string) string {
+	if _, id, ok := strings.Cut(containerID, "://"); ok {
+		return id
+	}
+	return containerID
+}
+
+// apiStatus is the status the API server returns with failed requests and ERROR watch events
+type apiStatus struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// podCache holds up to maxPods pods keyed by UID, evicting the least recently updated
+type podCache struct {
+	mu      sync.RWMutex
+	maxPods int
+	pods    map[string]*list.Element // Values are *cachedPod
+	order   *list.List               // Least recently updated first
+}
+
+// cachedPod is a pod in the cache
+type cachedPod struct {
+	uid string
+	pod *watchedPod
+}
+
+// newPodCache creates a cache for up to maxPods pods (0 = unbounded)
+func newPodCache(maxPods int) *podCache {
+	return &podCache{
+		maxPods: maxPods,
+		pods:    make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the pod with a UID
+func (c *podCache) get(uid string) (*watchedPod, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if element, ok := c.pods[uid]; ok {
+		return element.Value.(*cachedPod).pod, true
+	}
+	return nil, false
+}
+
+// set adds or updates a pod, evicting the least recently updated pods beyond maxPods
+func (c *podCache) set(uid string, pod *watchedPod) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setLocked(uid, pod)
+}
+
+// setLocked is set with c.mu held
+func (c *podCache) setLocked(uid string, pod *watchedPod) {
+	if element, ok := c.pods[uid]; ok {
+		element.Value.(*cachedPod).pod = pod
+		c.order.MoveToBack(element)
+		return
+	}
+
+	c.pods[uid] = c.order.PushBack(&cachedPod{uid: uid, pod: pod})
+	for c.maxPods > 0 && c.order.Len() > c.maxPods {
+		oldest := c.order.Remove(c.order.Front()).(*cachedPod)
+		delete(c.pods, oldest.uid)
+		slog.Debug("Pod cache full, evicted pod",
+			slog.String("uid", oldest.uid),
+			slog.String("pod", oldest.pod.name),
+			slog.Int("max_pods", c.maxPods))
+	}
+}
+
+// delete removes a pod
+func (c *podCache) delete(uid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.pods[uid]; ok {
+		c.order.Remove(element)
+		delete(c.pods, uid)
+	}
+}
+
+// replace replaces the cached pods with a full list
+func (c *podCache) replace(pods []cachedPod) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pods = make(map[string]*list.Element, len(pods))
+	c.order.Init()
+	for _, pod := range pods {
+		c.setLocked(pod.uid, pod.pod)
+	}
+}
+
+// len returns the number of cached pods
+func (c *podCache) len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.order.Len()
+}
+
+// podWatcher keeps the pods scheduled to one node in a cache by listing and
+// watching them on the API server, so lookups never query the API server
+type podWatcher struct {
+	api         *apiClient
+	nodeName    string
+	labels      []string // Pod labels kept for GetPodMetadata
+	annotations []string // Pod annotations kept for GetPodMetadata
+	cache       *podCache
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newPodWatcher creates a watcher for the pods on a node
+func newPodWatcher(api *apiClient, options PodWatchOptions) *podWatcher {
+	return &podWatcher{
+		api:         api,
+		nodeName:    options.NodeName,
+		labels:      options.Labels,
+		annotations: options.Annotations,
+		cache:       newPodCache(options.MaxPods),
+		minBackoff:  podWatchMinBackoff,
+		maxBackoff:  podWatchMaxBackoff,
+	}
+}
+
+// start lists and watches pods in the background until stop is called
+func (w *podWatcher) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+
+	go w.run(ctx)
+}
+
+// stop stops watching and waits for the watch to end
+func (w *podWatcher) stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+}
+
+// get returns the pod info of a container of a cached pod
+func (w *podWatcher) get(podUID, containerID string) (*PodInfo, bool) {
+	pod, ok := w.cache.get(podUID)
+	if !ok {
+		return nil, false
+	}
+	return pod.podInfo(containerID), true
+}
+
+// metadata returns the allowlisted labels and annotations of a cached pod
+func (w *podWatcher) metadata(podUID string) (map[string]string, map[string]string, bool) {
+	pod, ok := w.cache.get(podUID)
+	if !ok {
+		return nil, nil, false
+	}
+	return pod.labels, pod.annotations, true
+}
+
+// run lists pods, then watches from the list's resourceVersion, resuming each
+// watch where the previous one ended. Pods are listed again only if the
+// resourceVersion expired; failures are retried with exponential backoff.
+func (w *podWatcher) run(ctx context.Context) {
+	defer close(w.done)
+
+	backoff := w.minBackoff
+	resourceVersion := ""
+	for {
+		var err error
+		listed := resourceVersion == ""
+		if listed {
+			resourceVersion, err = w.list(ctx)
+		}
+		if err == nil {
+			resourceVersion, err = w.watch(ctx, resourceVersion)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			backoff = w.minBackoff
+			continue
+		}
+		if errors.Is(err, errResourceExpired) {
+			resourceVersion = ""
+			// Relist right away, unless the list itself just expired
+			if !listed {
+				slog.Debug("Pod watch resource version expired, listing pods again",
+					slog.String("node", w.nodeName))
+				continue
+			}
+		}
+
+		slog.Warn("Pod watch failed, retrying",
+			slog.String("node", w.nodeName),
+			slog.Duration("backoff", backoff),
+			slog.String("error", err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, w.maxBackoff)
+	}
+}
+
+// podsURL returns the URL of the pods on the node with extra query parameters
+func (w *podWatcher) podsURL(params url.Values) string {
+	params.Set("fieldSelector", "spec.nodeName="+w.nodeName)
+	return w.api.baseURL + "/api/v1/pods?" + params.Encode()
+}
+
+// do issues a GET and returns the response if its status is 200
+// Every request is counted by result in the client's stats
+func (w *podWatcher) do(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := w.api.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.api.record(APIResultError, 0, "")
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			w.api.record(APIResultUnauthorized, resp.StatusCode, string(body))
+		case http.StatusForbidden:
+			w.api.record(APIResultForbidden, resp.StatusCode, string(body))
+		default:
+			w.api.record(APIResultError, resp.StatusCode, string(body))
+		}
+
+		if resp.StatusCode == http.StatusGone {
+			return nil, errResourceExpired
+		}
+		return nil, fmt.Errorf("K8s API returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	w.api.record(APIResultSuccess, resp.StatusCode, "")
+	return resp, nil
+}
+
+// list replaces the cache with the pods on the node, page by page, and returns
+// the resourceVersion to watch from
+func (w *podWatcher) list(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, podListTimeout)
+	defer cancel()
+
+	var pods []cachedPod
+	var resourceVersion, continueToken string
+	for {
+		params := url.Values{}
+		params.Set("limit", fmt.Sprint(podListPageSize))
+		if continueToken != "" {
+			params.Set("continue", continueToken)
+		}
+
+		resp, err := w.do(ctx, w.podsURL(params))
+		if err != nil {
+			return "", fmt.Errorf("failed to list pods: %w", err)
+		}
+
+		var page struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+				Continue        string `json:"continue"`
+			} `json:"metadata"`
+			Items []podObject `json:"items"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to decode pod list: %w", err)
+		}
+
+		for i := range page.Items {
+			pods = append(pods, cachedPod{
+				uid: page.Items[i].Metadata.UID,
+				pod: page.Items[i].watched(w.labels, w.annotations),
+			})
+		}
+		resourceVersion = page.Metadata.ResourceVersion
+		continueToken = page.Metadata.Continue
+		if continueToken == "" {
+			break
+		}
+	}
+
+	w.cache.replace(pods)
+	if w.cache.maxPods > 0 && len(pods) > w.cache.maxPods {
+		slog.Warn("More pods on the node than the pod cache holds, some pods will not be labeled",
+			slog.Int("pods", len(pods)),
+			slog.Int("max_pods", w.cache.maxPods))
+	}
+
+	slog.Debug("Listed pods on node",
+		slog.String("node", w.nodeName),
+		slog.Int("pods", len(pods)),
+		slog.String("resource_version", resourceVersion))
+
+	return resourceVersion, nil
+}
+
+// watch applies pod events from resourceVersion on until the server ends the
+// watch, and returns the resourceVersion to resume from
+func (w *podWatcher) watch(ctx context.Context, resourceVersion string) (string, error) {
+	params := url.Values{}
+	params.Set("watch", "1")
+	params.Set("resourceVersion", resourceVersion)
+	params.Set("allowWatchBookmarks", "true")
+	params.Set("timeoutSeconds", fmt.Sprint(int(podWatchTimeout.Seconds())))
+
+	resp, err := w.do(ctx, w.podsURL(params))
+	if err != nil {
+		return resourceVersion, fmt.Errorf("failed to watch pods: %w", err)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return resourceVersion, nil
+			}
+			return resourceVersion, fmt.Errorf("failed to read pod watch: %w", err)
+		}
+
+		if event.Type == "ERROR" {
+			var status apiStatus
+			if err := json.Unmarshal(event.Object, &status); err != nil {
+				return resourceVersion, fmt.Errorf("failed to decode pod watch error: %w", err)
+			}
+			if status.Code == http.StatusGone {
+				return resourceVersion, errResourceExpired
+			}
+			return resourceVersion, fmt.Errorf("pod watch error %d %s: %s", status.Code, status.Reason, status.Message)
+		}
+
+		var pod podObject
+		if err := json.Unmarshal(event.Object, &pod); err != nil {
+			return resourceVersion, fmt.Errorf("failed to decode pod watch event: %w", err)
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			w.cache.set(pod.Metadata.UID, pod.watched(w.labels, w.annotations))
+		case "DELETED":
+			w.cache.delete(pod.Metadata.UID)
+		}
+		if pod.Metadata.ResourceVersion != "" {
+			resourceVersion = pod.Metadata.ResourceVersion
+		}
+
+		slog.Debug("Pod watch event",
+			slog.String("type", event.Type),
+			slog.String("pod", pod.Metadata.Name),
+			slog.String("namespace", pod.Metadata.Namespace),
+			slog.Int("cached", w.cache.len()))
+	}
+}
@@ -0,0 +1,291 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPIServer serves pods of one node with scripted list and watch responses
+type fakeAPIServer struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	lists   []func(w http.ResponseWriter, r *http.Request) // Served in order, the last one repeatedly
+	watches []func(w http.ResponseWriter, r *http.Request)
+	listed  int
+	watched int
+}
+
+// ServeHTTP checks the request is node-scoped and authenticated and serves the next scripted response
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/pods" {
+		s.t.Errorf("Unexpected request path %s", r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	if got := r.URL.Query().Get("fieldSelector"); got != "spec.nodeName=node-1" {
+		s.t.Errorf("Expected a request for node-1's pods, got fieldSelector %q", got)
+	}
+	if got := r.Header.Get("Authorization"); got != "Bearer token" {
+		s.t.Errorf("Expected bearer token, got %q", got)
+	}
+
+	s.mu.Lock()
+	var handler func(w http.ResponseWriter, r *http.Request)
+	if r.URL.Query().Get("watch") == "1" {
+		handler = s.watches[min(s.watched, len(s.watches)-1)]
+		s.watched++
+	} else {
+		handler = s.lists[min(s.listed, len(s.lists)-1)]
+		s.listed++
+	}
+	s.mu.Unlock()
+
+	handler(w, r)
+}
+
+// counts returns how many lists and watches were served
+func (s *fakeAPIServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listed, s.watched
+}
+
+// testPod returns a pod object as served by the API server, with a "main"
+// container whose ID is "c-<name>"
+func testPod(name, uid, resourceVersion string) map[string]any {
+	return map[string]any{
+		"metadata": map[string]any{"name": name, "namespace": "ml", "uid": uid, "resourceVersion": resourceVersion},
+		"status": map[string]any{"containerStatuses": []any{
+			map[string]any{"name": "main", "containerID": "containerd://c-" + name},
+		}},
+	}
+}
+
+// servePodList responds with a pod list at a resourceVersion
+func servePodList(resourceVersion string, pods ...map[string]any) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"metadata": map[string]any{"resourceVersion": resourceVersion},
+			"items":    pods,
+		})
+	}
+}
+
+// serveWatch checks the watch resumes from resourceVersion and streams events
+func serveWatch(t *testing.T, resourceVersion string, events ...map[string]any) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("resourceVersion"); got != resourceVersion {
+			t.Errorf("Expected watch from resourceVersion %s, got %s", resourceVersion, got)
+		}
+		encoder := json.NewEncoder(w)
+		for _, event := range events {
+			encoder.Encode(event)
+		}
+	}
+}
+
+// testAPIClient returns a client for a test API server, authenticating with "token"
+func testAPIClient(baseURL string) *apiClient {
+	return newAPIClient(baseURL, nil, &tokenFile{token: "token"})
+}
+
+// waitFor polls condition until it holds or a deadline passes
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestPodWatcher_ListWatch tests that pods are listed and watched for one node,
+// that watches resume from the latest resourceVersion, that an expired
+// resourceVersion triggers a new list and that failures are retried
+func TestPodWatcher_ListWatch(t *testing.T) {
+	api := &fakeAPIServer{t: t}
+	api.lists = []func(http.ResponseWriter, *http.Request){
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "etcd unavailable", http.StatusInternalServerError)
+		},
+		servePodList("10", testPod("a", "uid-a", "8"), testPod("b", "uid-b", "9")),
+		servePodList("30", testPod("b", "uid-b", "9"), testPod("d", "uid-d", "25")),
+	}
+	api.watches = []func(http.ResponseWriter, *http.Request){
+		serveWatch(t, "10",
+			map[string]any{"type": "ADDED", "object": testPod("c", "uid-c", "11")},
+			map[string]any{"type": "DELETED", "object": testPod("a", "uid-a", "12")},
+			map[string]any{"type": "BOOKMARK", "object": map[string]any{"metadata": map[string]any{"resourceVersion": "15"}}},
+		),
+		serveWatch(t, "15",
+			map[string]any{"type": "ERROR", "object": map[string]any{"code": 410, "reason": "Expired", "message": "too old resource version"}},
+		),
+		// Hold the watch open until the watcher stops
+		func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("resourceVersion"); got != "30" {
+				t.Errorf("Expected watch from the new list's resourceVersion 30, got %s", got)
+			}
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	}
+
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	w := newPodWatcher(testAPIClient(server.URL), PodWatchOptions{NodeName: "node-1"})
+	w.minBackoff = time.Millisecond
+	w.maxBackoff = 10 * time.Millisecond
+	w.start()
+	defer w.stop()
+
+	waitFor(t, "the second list and its watch", func() bool {
+		listed, watched := api.counts()
+		return listed == 3 && watched == 3
+	})
+
+	for uid, expected := range map[string]string{"uid-b": "b", "uid-d": "d"} {
+		info, ok := w.get(uid, "c-"+expected)
+		if !ok || info.PodName != expected || info.PodNamespace != "ml" || info.ContainerName != "main" {
+			t.Errorf("Expected %s to be ml/%s/main, got %+v", uid, expected, info)
+		}
+	}
+	for _, uid := range []string{"uid-a", "uid-c"} {
+		if _, ok := w.cache.get(uid); ok {
+			t.Errorf("Expected %s to be gone after the list replaced the cache", uid)
+		}
+	}
+}
+
+// TestPodWatcher_Events tests that watch events update the cache between lists
+func TestPodWatcher_Events(t *testing.T) {
+	api := &fakeAPIServer{t: t}
+	api.lists = []func(http.ResponseWriter, *http.Request){
+		servePodList("10", testPod("a", "uid-a", "8")),
+	}
+	watchDone := make(chan struct{})
+	api.watches = []func(http.ResponseWriter, *http.Request){
+		serveWatch(t, "10",
+			map[string]any{"type": "ADDED", "object": testPod("b", "uid-b", "11")},
+			map[string]any{"type": "MODIFIED", "object": testPod("a-renamed", "uid-a", "12")},
+			map[string]any{"type": "DELETED", "object": testPod("b", "uid-b", "13")},
+			map[string]any{"type": "ADDED", "object": testPod("c", "uid-c", "14")},
+		),
+		func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("resourceVersion"); got != "14" {
+				t.Errorf("Expected watch to resume from 14, got %s", got)
+			}
+			close(watchDone)
+			<-r.Context().Done()
+		},
+	}
+
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	w := newPodWatcher(testAPIClient(server.URL), PodWatchOptions{NodeName: "node-1"})
+	w.start()
+	defer w.stop()
+
+	select {
+	case <-watchDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the watch to resume")
+	}
+
+	if info, ok := w.get("uid-a", "c-a-renamed"); !ok || info.PodName != "a-renamed" || info.ContainerName != "main" {
+		t.Errorf("Expected uid-a to be updated, got %+v", info)
+	}
+	if _, ok := w.cache.get("uid-b"); ok {
+		t.Errorf("Expected uid-b to be deleted")
+	}
+	if _, ok := w.cache.get("uid-c"); !ok {
+		t.Errorf("Expected uid-c to be added")
+	}
+	if listed, _ := api.counts(); listed != 1 {
+		t.Errorf("Expected a single list, got %d", listed)
+	}
+}
+
+// TestPodCache_Bounded tests that the least recently updated pods are evicted beyond the limit
+func TestPodCache_Bounded(t *testing.T) {
+	cache := newPodCache(2)
+
+	for i := 1; i <= 3; i++ {
+		cache.set(fmt.Sprintf("uid-%d", i), &watchedPod{name: fmt.Sprintf("pod-%d", i)})
+		if i == 2 {
+			// Updating uid-1 makes uid-2 the least recently updated
+			cache.set("uid-1", &watchedPod{name: "pod-1"})
+		}
+	}
+
+	if cache.len() != 2 {
+		t.Errorf("Expected 2 cached pods, got %d", cache.len())
+	}
+	if _, ok := cache.get("uid-2"); ok {
+		t.Errorf("Expected uid-2 to be evicted")
+	}
+	for _, uid := range []string{"uid-1", "uid-3"} {
+		if _, ok := cache.get(uid); !ok {
+			t.Errorf("Expected %s to be cached", uid)
+		}
+	}
+
+	cache.delete("uid-1")
+	if cache.len() != 1 {
+		t.Errorf("Expected 1 cached pod after delete, got %d", cache.len())
+	}
+}
+
+// TestPodObject_Containers tests that processes are attributed to the container
+// whose status holds their cgroup's container ID, whatever the runtime prefix and
+// kind of container, instead of to the pod's first container
+func TestPodObject_Containers(t *testing.T) {
+	var pod podObject
+	err := json.Unmarshal([]byte(`{
+		"metadata": {"name": "trainer", "namespace": "mesh", "uid": "uid-1"},
+		"status": {
+			"containerStatuses": [
+				{"name": "istio-proxy", "containerID": "containerd://aaa"},
+				{"name": "train", "containerID": "cri-o://bbb"},
+				{"name": "starting"}
+			],
+			"initContainerStatuses": [
+				{"name": "download-weights", "containerID": "docker://ccc"}
+			],
+			"ephemeralContainerStatuses": [
+				{"name": "debugger", "containerID": "containerd://ddd"}
+			]
+		}
+	}`), &pod)
+	if err != nil {
+		t.Fatalf("Failed to decode pod: %v", err)
+	}
+
+	watched := pod.watched(nil, nil)
+	tests := map[string]string{
+		"aaa":     "istio-proxy",
+		"bbb":     "train",
+		"ccc":     "download-weights",
+		"ddd":     "debugger",
+		"unknown": "",
+	}
+	for containerID, expected := range tests {
+		info := watched.podInfo(containerID)
+		if info.ContainerName != expected {
+			t.Errorf("Container %s: expected %q, got %q", containerID, expected, info.ContainerName)
+		}
+		if info.PodName != "trainer" || info.PodNamespace != "mesh" || info.ContainerID != containerID {
+			t.Errorf("Container %s: unexpected pod info %+v", containerID, info)
+		}
+	}
+}
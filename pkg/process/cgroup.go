@@ -11,7 +11,7 @@ import (
 // GetPodUID extracts the Kubernetes pod UID from a process's cgroup
 // Returns empty string if process is not in a Kubernetes pod
 func GetPodUID(pid uint) (string, error) {
-	cgroupPath := fmt.Sprintf("/proc/%d/cgroup", pid)
+	cgroupPath := filepath.Join(GetProcRoot(), fmt.Sprintf("%d/cgroup", pid))
 
 	file, err := os.Open(cgroupPath)
 	if err != nil {
@@ -64,7 +64,7 @@ func extractPodUIDFromCgroupLine(line string) string {
 // Returns empty string if process is not containerized
 func GetContainerID(pid uint) (string, error) {
 	// Read /proc/<pid>/cgroup
-	cgroupPath := fmt.Sprintf("/proc/%d/cgroup", pid)
+	cgroupPath := filepath.Join(GetProcRoot(), fmt.Sprintf("%d/cgroup", pid))
 
 	file, err := os.Open(cgroupPath)
 	if err != nil {
@@ -148,7 +148,7 @@ func extractContainerIDFromCgroupLine(line string) string {
 
 // GetProcessName reads the process name from /proc/<pid>/comm
 func GetProcessName(pid uint) (string, error) {
-	commPath := fmt.Sprintf("/proc/%d/comm", pid)
+	commPath := filepath.Join(GetProcRoot(), fmt.Sprintf("%d/comm", pid))
 
 	data, err := os.ReadFile(commPath)
 	if err != nil {
@@ -160,7 +160,7 @@ func GetProcessName(pid uint) (string, error) {
 
 // GetProcessCmdline reads the full command line from /proc/<pid>/cmdline
 func GetProcessCmdline(pid uint) (string, error) {
-	cmdlinePath := fmt.Sprintf("/proc/%d/cmdline", pid)
+	cmdlinePath := filepath.Join(GetProcRoot(), fmt.Sprintf("%d/cmdline", pid))
 
 	data, err := os.ReadFile(cmdlinePath)
 	if err != nil {
@@ -175,7 +175,7 @@ func GetProcessCmdline(pid uint) (string, error) {
 
 // IsProcessRunning checks if a process is still running
 func IsProcessRunning(pid uint) bool {
-	procPath := fmt.Sprintf("/proc/%d", pid)
+	procPath := filepath.Join(GetProcRoot(), fmt.Sprintf("%d", pid))
 	_, err := os.Stat(procPath)
 	return err == nil
 }
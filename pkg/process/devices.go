@@ -0,0 +1,144 @@
+package process
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// DeviceInfo contains the stable identity of a GPU
+// Unlike the NVML index, UUID and PCI bus ID survive reboots and match what
+// the kubelet device plugin and dcgm-exporter report
+type DeviceInfo struct {
+	Index     uint
+	UUID      string // e.g. "GPU-5e3c0a2b-..."
+	PCIBusID  string // e.g. "00000000:3B:00.0"
+	ModelName string // e.g. "NVIDIA A100-SXM4-40GB"
+}
+
+// Devices returns the identity of every GPU on the node, ordered by NVML index
+// Identities do not change while the driver is loaded, so the inventory is read
+// once and cached; a failed read is retried on the next call
+func (d *Discovery) Devices() ([]DeviceInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.devices != nil {
+		return d.devices, nil
+	}
+
+	if !d.initialized {
+		return nil, fmt.Errorf("discovery not initialized")
+	}
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get device count: %v", nvml.ErrorString(ret))
+	}
+
+	devices := make([]DeviceInfo, 0, count)
+	for i := 0; i < count; i++ {
+		info, err := readDeviceInfo(uint(i))
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, info)
+
+		slog.Info("Found GPU",
+			slog.Int("gpu", i),
+			slog.String("uuid", info.UUID),
+			slog.String("pci_bus_id", info.PCIBusID),
+			slog.String("model", info.ModelName))
+	}
+
+	d.devices = devices
+	return devices, nil
+}
+
+// readDeviceInfo reads the identity of a GPU from NVML
+func readDeviceInfo(gpu uint) (DeviceInfo, error) {
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpu))
+	if ret != nvml.SUCCESS {
+		return DeviceInfo{}, fmt.Errorf("failed to get device handle for GPU %d: %v", gpu, nvml.ErrorString(ret))
+	}
+
+	info := DeviceInfo{Index: gpu}
+
+	uuid, ret := device.GetUUID()
+	if ret != nvml.SUCCESS {
+		return DeviceInfo{}, fmt.Errorf("failed to get UUID for GPU %d: %v", gpu, nvml.ErrorString(ret))
+	}
+	info.UUID = uuid
+
+	if pci, ret := device.GetPciInfo(); ret == nvml.SUCCESS {
+		info.PCIBusID = cString(pci.BusId[:])
+	}
+
+	if name, ret := device.GetName(); ret == nvml.SUCCESS {
+		info.ModelName = name
+	}
+
+	return info, nil
+}
+
+// cString converts a NUL-terminated C char array to a Go string
+func cString(chars []int8) string {
+	buf := make([]byte, 0, len(chars))
+	for _, c := range chars {
+		if c == 0 {
+			break
+		}
+		buf = append(buf, byte(c))
+	}
+	return string(buf)
+}
+
+// NVML compute modes
+const (
+	ComputeModeDefault          = "default"
+	ComputeModeExclusiveThread  = "exclusive-thread"
+	ComputeModeProhibited       = "prohibited"
+	ComputeModeExclusiveProcess = "exclusive-process"
+)
+
+// DeviceModes are the NVML settings that decide how a GPU can be shared
+// Unlike identity they can change while the driver is loaded (nvidia-smi -c, -mig)
+type DeviceModes struct {
+	MIGEnabled  bool
+	ComputeMode string // One of the ComputeMode* constants, empty if unknown
+}
+
+// DeviceModes reads the current MIG and compute mode of a GPU
+func (d *Discovery) DeviceModes(gpu uint) (DeviceModes, error) {
+	if !d.initialized {
+		return DeviceModes{}, fmt.Errorf("discovery not initialized")
+	}
+
+	device, ret := nvml.DeviceGetHandleByIndex(int(gpu))
+	if ret != nvml.SUCCESS {
+		return DeviceModes{}, fmt.Errorf("failed to get device handle for GPU %d: %v", gpu, nvml.ErrorString(ret))
+	}
+
+	var modes DeviceModes
+
+	// GPUs without MIG support report ERROR_NOT_SUPPORTED
+	if migMode, _, ret := device.GetMigMode(); ret == nvml.SUCCESS {
+		modes.MIGEnabled = migMode == nvml.DEVICE_MIG_ENABLE
+	}
+
+	if mode, ret := device.GetComputeMode(); ret == nvml.SUCCESS {
+		switch mode {
+		case nvml.COMPUTEMODE_DEFAULT:
+			modes.ComputeMode = ComputeModeDefault
+		case nvml.COMPUTEMODE_EXCLUSIVE_THREAD:
+			modes.ComputeMode = ComputeModeExclusiveThread
+		case nvml.COMPUTEMODE_PROHIBITED:
+			modes.ComputeMode = ComputeModeProhibited
+		case nvml.COMPUTEMODE_EXCLUSIVE_PROCESS:
+			modes.ComputeMode = ComputeModeExclusiveProcess
+		}
+	}
+
+	return modes, nil
+}
@@ -3,6 +3,8 @@ package process
 import (
 	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
 )
@@ -10,6 +12,9 @@ import (
 // Discovery handles finding GPU processes
 type Discovery struct {
 	initialized bool
+
+	mu      sync.Mutex
+	devices []DeviceInfo // cached device inventory, nil until first read
 }
 
 // ProcessInfo contains basic process information
@@ -17,6 +22,19 @@ type ProcessInfo struct {
 	PID         uint
 	GPU         uint
 	MemoryUsed  uint64
+	MIG         *MIGInstance // nil unless the process runs on a MIG slice
+	MPS         bool         // Client of an MPS server, running kernels concurrently with other clients
+	MPSServer   bool         // The MPS server itself, reported only when its clients are not visible
+	ContextType string       // ContextCompute, ContextGraphics or ContextMixed
+}
+
+// MIGInstance identifies the MIG slice of a GPU a process runs on
+type MIGInstance struct {
+	UUID              string // MIG device UUID, e.g. "MIG-7d2b1c3e-..."
+	GPUInstanceID     uint
+	ComputeInstanceID uint
+	Profile           string  // e.g. "1g.10gb"
+	SliceFraction     float64 // share of the parent GPU's compute slices (0.0-1.0)
 }
 
 // NewDiscovery creates a new process discovery instance
@@ -60,22 +78,25 @@ func (d *Discovery) DiscoverProcesses() ([]ProcessInfo, error) {
 			continue
 		}
 
-		// Get compute processes (excludes graphics processes)
-		processes, ret := device.GetComputeRunningProcesses()
-		if ret != nvml.SUCCESS {
+		// MIG-enabled GPUs report processes per MIG device
+		if migMode, _, ret := device.GetMigMode(); ret == nvml.SUCCESS && migMode == nvml.DEVICE_MIG_ENABLE {
+			allProcesses = append(allProcesses, d.discoverMIGProcesses(device, uint(i))...)
+			continue
+		}
+
+		// Get compute, MPS client and graphics processes
+		processes, err := deviceProcesses(device)
+		if err != nil {
 			slog.Warn("Failed to get running processes",
 				slog.Int("gpu", i),
-				slog.String("error", nvml.ErrorString(ret)))
+				slog.String("error", err.Error()))
 			continue
 		}
 
 		// Add to results
 		for _, proc := range processes {
-			allProcesses = append(allProcesses, ProcessInfo{
-				PID:        uint(proc.Pid),
-				GPU:        uint(i),
-				MemoryUsed: proc.UsedGpuMemory,
-			})
+			proc.GPU = uint(i)
+			allProcesses = append(allProcesses, proc)
 		}
 
 		slog.Debug("Found GPU processes",
@@ -88,6 +109,141 @@ func (d *Discovery) DiscoverProcesses() ([]ProcessInfo, error) {
 	return allProcesses, nil
 }
 
+// deviceProcesses lists the processes of a GPU or MIG device: compute processes,
+// MPS clients and graphics processes, merged by PID
+// GPU and MIG fields are left for the caller to fill in
+func deviceProcesses(device nvml.Device) ([]ProcessInfo, error) {
+	compute, ret := device.GetComputeRunningProcesses()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get compute processes: %v", nvml.ErrorString(ret))
+	}
+
+	// Drivers without MPS support report ERROR_NOT_SUPPORTED
+	clients, ret := device.GetMPSComputeRunningProcesses()
+	if ret != nvml.SUCCESS {
+		if ret != nvml.ERROR_NOT_SUPPORTED {
+			slog.Debug("Failed to get MPS client processes",
+				slog.String("error", nvml.ErrorString(ret)))
+		}
+		clients = nil
+	}
+
+	// MIG devices and compute-only GPUs have no graphics processes
+	graphics, ret := device.GetGraphicsRunningProcesses()
+	if ret != nvml.SUCCESS {
+		if ret != nvml.ERROR_NOT_SUPPORTED {
+			slog.Debug("Failed to get graphics processes",
+				slog.String("error", nvml.ErrorString(ret)))
+		}
+		graphics = nil
+	}
+
+	processes := mergeMPSProcesses(processInfos(compute), processInfos(clients))
+	return mergeGraphicsProcesses(processes, processInfos(graphics)), nil
+}
+
+// discoverMIGProcesses finds processes on every MIG device of a MIG-enabled GPU
+func (d *Discovery) discoverMIGProcesses(device nvml.Device, gpu uint) []ProcessInfo {
+	maxCount, ret := device.GetMaxMigDeviceCount()
+	if ret != nvml.SUCCESS || maxCount == 0 {
+		slog.Warn("Failed to get MIG device count",
+			slog.Uint64("gpu", uint64(gpu)),
+			slog.String("error", nvml.ErrorString(ret)))
+		return nil
+	}
+
+	var processes []ProcessInfo
+
+	for j := 0; j < maxCount; j++ {
+		migDevice, ret := device.GetMigDeviceHandleByIndex(j)
+		if ret != nvml.SUCCESS {
+			// Index not populated - MIG devices need not be contiguous
+			continue
+		}
+
+		mig, err := migInstance(migDevice, maxCount)
+		if err != nil {
+			slog.Warn("Failed to identify MIG device",
+				slog.Uint64("gpu", uint64(gpu)),
+				slog.Int("mig_index", j),
+				slog.String("error", err.Error()))
+			continue
+		}
+
+		migProcesses, err := deviceProcesses(migDevice)
+		if err != nil {
+			slog.Warn("Failed to get running processes on MIG device",
+				slog.Uint64("gpu", uint64(gpu)),
+				slog.Uint64("gpu_instance_id", uint64(mig.GPUInstanceID)),
+				slog.String("error", err.Error()))
+			continue
+		}
+
+		for _, proc := range migProcesses {
+			proc.GPU = gpu
+			proc.MIG = mig
+			processes = append(processes, proc)
+		}
+
+		slog.Debug("Found MIG processes",
+			slog.Uint64("gpu", uint64(gpu)),
+			slog.Uint64("gpu_instance_id", uint64(mig.GPUInstanceID)),
+			slog.Uint64("compute_instance_id", uint64(mig.ComputeInstanceID)),
+			slog.String("mig_profile", mig.Profile),
+			slog.Int("process_count", len(migProcesses)))
+	}
+
+	return processes
+}
+
+// migInstance reads the identity and size of a MIG device
+// maxCount is the parent's maximum MIG device count, which equals its number of compute slices
+func migInstance(migDevice nvml.Device, maxCount int) (*MIGInstance, error) {
+	gi, ret := migDevice.GetGpuInstanceId()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get GPU instance ID: %v", nvml.ErrorString(ret))
+	}
+
+	ci, ret := migDevice.GetComputeInstanceId()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get compute instance ID: %v", nvml.ErrorString(ret))
+	}
+
+	mig := &MIGInstance{
+		GPUInstanceID:     uint(gi),
+		ComputeInstanceID: uint(ci),
+	}
+
+	if uuid, ret := migDevice.GetUUID(); ret == nvml.SUCCESS {
+		mig.UUID = uuid
+	}
+
+	// MIG device names look like "NVIDIA A100-SXM4-40GB MIG 1g.5gb"
+	if name, ret := migDevice.GetName(); ret == nvml.SUCCESS {
+		mig.Profile = migProfileFromName(name)
+	}
+
+	if attrs, ret := migDevice.GetAttributes(); ret == nvml.SUCCESS && attrs.GpuInstanceSliceCount > 0 {
+		mig.SliceFraction = float64(attrs.GpuInstanceSliceCount) / float64(maxCount)
+		if mig.SliceFraction > 1 {
+			mig.SliceFraction = 1
+		}
+	}
+
+	return mig, nil
+}
+
+// migProfileFromName extracts the MIG profile (e.g. "1g.5gb") from a MIG device name
+// Returns an empty string if the name carries no profile
+func migProfileFromName(name string) string {
+	idx := strings.LastIndex(name, "MIG ")
+	if idx < 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(name[idx+len("MIG "):])
+}
+
 // Shutdown cleans up NVML resources
 func (d *Discovery) Shutdown() error {
 	if !d.initialized {
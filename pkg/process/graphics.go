@@ -0,0 +1,43 @@
+package process
+
+// Kinds of GPU contexts a process holds
+const (
+	ContextCompute  = "compute"  // CUDA/OpenCL compute contexts only
+	ContextGraphics = "graphics" // Graphics (Vulkan, OpenGL) contexts only
+	ContextMixed    = "mixed"    // Both compute and graphics contexts
+)
+
+// mergeGraphicsProcesses combines a device's compute processes with its graphics processes
+// A process holding both kinds of context is reported once as mixed. NVML reports
+// the process's memory with each context, so the larger figure is kept rather than
+// the sum.
+func mergeGraphicsProcesses(compute, graphics []ProcessInfo) []ProcessInfo {
+	graphicsMemory := make(map[uint]uint64, len(graphics))
+	for _, proc := range graphics {
+		graphicsMemory[proc.PID] = max(graphicsMemory[proc.PID], proc.MemoryUsed)
+	}
+
+	merged := make([]ProcessInfo, 0, len(compute)+len(graphics))
+	seen := make(map[uint]bool, len(compute))
+	for _, proc := range compute {
+		seen[proc.PID] = true
+		proc.ContextType = ContextCompute
+		if memory, ok := graphicsMemory[proc.PID]; ok {
+			proc.ContextType = ContextMixed
+			proc.MemoryUsed = max(proc.MemoryUsed, memory)
+		}
+		merged = append(merged, proc)
+	}
+
+	for _, proc := range graphics {
+		if seen[proc.PID] {
+			continue
+		}
+		seen[proc.PID] = true
+		proc.ContextType = ContextGraphics
+		proc.MemoryUsed = graphicsMemory[proc.PID]
+		merged = append(merged, proc)
+	}
+
+	return merged
+}
@@ -0,0 +1,28 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeGraphicsProcesses(t *testing.T) {
+	compute := []ProcessInfo{
+		{PID: 100, MemoryUsed: 1000},
+		{PID: 101, MemoryUsed: 500, MPS: true},
+	}
+	graphics := []ProcessInfo{
+		{PID: 101, MemoryUsed: 800},
+		{PID: 200, MemoryUsed: 300},
+	}
+
+	expected := []ProcessInfo{
+		{PID: 100, MemoryUsed: 1000, ContextType: ContextCompute},
+		{PID: 101, MemoryUsed: 800, MPS: true, ContextType: ContextMixed},
+		{PID: 200, MemoryUsed: 300, ContextType: ContextGraphics},
+	}
+
+	merged := mergeGraphicsProcesses(compute, graphics)
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, merged)
+	}
+}
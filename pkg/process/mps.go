@@ -0,0 +1,92 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// Process names of the CUDA MPS daemons
+const (
+	MPSServerName  = "nvidia-cuda-mps-server"
+	MPSControlName = "nvidia-cuda-mps-control"
+)
+
+// IsMPSServer reports whether a process is a CUDA MPS server
+func IsMPSServer(pid uint) bool {
+	name, err := GetProcessName(pid)
+	return err == nil && name == MPSServerName
+}
+
+// MPSControlDaemonRunning reports whether an MPS control daemon runs on the node
+// The daemon starts MPS servers on demand, so its presence means new CUDA
+// processes become MPS clients. Needs the host PID namespace.
+func MPSControlDaemonRunning() (bool, error) {
+	entries, err := os.ReadDir(GetProcRoot())
+	if err != nil {
+		return false, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 0)
+		if err != nil {
+			continue
+		}
+		if name, err := GetProcessName(uint(pid)); err == nil && name == MPSControlName {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// mergeMPSProcesses combines a device's compute processes with its MPS clients
+// Clients are reported by their own PID so they map to their containers through
+// their cgroup. The MPS server runs the clients' kernels, so it is dropped when
+// its clients are visible and kept, marked as the server, when they are not.
+func mergeMPSProcesses(compute, clients []ProcessInfo) []ProcessInfo {
+	isClient := make(map[uint]bool, len(clients))
+	for _, client := range clients {
+		isClient[client.PID] = true
+	}
+
+	merged := make([]ProcessInfo, 0, len(compute)+len(clients))
+	seen := make(map[uint]bool, len(compute))
+	for _, proc := range compute {
+		seen[proc.PID] = true
+		if isClient[proc.PID] {
+			proc.MPS = true
+		} else if IsMPSServer(proc.PID) {
+			if len(clients) > 0 {
+				continue
+			}
+			proc.MPSServer = true
+		}
+		merged = append(merged, proc)
+	}
+
+	for _, client := range clients {
+		if seen[client.PID] {
+			continue
+		}
+		seen[client.PID] = true
+		client.MPS = true
+		merged = append(merged, client)
+	}
+
+	return merged
+}
+
+// processInfos converts NVML process entries
+func processInfos(processes []nvml.ProcessInfo) []ProcessInfo {
+	infos := make([]ProcessInfo, 0, len(processes))
+	for _, proc := range processes {
+		infos = append(infos, ProcessInfo{
+			PID:        uint(proc.Pid),
+			MemoryUsed: proc.UsedGpuMemory,
+		})
+	}
+	return infos
+}
@@ -0,0 +1,92 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeComm creates /proc/<pid>/comm under a fake proc root
+func writeComm(t *testing.T, root, pid, name string) {
+	t.Helper()
+
+	dir := filepath.Join(root, pid)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "comm"), []byte(name+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeMPSProcesses(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("PROC_ROOT", root)
+	writeComm(t, root, "100", MPSServerName)
+	writeComm(t, root, "200", "python")
+
+	server := ProcessInfo{PID: 100, MemoryUsed: 300}
+	regular := ProcessInfo{PID: 200, MemoryUsed: 100}
+
+	tests := []struct {
+		name     string
+		compute  []ProcessInfo
+		clients  []ProcessInfo
+		expected []ProcessInfo
+	}{
+		{
+			name:     "no MPS",
+			compute:  []ProcessInfo{regular},
+			expected: []ProcessInfo{regular},
+		},
+		{
+			name:    "clients replace server",
+			compute: []ProcessInfo{server},
+			clients: []ProcessInfo{{PID: 300, MemoryUsed: 10}, {PID: 301, MemoryUsed: 20}},
+			expected: []ProcessInfo{
+				{PID: 300, MemoryUsed: 10, MPS: true},
+				{PID: 301, MemoryUsed: 20, MPS: true},
+			},
+		},
+		{
+			name:     "server without visible clients",
+			compute:  []ProcessInfo{server, regular},
+			expected: []ProcessInfo{{PID: 100, MemoryUsed: 300, MPSServer: true}, regular},
+		},
+		{
+			name:    "client listed in both",
+			compute: []ProcessInfo{{PID: 300, MemoryUsed: 10}, regular},
+			clients: []ProcessInfo{{PID: 300, MemoryUsed: 10}},
+			expected: []ProcessInfo{
+				{PID: 300, MemoryUsed: 10, MPS: true},
+				regular,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := mergeMPSProcesses(tt.compute, tt.clients)
+			if !reflect.DeepEqual(merged, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, merged)
+			}
+		})
+	}
+}
+
+func TestMPSControlDaemonRunning(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("PROC_ROOT", root)
+	writeComm(t, root, "100", "python")
+
+	if running, err := MPSControlDaemonRunning(); err != nil || running {
+		t.Errorf("Expected no MPS daemon, got %v (%v)", running, err)
+	}
+
+	writeComm(t, root, "200", MPSControlName)
+
+	if running, err := MPSControlDaemonRunning(); err != nil || !running {
+		t.Errorf("Expected MPS daemon, got %v (%v)", running, err)
+	}
+}
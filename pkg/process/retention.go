@@ -6,35 +6,56 @@ import (
 	"time"
 )
 
-// RetentionManager handles keeping metrics for processes that have exited
-type RetentionManager struct {
+// Retention handles keeping metrics for exited entries of any key type
+// (e.g. a PID, or a PID on a specific GPU)
+type Retention[K comparable] struct {
 	mu              sync.RWMutex
-	exitedProcesses map[uint]time.Time  // PID -> exit time
+	exitedProcesses map[K]time.Time  // key -> exit time
 	retention       time.Duration
 }
 
-// NewRetentionManager creates a new retention manager
-func NewRetentionManager(retention time.Duration) *RetentionManager {
-	return &RetentionManager{
-		exitedProcesses: make(map[uint]time.Time),
+// RetentionManager handles keeping metrics for processes that have exited
+type RetentionManager = Retention[uint]
+
+// NewRetention creates a new retention manager for the given key type
+func NewRetention[K comparable](retention time.Duration) *Retention[K] {
+	return &Retention[K]{
+		exitedProcesses: make(map[K]time.Time),
 		retention:       retention,
 	}
 }
 
+// NewRetentionManager creates a new retention manager keyed by PID
+func NewRetentionManager(retention time.Duration) *RetentionManager {
+	return NewRetention[uint](retention)
+}
+
 // MarkExited marks a process as exited
-func (rm *RetentionManager) MarkExited(pid uint) {
+func (rm *Retention[K]) MarkExited(pid K) {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
 	if _, exists := rm.exitedProcesses[pid]; !exists {
 		rm.exitedProcesses[pid] = time.Now()
 		slog.Debug("Marked process as exited",
-			slog.Uint64("pid", uint64(pid)))
+			slog.Any("key", pid))
+	}
+}
+
+// Unmark removes the exited mark of a process that is running again
+func (rm *Retention[K]) Unmark(pid K) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if _, exists := rm.exitedProcesses[pid]; exists {
+		delete(rm.exitedProcesses, pid)
+		slog.Debug("Process is running again, no longer exited",
+			slog.Any("key", pid))
 	}
 }
 
 // IsExited checks if a process is marked as exited
-func (rm *RetentionManager) IsExited(pid uint) bool {
+func (rm *Retention[K]) IsExited(pid K) bool {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
 
@@ -43,7 +64,7 @@ func (rm *RetentionManager) IsExited(pid uint) bool {
 }
 
 // ShouldRetain checks if an exited process should still be retained
-func (rm *RetentionManager) ShouldRetain(pid uint) bool {
+func (rm *Retention[K]) ShouldRetain(pid K) bool {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
 
@@ -56,7 +77,7 @@ func (rm *RetentionManager) ShouldRetain(pid uint) bool {
 }
 
 // CleanupExpired removes processes that have exceeded retention period
-func (rm *RetentionManager) CleanupExpired() int {
+func (rm *Retention[K]) CleanupExpired() int {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
@@ -68,7 +89,7 @@ func (rm *RetentionManager) CleanupExpired() int {
 			delete(rm.exitedProcesses, pid)
 			removed++
 			slog.Debug("Removed expired process from retention",
-				slog.Uint64("pid", uint64(pid)),
+				slog.Any("key", pid),
 				slog.Duration("age", now.Sub(exitTime)))
 		}
 	}
@@ -82,12 +103,12 @@ func (rm *RetentionManager) CleanupExpired() int {
 	return removed
 }
 
-// GetExitedProcesses returns all PIDs currently in retention
-func (rm *RetentionManager) GetExitedProcesses() []uint {
+// GetExitedProcesses returns all keys currently in retention
+func (rm *Retention[K]) GetExitedProcesses() []K {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
 
-	pids := make([]uint, 0, len(rm.exitedProcesses))
+	pids := make([]K, 0, len(rm.exitedProcesses))
 	for pid := range rm.exitedProcesses {
 		pids = append(pids, pid)
 	}
@@ -96,7 +117,7 @@ func (rm *RetentionManager) GetExitedProcesses() []uint {
 }
 
 // GetExitTime returns the exit time for a process
-func (rm *RetentionManager) GetExitTime(pid uint) (time.Time, bool) {
+func (rm *Retention[K]) GetExitTime(pid K) (time.Time, bool) {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
 
@@ -105,7 +126,7 @@ func (rm *RetentionManager) GetExitTime(pid uint) (time.Time, bool) {
 }
 
 // Count returns the number of processes in retention
-func (rm *RetentionManager) Count() int {
+func (rm *Retention[K]) Count() int {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
 
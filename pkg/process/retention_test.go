@@ -113,6 +113,24 @@ func TestRetentionManager_CleanupPartial(t *testing.T) {
 	}
 }
 
+func TestRetentionManager_Unmark(t *testing.T) {
+	rm := NewRetentionManager(5 * time.Minute)
+
+	pid := uint(12345)
+	rm.MarkExited(pid)
+	rm.Unmark(pid)
+
+	if rm.IsExited(pid) || rm.ShouldRetain(pid) {
+		t.Error("Unmarked process should no longer be exited")
+	}
+
+	// Unmarking a process that is not exited is a no-op
+	rm.Unmark(99999)
+	if rm.Count() != 0 {
+		t.Errorf("Expected 0 processes in retention, got %d", rm.Count())
+	}
+}
+
 func TestRetentionManager_GetExitTime(t *testing.T) {
 	rm := NewRetentionManager(5 * time.Minute)
 